@@ -0,0 +1,242 @@
+package benchmark
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// 比較の単位となるベンチマークの条件の名前
+// ソケットのパスやポートは実行ごとに変わり得るので、アドレスは含めない
+func (c Config) Name() string {
+	name := fmt.Sprintf("%s/c=%d/pipeline=%d/payload=%d", c.Network, c.Concurrency, c.Pipeline, c.PayloadSize)
+	if c.KeepAlive {
+		name += "/keepalive"
+	}
+	if c.Compression {
+		name += "/gzip"
+	}
+	return name
+}
+
+// loadgen -jsonの出力を読み込む
+// 同じファイルに何回分も追記できるように、連続したJSONの値を全て読む
+func ReadResults(r io.Reader) ([]*Result, error) {
+	var results []*Result
+	decoder := json.NewDecoder(r)
+	for {
+		var result Result
+		if err := decoder.Decode(&result); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		results = append(results, &result)
+	}
+	return results, nil
+}
+
+// 1つの指標についての新旧の比較
+// Pはマン・ホイットニーのU検定のp値で、検定できない場合はNaN
+// レイテンシのPは分布全体を比べた1つの検定の結果で、平均やパーセンタイルごとに検定したものではない
+type Delta struct {
+	Name   string
+	Metric string
+	Unit   string
+	Old    float64
+	New    float64
+	Change float64
+	P      float64
+	OldN   int64
+	NewN   int64
+}
+
+func (d Delta) Significant(alpha float64) bool {
+	return !math.IsNaN(d.P) && d.P < alpha
+}
+
+// 新旧の結果を条件ごとにまとめて比較する
+// スループットは実行1回を1サンプルとして、レイテンシは全実行のヒストグラムを合わせたものを分布として検定する
+// レイテンシの平均やp50/p90/p99には同じp値を付ける。分布全体がずれているかどうかの検定なので、
+// 例えばp99だけが悪くなった場合でも有意と出るとは限らず、逆に有意でもp99が変わったとは言えない
+// スループットを検定するには、条件ごとに2回以上(できれば5回以上)実行しておく必要がある
+func Compare(base, head []*Result) []Delta {
+	baseGroups := groupResults(base)
+	headGroups := groupResults(head)
+	var names []string
+	for name := range baseGroups {
+		if _, ok := headGroups[name]; ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var deltas []Delta
+	for _, name := range names {
+		o, n := baseGroups[name], headGroups[name]
+		delta := Delta{Name: name, Metric: "throughput", Unit: "req/s", P: math.NaN()}
+		var oldSamples, newSamples []weightedSample
+		for _, r := range o {
+			oldSamples = append(oldSamples, weightedSample{r.Throughput, 1})
+			delta.Old += r.Throughput / float64(len(o))
+		}
+		for _, r := range n {
+			newSamples = append(newSamples, weightedSample{r.Throughput, 1})
+			delta.New += r.Throughput / float64(len(n))
+		}
+		delta.OldN, delta.NewN = int64(len(o)), int64(len(n))
+		if len(o) >= 2 && len(n) >= 2 {
+			delta.P = mannWhitneyU(oldSamples, newSamples)
+		}
+		deltas = append(deltas, delta.withChange())
+
+		oldHistogram, newHistogram := mergeHistograms(o), mergeHistograms(n)
+		p := mannWhitneyU(histogramSamples(oldHistogram), histogramSamples(newHistogram))
+		metrics := []struct {
+			name  string
+			value func(*Histogram) time.Duration
+		}{
+			{"latency(mean)", (*Histogram).Mean},
+			{"latency(p50)", func(h *Histogram) time.Duration { return h.Percentile(50) }},
+			{"latency(p90)", func(h *Histogram) time.Duration { return h.Percentile(90) }},
+			{"latency(p99)", func(h *Histogram) time.Duration { return h.Percentile(99) }},
+		}
+		for _, metric := range metrics {
+			deltas = append(deltas, Delta{
+				Name:   name,
+				Metric: metric.name,
+				Unit:   "µs",
+				Old:    float64(metric.value(oldHistogram)) / float64(time.Microsecond),
+				New:    float64(metric.value(newHistogram)) / float64(time.Microsecond),
+				P:      p,
+				OldN:   oldHistogram.Count(),
+				NewN:   newHistogram.Count(),
+			}.withChange())
+		}
+	}
+	return deltas
+}
+
+func (d Delta) withChange() Delta {
+	if d.Old != 0 {
+		d.Change = (d.New - d.Old) / d.Old
+	}
+	return d
+}
+
+func groupResults(results []*Result) map[string][]*Result {
+	groups := make(map[string][]*Result)
+	for _, r := range results {
+		name := r.Config.Name()
+		groups[name] = append(groups[name], r)
+	}
+	return groups
+}
+
+func mergeHistograms(results []*Result) *Histogram {
+	merged := NewHistogram()
+	for _, r := range results {
+		if r.Histogram != nil {
+			merged.Merge(r.Histogram)
+		}
+	}
+	return merged
+}
+
+// benchstatと同じ形式で表示する
+// 有意水準alphaで差があるとみなせないものはdeltaに~を表示する
+func WriteComparison(w io.Writer, deltas []Delta, alpha float64) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	if _, err := fmt.Fprintln(tw, "name\tmetric\told\tnew\tdelta\t"); err != nil {
+		return err
+	}
+	for _, d := range deltas {
+		change := "~"
+		if d.Significant(alpha) {
+			change = fmt.Sprintf("%+.2f%%", d.Change*100)
+		}
+		p := "p=n/a"
+		if !math.IsNaN(d.P) {
+			p = fmt.Sprintf("p=%.3f", d.P)
+		}
+		if _, err := fmt.Fprintf(tw, "%s\t%s\t%.2f %s\t%.2f %s\t%s\t(%s n=%d+%d)\n",
+			d.Name, d.Metric, d.Old, d.Unit, d.New, d.Unit, change, p, d.OldN, d.NewN); err != nil {
+			return err
+		}
+	}
+	return tw.Flush()
+}
+
+type weightedSample struct {
+	value float64
+	count int64
+}
+
+func histogramSamples(h *Histogram) []weightedSample {
+	var samples []weightedSample
+	for _, bucket := range h.Buckets() {
+		samples = append(samples, weightedSample{float64(bucket.Value), bucket.Count})
+	}
+	return samples
+}
+
+// マン・ホイットニーのU検定(両側)のp値を正規近似で求める
+// 分布の形を仮定しないので、裾の重いレイテンシの分布にも使える
+// ヒストグラムのバケットのように同じ値がまとまっている場合は、同順位の補正をしてから計算する
+func mannWhitneyU(x, y []weightedSample) float64 {
+	type sample struct {
+		value float64
+		count int64
+		fromX bool
+	}
+	var all []sample
+	var n1, n2 float64
+	for _, s := range x {
+		all = append(all, sample{s.value, s.count, true})
+		n1 += float64(s.count)
+	}
+	for _, s := range y {
+		all = append(all, sample{s.value, s.count, false})
+		n2 += float64(s.count)
+	}
+	if n1 == 0 || n2 == 0 {
+		return math.NaN()
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].value < all[j].value })
+
+	// 同じ値のグループごとに平均順位を割り当てる
+	var rankSumX, tieSum, rank float64
+	for i := 0; i < len(all); {
+		j := i
+		var tied, tiedX float64
+		for ; j < len(all) && all[j].value == all[i].value; j++ {
+			tied += float64(all[j].count)
+			if all[j].fromX {
+				tiedX += float64(all[j].count)
+			}
+		}
+		average := rank + (tied+1)/2
+		rankSumX += average * tiedX
+		tieSum += tied*tied*tied - tied
+		rank += tied
+		i = j
+	}
+	n := n1 + n2
+	u := rankSumX - n1*(n1+1)/2
+	mean := n1 * n2 / 2
+	variance := n1 * n2 / 12 * ((n + 1) - tieSum/(n*(n-1)))
+	if variance <= 0 {
+		// 全て同じ値
+		return 1
+	}
+	// 連続性の補正
+	z := (math.Abs(u-mean) - 0.5) / math.Sqrt(variance)
+	if z < 0 {
+		z = 0
+	}
+	return math.Erfc(z / math.Sqrt2)
+}
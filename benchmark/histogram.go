@@ -0,0 +1,217 @@
+package benchmark
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"math/bits"
+	"time"
+)
+
+// HDR Histogram風のレイテンシのヒストグラム
+// 値(ナノ秒)を2のべき乗ごとのバケットに分け、各バケットをさらにsubBucketCount/2個の等間隔のサブバケットに分ける
+// 小さい値でも大きい値でも相対誤差が一定(1/128 = 約0.8%以下)に収まり、サンプル数に関係なく使うメモリは数KB程度になる
+const (
+	subBucketBits  = 8
+	subBucketCount = 1 << subBucketBits
+	subBucketHalf  = subBucketCount / 2
+)
+
+type Histogram struct {
+	counts []int64
+	total  int64
+	sum    float64
+	min    int64
+	max    int64
+}
+
+func NewHistogram() *Histogram {
+	return &Histogram{min: math.MaxInt64}
+}
+
+// 値からカウンタの添字を求める
+// subBucketCount未満はそのまま、それ以上は上位subBucketBitsビットだけを残して指数部ごとに並べる
+func bucketIndex(v int64) int {
+	if v < subBucketCount {
+		return int(v)
+	}
+	exponent := bits.Len64(uint64(v)) - subBucketBits
+	return exponent*subBucketHalf + int(v>>uint(exponent))
+}
+
+// 添字に対応する値の範囲[low, high]
+func bucketRange(index int) (low, high int64) {
+	if index < subBucketCount {
+		return int64(index), int64(index)
+	}
+	exponent := index/subBucketHalf - 1
+	sub := int64(index - exponent*subBucketHalf)
+	return sub << uint(exponent), (sub+1)<<uint(exponent) - 1
+}
+
+func (h *Histogram) Record(d time.Duration) {
+	h.RecordValues(int64(d), 1)
+}
+
+func (h *Histogram) RecordValues(v, count int64) {
+	if v < 0 {
+		v = 0
+	}
+	index := bucketIndex(v)
+	if index >= len(h.counts) {
+		counts := make([]int64, index+1)
+		copy(counts, h.counts)
+		h.counts = counts
+	}
+	h.counts[index] += count
+	h.total += count
+	h.sum += float64(v) * float64(count)
+	if v < h.min {
+		h.min = v
+	}
+	if v > h.max {
+		h.max = v
+	}
+}
+
+func (h *Histogram) Merge(other *Histogram) {
+	for i, count := range other.counts {
+		if count == 0 {
+			continue
+		}
+		if i >= len(h.counts) {
+			counts := make([]int64, len(other.counts))
+			copy(counts, h.counts)
+			h.counts = counts
+		}
+		h.counts[i] += count
+	}
+	h.total += other.total
+	h.sum += other.sum
+	if other.total > 0 {
+		if other.min < h.min {
+			h.min = other.min
+		}
+		if other.max > h.max {
+			h.max = other.max
+		}
+	}
+}
+
+func (h *Histogram) Count() int64 {
+	return h.total
+}
+
+func (h *Histogram) Min() time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	return time.Duration(h.min)
+}
+
+func (h *Histogram) Max() time.Duration {
+	return time.Duration(h.max)
+}
+
+func (h *Histogram) Mean() time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	return time.Duration(h.sum / float64(h.total))
+}
+
+// 指定したパーセンタイル(0〜100)の値
+// バケットの上限を返すので、実際の値より最大で約0.8%大きくなる
+func (h *Histogram) Percentile(p float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(p / 100 * float64(h.total)))
+	if rank < 1 {
+		rank = 1
+	}
+	var seen int64
+	for i, count := range h.counts {
+		seen += count
+		if seen >= rank {
+			_, high := bucketRange(i)
+			if high > h.max {
+				high = h.max
+			}
+			return time.Duration(high)
+		}
+	}
+	return time.Duration(h.max)
+}
+
+func (h *Histogram) Percentiles() Percentiles {
+	return Percentiles{
+		Min:  h.Min(),
+		Mean: h.Mean(),
+		P50:  h.Percentile(50),
+		P90:  h.Percentile(90),
+		P99:  h.Percentile(99),
+		Max:  h.Max(),
+	}
+}
+
+// Valueはバケットの範囲の中間の値
+type Bucket struct {
+	Value int64 `json:"value"`
+	Count int64 `json:"count"`
+}
+
+// 空でないバケットを値の小さい順に返す
+func (h *Histogram) Buckets() []Bucket {
+	var buckets []Bucket
+	for i, count := range h.counts {
+		if count == 0 {
+			continue
+		}
+		low, high := bucketRange(i)
+		buckets = append(buckets, Bucket{Value: low + (high-low)/2, Count: count})
+	}
+	return buckets
+}
+
+// JSONでは空でないバケットだけを保存する
+type histogramJSON struct {
+	SubBucketBits int      `json:"sub_bucket_bits"`
+	Count         int64    `json:"count"`
+	Sum           float64  `json:"sum"`
+	Min           int64    `json:"min"`
+	Max           int64    `json:"max"`
+	Buckets       []Bucket `json:"buckets"`
+}
+
+func (h *Histogram) MarshalJSON() ([]byte, error) {
+	return json.Marshal(histogramJSON{
+		SubBucketBits: subBucketBits,
+		Count:         h.total,
+		Sum:           h.sum,
+		Min:           h.Min().Nanoseconds(),
+		Max:           h.max,
+		Buckets:       h.Buckets(),
+	})
+}
+
+func (h *Histogram) UnmarshalJSON(data []byte) error {
+	var v histogramJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if v.SubBucketBits != subBucketBits {
+		return errors.New("benchmark: histogram resolution mismatch")
+	}
+	*h = *NewHistogram()
+	for _, bucket := range v.Buckets {
+		h.RecordValues(bucket.Value, bucket.Count)
+	}
+	// バケットの代表値ではなく記録時の正確な値に戻す
+	h.sum = v.Sum
+	if v.Count > 0 {
+		h.min = v.Min
+		h.max = v.Max
+	}
+	return nil
+}
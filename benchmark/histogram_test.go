@@ -0,0 +1,89 @@
+package benchmark
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestHistogramPercentile(t *testing.T) {
+	h := NewHistogram()
+	for i := 1; i <= 10000; i++ {
+		h.Record(time.Duration(i) * time.Microsecond)
+	}
+	for _, p := range []float64{50, 90, 99} {
+		want := time.Duration(p*100) * time.Microsecond
+		got := h.Percentile(p)
+		if math.Abs(float64(got-want))/float64(want) > 0.01 {
+			t.Errorf("p%v = %v, want %v", p, got, want)
+		}
+	}
+	if h.Min() != time.Microsecond || h.Max() != 10*time.Millisecond {
+		t.Errorf("min/max = %v/%v", h.Min(), h.Max())
+	}
+}
+
+func TestHistogramJSON(t *testing.T) {
+	h := NewHistogram()
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		h.Record(time.Duration(random.ExpFloat64() * float64(time.Millisecond)))
+	}
+	data, err := json.Marshal(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := NewHistogram()
+	if err := json.Unmarshal(data, restored); err != nil {
+		t.Fatal(err)
+	}
+	if restored.Percentiles() != h.Percentiles() || restored.Count() != h.Count() {
+		t.Errorf("restored %+v, want %+v", restored.Percentiles(), h.Percentiles())
+	}
+}
+
+func TestCompare(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	run := func(latency time.Duration) *Result {
+		h := NewHistogram()
+		for i := 0; i < 1000; i++ {
+			h.Record(latency + time.Duration(random.Int63n(int64(latency/10))))
+		}
+		return &Result{
+			Config:     Config{Network: "tcp", Concurrency: 1, Pipeline: 1},
+			Throughput: float64(time.Second/latency) * (0.99 + random.Float64()/50),
+			Histogram:  h,
+		}
+	}
+	var base, same, slow []*Result
+	for i := 0; i < 5; i++ {
+		base = append(base, run(100*time.Microsecond))
+		same = append(same, run(100*time.Microsecond))
+		slow = append(slow, run(150*time.Microsecond))
+	}
+
+	for _, d := range Compare(base, same) {
+		if d.Significant(0.01) {
+			t.Errorf("%s: unexpected significant change %+.2f%% (p=%.3f)", d.Metric, d.Change*100, d.P)
+		}
+	}
+	deltas := Compare(base, slow)
+	if len(deltas) == 0 {
+		t.Fatal("no deltas")
+	}
+	for _, d := range deltas {
+		if !d.Significant(0.05) {
+			t.Errorf("%s: regression not detected (p=%.3f)", d.Metric, d.P)
+		}
+	}
+	var buffer bytes.Buffer
+	if err := WriteComparison(&buffer, deltas, 0.05); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(buffer.Bytes(), []byte("latency(p99)")) {
+		t.Errorf("unexpected output:\n%s", buffer.String())
+	}
+}
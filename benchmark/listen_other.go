@@ -0,0 +1,19 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package benchmark
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+)
+
+// unixsockが使えないOSではUnixドメインソケットのサーバーは起動できない
+func listenUnix(network, name string) (net.Listener, string, error) {
+	return nil, "", fmt.Errorf("benchmark: %s is not supported on %s", network, runtime.GOOS)
+}
+
+func StartUnixDomainSocketDatagramServer() (*Server, error) {
+	return nil, fmt.Errorf("benchmark: unixgram is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,28 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package benchmark
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+
+	"system-programming/unixsock"
+)
+
+// ソケットファイル用に他と衝突しない一時ディレクトリを作り、その中のパスで待ち受ける
+func listenUnix(network, name string) (net.Listener, string, error) {
+	dir, err := ioutil.TempDir("", "bench-unixdomainsocket-")
+	if err != nil {
+		return nil, "", err
+	}
+	lc := unixsock.ListenConfig{Mode: 0600}
+	listener, err := lc.Listen(network, filepath.Join(dir, name))
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, "", err
+	}
+	return listener, dir, nil
+}
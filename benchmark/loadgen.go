@@ -0,0 +1,392 @@
+package benchmark
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// UDPで送れる最大のペイロード(65535 - IPヘッダ20バイト - UDPヘッダ8バイト)
+const maxPacketSize = 65507
+
+// データグラム型のメッセージの先頭に付けるシーケンス番号のサイズ
+const sequenceSize = 8
+
+// 負荷をかける条件
+// Networkはtcp, unix(ストリーム型), unixgram(データグラム型), unixpacket(SOCK_SEQPACKET), udpのいずれか
+// tcpとunixではHTTP/1.1でリクエストし、それ以外ではメッセージをそのままエコーさせる
+type Config struct {
+	Network     string        `json:"network"`
+	Address     string        `json:"address"`
+	Concurrency int           `json:"concurrency"`
+	Duration    time.Duration `json:"duration"`
+	// falseの場合はパイプライン1回分ごとに新しいコネクション(ソケット)を作る
+	KeepAlive bool `json:"keep_alive"`
+	// 1つのコネクションで応答を待たずに先行して送るリクエストの数
+	Pipeline int `json:"pipeline"`
+	// リクエストボディ(データグラムの場合はメッセージ)のバイト数。0の場合はHTTPではGETを送る
+	PayloadSize int `json:"payload_size"`
+	// HTTPのレスポンスをgzip圧縮させる。データグラム型では無視される
+	Compression bool `json:"compression"`
+	// 1回の読み書きのタイムアウト。UDPでパケットが失われた場合もこの時間でエラーになる
+	Timeout time.Duration `json:"timeout"`
+}
+
+type Percentiles struct {
+	Min  time.Duration `json:"min"`
+	Mean time.Duration `json:"mean"`
+	P50  time.Duration `json:"p50"`
+	P90  time.Duration `json:"p90"`
+	P99  time.Duration `json:"p99"`
+	Max  time.Duration `json:"max"`
+}
+
+type Result struct {
+	Config   Config        `json:"config"`
+	Requests int64         `json:"requests"`
+	Errors   int64         `json:"errors"`
+	Bytes    int64         `json:"bytes"`
+	Elapsed  time.Duration `json:"elapsed"`
+	// 1秒あたりの成功したリクエスト数
+	Throughput float64     `json:"throughput"`
+	Latency    Percentiles `json:"latency"`
+	// 比較ツールで分布の差を検定するために、レイテンシの分布をそのまま保存する
+	Histogram *Histogram `json:"histogram"`
+}
+
+func (r *Result) WriteText(w io.Writer) error {
+	c := r.Config
+	_, err := fmt.Fprintf(w,
+		"%s %s (concurrency=%d keep-alive=%t pipeline=%d payload=%d gzip=%t)\n"+
+			"  requests:   %d (%d errors) in %v\n"+
+			"  throughput: %.2f req/s, %.2f MB/s\n"+
+			"  latency:    min=%v mean=%v p50=%v p90=%v p99=%v max=%v\n",
+		c.Network, c.Address, c.Concurrency, c.KeepAlive, c.Pipeline, c.PayloadSize, c.Compression,
+		r.Requests, r.Errors, r.Elapsed.Round(time.Millisecond),
+		r.Throughput, float64(r.Bytes)/r.Elapsed.Seconds()/1e6,
+		r.Latency.Min, r.Latency.Mean, r.Latency.P50, r.Latency.P90, r.Latency.P99, r.Latency.Max,
+	)
+	return err
+}
+
+func (r *Result) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "    ")
+	return encoder.Encode(r)
+}
+
+// 1つのコネクション(ソケット)でのやりとり
+// roundTripはn個のリクエストを先行して送ってからn個のレスポンスを受け取り、レスポンスごとに送信開始からの経過時間を記録する
+type session interface {
+	roundTrip(n int, record func(latency time.Duration, bytes int)) error
+	Close() error
+}
+
+func (c *Config) validate() error {
+	switch c.Network {
+	case "tcp", "unix", "unixgram", "unixpacket", "udp":
+	default:
+		return fmt.Errorf("benchmark: unsupported network %q", c.Network)
+	}
+	if c.Address == "" {
+		return errors.New("benchmark: address is required")
+	}
+	if c.Concurrency <= 0 {
+		c.Concurrency = 1
+	}
+	if c.Pipeline <= 0 {
+		c.Pipeline = 1
+	}
+	if c.Duration <= 0 {
+		c.Duration = time.Second
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = time.Second
+	}
+	if c.PayloadSize < 0 {
+		return fmt.Errorf("benchmark: negative payload size %d", c.PayloadSize)
+	}
+	if c.Network != "tcp" && c.Network != "unix" && c.PayloadSize+sequenceSize > maxPacketSize {
+		return fmt.Errorf("benchmark: payload size %d exceeds datagram limit %d", c.PayloadSize, maxPacketSize-sequenceSize)
+	}
+	return nil
+}
+
+// 指定した条件で負荷をかけ、結果を集計する
+// Concurrency個のgoroutineがそれぞれ自分のコネクションを持ち、Durationが経過するかctxがキャンセルされるまでリクエストを繰り返す
+func Run(ctx context.Context, config Config) (*Result, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	payload := make([]byte, config.PayloadSize)
+	rand.New(rand.NewSource(1)).Read(payload)
+
+	ctx, cancel := context.WithTimeout(ctx, config.Duration)
+	defer cancel()
+
+	type workerResult struct {
+		histogram *Histogram
+		errors    int64
+		bytes     int64
+	}
+	results := make([]workerResult, config.Concurrency)
+	for i := range results {
+		results[i].histogram = NewHistogram()
+	}
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < config.Concurrency; i++ {
+		wg.Add(1)
+		go func(result *workerResult) {
+			defer wg.Done()
+			record := func(latency time.Duration, bytes int) {
+				result.histogram.Record(latency)
+				result.bytes += int64(bytes)
+			}
+			var s session
+			for ctx.Err() == nil {
+				if s == nil {
+					var err error
+					s, err = dial(&config, payload)
+					if err != nil {
+						result.errors++
+						// サーバーが起動していない場合などに空回りしないように少し待つ
+						time.Sleep(10 * time.Millisecond)
+						continue
+					}
+				}
+				if err := s.roundTrip(config.Pipeline, record); err != nil {
+					result.errors++
+					_ = s.Close()
+					s = nil
+					continue
+				}
+				if !config.KeepAlive {
+					_ = s.Close()
+					s = nil
+				}
+			}
+			if s != nil {
+				_ = s.Close()
+			}
+		}(&results[i])
+	}
+	wg.Wait()
+
+	result := &Result{
+		Config:    config,
+		Elapsed:   time.Since(start),
+		Histogram: NewHistogram(),
+	}
+	for _, r := range results {
+		result.Histogram.Merge(r.histogram)
+		result.Errors += r.errors
+		result.Bytes += r.bytes
+	}
+	result.Requests = result.Histogram.Count()
+	result.Throughput = float64(result.Requests) / result.Elapsed.Seconds()
+	result.Latency = result.Histogram.Percentiles()
+	return result, nil
+}
+
+func dial(config *Config, payload []byte) (session, error) {
+	if config.Network == "unixgram" {
+		return dialUnixgram(config, payload)
+	}
+	conn, err := net.DialTimeout(config.Network, config.Address, config.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	switch config.Network {
+	case "tcp", "unix":
+		return &httpSession{
+			conn:    conn,
+			reader:  bufio.NewReader(conn),
+			writer:  bufio.NewWriter(conn),
+			config:  config,
+			payload: payload,
+		}, nil
+	default:
+		return newPacketSession(conn, config, payload), nil
+	}
+}
+
+// unixgramではサーバーから返信を受け取るために、クライアント側も一時ディレクトリに自分のソケットファイルを作ってから接続する
+func dialUnixgram(config *Config, payload []byte) (session, error) {
+	dir, err := ioutil.TempDir("", "bench-unixdomainsocket-client-")
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialUnix(
+		"unixgram",
+		&net.UnixAddr{Name: filepath.Join(dir, "client.sock"), Net: "unixgram"},
+		&net.UnixAddr{Name: config.Address, Net: "unixgram"},
+	)
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+	s := newPacketSession(conn, config, payload)
+	s.dir = dir
+	return s, nil
+}
+
+type httpSession struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	writer  *bufio.Writer
+	config  *Config
+	payload []byte
+}
+
+func (s *httpSession) newRequest(last bool) (*http.Request, error) {
+	method := "GET"
+	var body io.Reader
+	if len(s.payload) > 0 {
+		method = "POST"
+		body = bytes.NewReader(s.payload)
+	}
+	request, err := http.NewRequest(method, "http://localhost/", body)
+	if err != nil {
+		return nil, err
+	}
+	if s.config.Compression {
+		request.Header.Set("Accept-Encoding", "gzip")
+	}
+	// Keep-Aliveしない場合はパイプラインの最後のリクエストでコネクションを閉じてもらう
+	if last && !s.config.KeepAlive {
+		request.Close = true
+	}
+	return request, nil
+}
+
+func (s *httpSession) roundTrip(n int, record func(time.Duration, int)) error {
+	if err := s.conn.SetDeadline(time.Now().Add(s.config.Timeout)); err != nil {
+		return err
+	}
+	// リクエストだけ先に送る
+	requests := make([]*http.Request, n)
+	start := time.Now()
+	for i := range requests {
+		request, err := s.newRequest(i == n-1)
+		if err != nil {
+			return err
+		}
+		if err := request.Write(s.writer); err != nil {
+			return err
+		}
+		requests[i] = request
+	}
+	if err := s.writer.Flush(); err != nil {
+		return err
+	}
+	// レスポンスをまとめて受信
+	for _, request := range requests {
+		response, err := http.ReadResponse(s.reader, request)
+		if err != nil {
+			return err
+		}
+		size, err := readBody(response)
+		if err != nil {
+			return err
+		}
+		if response.StatusCode != http.StatusOK {
+			return fmt.Errorf("benchmark: unexpected status %s", response.Status)
+		}
+		record(time.Since(start), size)
+	}
+	return nil
+}
+
+// ReadResponseは自動で展開しないので、Content-Encodingを見てgzipを展開しつつ読み捨てる
+func readBody(response *http.Response) (int, error) {
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	var body io.Reader = response.Body
+	if response.Header.Get("Content-Encoding") == "gzip" {
+		reader, err := gzip.NewReader(response.Body)
+		if err != nil {
+			return 0, err
+		}
+		body = reader
+	}
+	size, err := io.Copy(ioutil.Discard, body)
+	return int(size), err
+}
+
+func (s *httpSession) Close() error {
+	return s.conn.Close()
+}
+
+type packetSession struct {
+	conn     net.Conn
+	config   *Config
+	message  []byte
+	buffer   []byte
+	payload  []byte
+	sequence uint64
+	// unixgramのクライアント側のソケットファイルを置いた一時ディレクトリ
+	dir string
+}
+
+func newPacketSession(conn net.Conn, config *Config, payload []byte) *packetSession {
+	return &packetSession{
+		conn:    conn,
+		config:  config,
+		message: make([]byte, sequenceSize+len(payload)),
+		buffer:  make([]byte, maxPacketSize),
+		payload: payload,
+	}
+}
+
+func (s *packetSession) roundTrip(n int, record func(time.Duration, int)) error {
+	if err := s.conn.SetDeadline(time.Now().Add(s.config.Timeout)); err != nil {
+		return err
+	}
+	copy(s.message[sequenceSize:], s.payload)
+	first := s.sequence
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		binary.BigEndian.PutUint64(s.message, s.sequence)
+		s.sequence++
+		if _, err := s.conn.Write(s.message); err != nil {
+			return err
+		}
+	}
+	for i := 0; i < n; i++ {
+		length, err := s.conn.Read(s.buffer)
+		if err != nil {
+			return err
+		}
+		// UDPでは古いレスポンスが遅れて届くこともあるので、シーケンス番号で今回の分かを確認する
+		if length < sequenceSize || binary.BigEndian.Uint64(s.buffer) < first {
+			i--
+			continue
+		}
+		record(time.Since(start), length)
+	}
+	return nil
+}
+
+func (s *packetSession) Close() error {
+	err := s.conn.Close()
+	if s.dir != "" {
+		_ = os.RemoveAll(s.dir)
+	}
+	return err
+}
@@ -0,0 +1,140 @@
+package benchmark
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync"
+)
+
+// ベンチマーク用のサーバーのハンドル
+// ポートは空いているものをOSに選ばせ、ソケットファイルは毎回別の一時ディレクトリに作るので、同時にいくつ起動しても衝突しない
+// Close()を呼ぶと待ち受けをやめ、処理中のコネクションを閉じ、goroutineの終了を待ってからソケットファイルを削除する
+type Server struct {
+	listener   net.Listener
+	packetConn net.PacketConn
+	// ソケットファイルを置いた一時ディレクトリ(TCP, UDPでは空)
+	dir   string
+	ready chan struct{}
+	wg    sync.WaitGroup
+	mutex sync.Mutex
+	conns map[net.Conn]struct{}
+	done  bool
+}
+
+// ネットワーク名に対応するサーバーを起動する
+func StartServer(network string) (*Server, error) {
+	switch network {
+	case "tcp":
+		return StartTCPServer()
+	case "unix":
+		return StartUnixDomainSocketStreamServer()
+	case "unixgram":
+		return StartUnixDomainSocketDatagramServer()
+	case "unixpacket":
+		return StartUnixDomainSocketSeqPacketServer()
+	case "udp":
+		return StartUDPServer()
+	}
+	return nil, fmt.Errorf("benchmark: unsupported network %q", network)
+}
+
+// Accept()を繰り返し、コネクションごとにhandleをgoroutineで実行する
+// 待ち受けはこの関数を呼ぶ前に始まっているので、返ってきた時点で接続を受け付けられる
+func serve(listener net.Listener, dir string, handle func(net.Conn)) *Server {
+	s := &Server{
+		listener: listener,
+		dir:      dir,
+		ready:    make(chan struct{}),
+		conns:    make(map[net.Conn]struct{}),
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		close(s.ready)
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				// Close()されたら終了
+				return
+			}
+			if !s.track(conn) {
+				_ = conn.Close()
+				return
+			}
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				defer s.untrack(conn)
+				handle(conn)
+			}()
+		}
+	}()
+	return s
+}
+
+func servePacket(conn net.PacketConn, dir string, handle func(net.PacketConn)) *Server {
+	s := &Server{
+		packetConn: conn,
+		dir:        dir,
+		ready:      make(chan struct{}),
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		close(s.ready)
+		handle(conn)
+	}()
+	return s
+}
+
+func (s *Server) track(conn net.Conn) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.done {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	return true
+}
+
+func (s *Server) untrack(conn net.Conn) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.conns, conn)
+}
+
+// 待ち受けているアドレス。Unixドメインソケットの場合はソケットファイルのパス
+func (s *Server) Addr() net.Addr {
+	if s.packetConn != nil {
+		return s.packetConn.LocalAddr()
+	}
+	return s.listener.Addr()
+}
+
+// サーバーのgoroutineが動き始めたらクローズされる
+func (s *Server) Ready() <-chan struct{} {
+	return s.ready
+}
+
+func (s *Server) Close() error {
+	var err error
+	if s.packetConn != nil {
+		err = s.packetConn.Close()
+	} else {
+		err = s.listener.Close()
+		s.mutex.Lock()
+		s.done = true
+		for conn := range s.conns {
+			_ = conn.Close()
+		}
+		s.mutex.Unlock()
+	}
+	s.wg.Wait()
+	if s.dir != "" {
+		if removeErr := os.RemoveAll(s.dir); err == nil {
+			err = removeErr
+		}
+	}
+	return err
+}
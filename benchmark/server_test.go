@@ -2,11 +2,11 @@ package benchmark
 
 import (
 	"bufio"
+	"context"
 	"net"
 	"net/http"
 	"net/http/httputil"
 	"os"
-	"path/filepath"
 	"testing"
 	"time"
 )
@@ -20,68 +20,203 @@ import (
 	PASS
 	ok      system-programming/benchmark    5.518s
 	HTTPのスループットだけを計測するマイクロベンチマークで、TCPには比較的不利なベンチマーク
+	Keep-Aliveやパイプライニング、ペイロードサイズを変えた比較はcmd/loadgenで行う
  */
 
+var (
+	tcpServer    *Server
+	streamServer *Server
+)
+
 func BenchmarkTCPServer(b *testing.B) {
+	address := tcpServer.Addr().String()
 	for i := 0; i < b.N; i++ {
-		conn, err := net.Dial("tcp", "localhost:18888")
-		if err != nil {
-			panic(err)
-		}
-		request, err := http.NewRequest(
-			"GET",
-			"http://localhost:18888",
-			nil,
-		)
-		if err != nil {
-			panic(err)
-		}
-		if err := request.Write(conn); err != nil {
-			panic(err)
-		}
-		response, err := http.ReadResponse(bufio.NewReader(conn), request)
+		get(b, "tcp", address)
+	}
+}
+
+func BenchmarkUnixDomainSocketStreamServer(b *testing.B) {
+	address := streamServer.Addr().String()
+	for i := 0; i < b.N; i++ {
+		get(b, "unix", address)
+	}
+}
+
+// Unixドメインソケットのストリーム型、データグラム型、SOCK_SEQPACKET型で、64バイトのメッセージのエコーにかかる時間を比べる
+// HTTPのパースの時間を含めないように、ストリーム型もメッセージをそのまま返すサーバーを使う
+func BenchmarkUnixDomainSocketLatency(b *testing.B) {
+	startStreamEchoServer := func() (*Server, error) {
+		listener, dir, err := listenUnix("unix", "echo.sock")
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
-		if _, err := httputil.DumpResponse(response, true); err != nil {
-			panic(err)
+		return serve(listener, dir, echoMessages), nil
+	}
+	cases := []struct {
+		name    string
+		network string
+		start   func() (*Server, error)
+	}{
+		{"stream", "unix", startStreamEchoServer},
+		{"datagram", "unixgram", StartUnixDomainSocketDatagramServer},
+		{"seqpacket", "unixpacket", StartUnixDomainSocketSeqPacketServer},
+	}
+	for _, c := range cases {
+		c := c
+		b.Run(c.name, func(b *testing.B) {
+			server, err := c.start()
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer func() {
+				if err := server.Close(); err != nil {
+					b.Error(err)
+				}
+			}()
+			config := &Config{Network: c.network, Address: server.Addr().String(), Timeout: time.Second}
+			payload := make([]byte, 64)
+			var s session
+			if c.network == "unix" {
+				// ストリーム型の場合もメッセージの送受信はpacketSessionで行う
+				conn, err := net.Dial("unix", config.Address)
+				if err != nil {
+					b.Fatal(err)
+				}
+				s = newPacketSession(conn, config, payload)
+			} else {
+				s, err = dial(config, payload)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+			defer s.Close()
+			record := func(time.Duration, int) {}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := s.roundTrip(1, record); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// 1回ごとに接続してGETし、コネクションを閉じる
+func get(b *testing.B, network, address string) {
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			b.Fatal(err)
 		}
+	}()
+	request, err := http.NewRequest(
+		"GET",
+		"http://localhost/",
+		nil,
+	)
+	if err != nil {
+		b.Fatal(err)
+	}
+	request.Close = true
+	if err := request.Write(conn); err != nil {
+		b.Fatal(err)
+	}
+	response, err := http.ReadResponse(bufio.NewReader(conn), request)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if _, err := httputil.DumpResponse(response, true); err != nil {
+		b.Fatal(err)
 	}
 }
 
-func BenchmarkUnixDomainSocketStreamServer(b *testing.B) {
-	for i := 0; i < b.N; i++ {
-		conn, err := net.Dial("unix", filepath.Join(os.TempDir(), "bench-unixdomainsocket-stream"))
+// サーバーはテストごとに起動して終了するので、並列に実行しても衝突しない
+func TestRun(t *testing.T) {
+	for _, network := range []string{"tcp", "unix", "unixgram", "unixpacket", "udp"} {
+		network := network
+		t.Run(network, func(t *testing.T) {
+			t.Parallel()
+			server, err := StartServer(network)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				if err := server.Close(); err != nil {
+					t.Error(err)
+				}
+			}()
+			<-server.Ready()
+			for _, keepAlive := range []bool{true, false} {
+				config := Config{
+					Network:     network,
+					Address:     server.Addr().String(),
+					Concurrency: 2,
+					Duration:    100 * time.Millisecond,
+					KeepAlive:   keepAlive,
+					Pipeline:    4,
+					PayloadSize: 512,
+					Compression: true,
+				}
+				result, err := Run(context.Background(), config)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if result.Requests == 0 {
+					t.Errorf("keep-alive=%t: no requests completed (%d errors)", keepAlive, result.Errors)
+				}
+				if result.Latency.P50 > result.Latency.P99 {
+					t.Errorf("p50 %v > p99 %v", result.Latency.P50, result.Latency.P99)
+				}
+			}
+		})
+	}
+}
+
+func TestServerClose(t *testing.T) {
+	for i := 0; i < 3; i++ {
+		server, err := StartUnixDomainSocketStreamServer()
 		if err != nil {
-			panic(err)
+			t.Fatal(err)
 		}
-		request, err := http.NewRequest(
-			"GET",
-			"http://localhost:18888",
-			nil,
-		)
+		path := server.Addr().String()
+		// 接続したまま閉じても、Close()はセッションの終了を待って戻る
+		conn, err := net.Dial("unix", path)
 		if err != nil {
-			panic(err)
+			t.Fatal(err)
 		}
-		if err := request.Write(conn); err != nil {
-			panic(err)
+		if err := server.Close(); err != nil {
+			t.Fatal(err)
 		}
-		response, err := http.ReadResponse(bufio.NewReader(conn), request)
-		if err != nil {
-			panic(err)
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("socket file %s remains after Close: %v", path, err)
 		}
-		if _, err := httputil.DumpResponse(response, true); err != nil {
-			panic(err)
+		if _, err := conn.Read(make([]byte, 1)); err == nil {
+			t.Error("connection is still open after Close")
 		}
+		_ = conn.Close()
 	}
 }
 
 func TestMain(m *testing.M) {
-	// init
-	go UnixDomainSocketStreamServer()
-	go TCPServer()
-	time.Sleep(time.Second)
+	var err error
+	if tcpServer, err = StartTCPServer(); err != nil {
+		panic(err)
+	}
+	if streamServer, err = StartUnixDomainSocketStreamServer(); err != nil {
+		panic(err)
+	}
+	<-tcpServer.Ready()
+	<-streamServer.Ready()
 	// run test
 	code := m.Run()
+	if err := tcpServer.Close(); err != nil {
+		panic(err)
+	}
+	if err := streamServer.Close(); err != nil {
+		panic(err)
+	}
 	os.Exit(code)
 }
@@ -0,0 +1,109 @@
+package benchmark
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const helloWorld = "Hello world\n"
+
+// ストリーム型のサーバー(TCP, Unixドメインソケット)で共通の1セッションの処理
+// Keep-Aliveとパイプライニングに対応するため、コネクションが閉じられるかConnection: closeが来るまでリクエストを順に処理する
+// リクエストの順にレスポンスを書き出すので、パイプライニングされたリクエストもそのまま処理できる
+// ボディ付きのリクエストはボディをそのまま返し(エコー)、Accept-Encodingにgzipがあればgzip圧縮して返す
+func processSession(conn net.Conn) {
+	defer func() {
+		_ = conn.Close()
+	}()
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+	for {
+		request, err := http.ReadRequest(reader)
+		if err != nil {
+			// EOFやクライアント側からの切断はセッションの終了として扱う
+			return
+		}
+		content, err := ioutil.ReadAll(request.Body)
+		if err != nil {
+			return
+		}
+		if len(content) == 0 {
+			content = []byte(helloWorld)
+		}
+		response := http.Response{
+			StatusCode: http.StatusOK,
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     make(http.Header),
+			Close:      request.Close,
+		}
+		if isGZipAcceptable(request) {
+			var buffer bytes.Buffer
+			gWriter := gzip.NewWriter(&buffer)
+			if _, err := gWriter.Write(content); err != nil {
+				return
+			}
+			if err := gWriter.Close(); err != nil {
+				return
+			}
+			content = buffer.Bytes()
+			response.Header.Set("Content-Encoding", "gzip")
+		}
+		// Keep-Aliveを維持するにはContentLengthの設定が必要
+		response.ContentLength = int64(len(content))
+		response.Body = ioutil.NopCloser(bytes.NewReader(content))
+		if err := response.Write(writer); err != nil {
+			return
+		}
+		// パイプライニングで後続のリクエストがすでに届いている場合はまとめて書き出す
+		if reader.Buffered() == 0 || request.Close {
+			if err := writer.Flush(); err != nil {
+				return
+			}
+		}
+		if request.Close {
+			return
+		}
+	}
+}
+
+func isGZipAcceptable(request *http.Request) bool {
+	return strings.Contains(strings.Join(request.Header["Accept-Encoding"], ","), "gzip")
+}
+
+// データグラム型のサーバー(UDP, SOCK_SEQPACKET)で共通の処理
+// 受信したメッセージをそのまま送り返す
+func echoPackets(conn net.PacketConn) {
+	buffer := make([]byte, maxPacketSize)
+	for {
+		length, remoteAddress, err := conn.ReadFrom(buffer)
+		if err != nil {
+			return
+		}
+		if _, err := conn.WriteTo(buffer[:length], remoteAddress); err != nil {
+			return
+		}
+	}
+}
+
+// コネクション指向のSOCK_SEQPACKETではReadの1回がメッセージ1つに対応する
+func echoMessages(conn net.Conn) {
+	defer func() {
+		_ = conn.Close()
+	}()
+	buffer := make([]byte, maxPacketSize)
+	for {
+		length, err := conn.Read(buffer)
+		if err != nil {
+			return
+		}
+		if _, err := conn.Write(buffer[:length]); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,13 @@
+package benchmark
+
+import (
+	"net"
+)
+
+func StartUDPServer() (*Server, error) {
+	conn, err := net.ListenPacket("udp", "localhost:0")
+	if err != nil {
+		return nil, err
+	}
+	return servePacket(conn, "", echoPackets), nil
+}
@@ -0,0 +1,27 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package benchmark
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"system-programming/unixsock"
+)
+
+// データグラム型では返信先のアドレスが必要なので、クライアントも自分のソケットファイルを持つ必要がある
+func StartUnixDomainSocketDatagramServer() (*Server, error) {
+	dir, err := ioutil.TempDir("", "bench-unixdomainsocket-")
+	if err != nil {
+		return nil, err
+	}
+	lc := unixsock.ListenConfig{Mode: 0600}
+	conn, err := lc.ListenPacket("unixgram", filepath.Join(dir, "datagram.sock"))
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+	return servePacket(conn, dir, echoPackets), nil
+}
@@ -0,0 +1,10 @@
+package benchmark
+
+// SOCK_SEQPACKETはストリーム型と同じくコネクションを確立するが、メッセージの境界が保存される
+func StartUnixDomainSocketSeqPacketServer() (*Server, error) {
+	listener, dir, err := listenUnix("unixpacket", "seqpacket.sock")
+	if err != nil {
+		return nil, err
+	}
+	return serve(listener, dir, echoMessages), nil
+}
@@ -0,0 +1,269 @@
+package bincodec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// IPv4ヘッダー(オプションなし)
+type ipv4Header struct {
+	Version        uint8 `bin:"bits=4"`
+	IHL            uint8 `bin:"bits=4"`
+	TOS            uint8
+	TotalLength    uint16
+	ID             uint16
+	Flags          uint8  `bin:"bits=3"`
+	FragmentOffset uint16 `bin:"bits=13"`
+	TTL            uint8
+	Protocol       uint8
+	Checksum       uint16
+	Source         [4]byte
+	Destination    [4]byte
+}
+
+func TestIPv4Header(t *testing.T) {
+	data := []byte{
+		0x45, 0x00, 0x00, 0x54, 0x1c, 0x46, 0x40, 0x00,
+		0x40, 0x01, 0xb1, 0xe6, 0xc0, 0xa8, 0x00, 0x01,
+		0xc0, 0xa8, 0x00, 0xc7,
+	}
+	var h ipv4Header
+	if err := Unmarshal(data, &h); err != nil {
+		t.Fatal(err)
+	}
+	want := ipv4Header{
+		Version: 4, IHL: 5, TotalLength: 84, ID: 0x1c46, Flags: 2,
+		TTL: 64, Protocol: 1, Checksum: 0xb1e6,
+		Source: [4]byte{192, 168, 0, 1}, Destination: [4]byte{192, 168, 0, 199},
+	}
+	if h != want {
+		t.Fatalf("got %+v, want %+v", h, want)
+	}
+	b, err := Marshal(&h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, data) {
+		t.Fatalf("got % x, want % x", b, data)
+	}
+}
+
+// WAVファイルの先頭(RIFFヘッダーとfmtチャンク)
+type waveFormat struct {
+	ChunkID       string `bin:"size=4"`
+	ChunkSize     uint32
+	Format        string `bin:"size=4"`
+	SubchunkID    string `bin:"size=4"`
+	SubchunkSize  uint32
+	AudioFormat   uint16
+	Channels      uint16
+	SampleRate    uint32
+	ByteRate      uint32
+	BlockAlign    uint16
+	BitsPerSample uint16
+}
+
+func TestLittleEndian(t *testing.T) {
+	w := waveFormat{
+		ChunkID: "RIFF", ChunkSize: 36, Format: "WAVE", SubchunkID: "fmt ", SubchunkSize: 16,
+		AudioFormat: 1, Channels: 2, SampleRate: 44100, ByteRate: 176400, BlockAlign: 4, BitsPerSample: 16,
+	}
+	var buffer bytes.Buffer
+	encoder := NewEncoder(&buffer)
+	encoder.ByteOrder = binary.LittleEndian
+	if err := encoder.Encode(w); err != nil {
+		t.Fatal(err)
+	}
+	b := buffer.Bytes()
+	if len(b) != 36 || string(b[:4]) != "RIFF" || binary.LittleEndian.Uint32(b[24:]) != 44100 {
+		t.Fatalf("unexpected encoding % x", b)
+	}
+	var got waveFormat
+	decoder := NewDecoder(&buffer)
+	decoder.ByteOrder = binary.LittleEndian
+	if err := decoder.Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got != w {
+		t.Fatalf("got %+v, want %+v", got, w)
+	}
+}
+
+type point struct {
+	X, Y int16
+}
+
+type record struct {
+	Magic   string `bin:"size=4"`
+	Flags   uint8  `bin:"bits=7"`
+	Deleted bool   `bin:"bits=1"`
+	Size    uint32 `bin:"le"`
+	Name    string `bin:"len=uint8"`
+	Count   uint16
+	Points  []point `bin:"count=Count"`
+	Ratio   float64
+	Extra   []byte `bin:"if=Flags&0x1,len=uint16"`
+	Version uint8  `bin:"if=Flags==2"`
+	Body    []byte `bin:"rest"`
+	cache   int
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []record{
+		{Magic: "REC", Flags: 1, Size: 1, Name: "Gopher", Count: 2, Points: []point{{1, -2}, {-300, 400}}, Ratio: 0.5, Extra: []byte("extra"), Body: []byte("body")},
+		{Magic: "REC", Flags: 2, Deleted: true, Name: "", Points: []point{}, Version: 3},
+	}
+	for _, r := range tests {
+		b, err := Marshal(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got record
+		if err := Unmarshal(b, &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, r) {
+			t.Errorf("got %+v, want %+v", got, r)
+		}
+	}
+}
+
+// 可変長の要素は構造体に包んで、要素ごとに長さを付ける
+func TestSliceOfStructs(t *testing.T) {
+	type name struct {
+		Value string `bin:"len=uint8"`
+	}
+	type names struct {
+		Names []name `bin:"len=uint8"`
+	}
+	want := names{Names: []name{{"a"}, {"bc"}}}
+	b, err := Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, []byte{2, 1, 'a', 2, 'b', 'c'}) {
+		t.Fatalf("got % x", b)
+	}
+	var got names
+	if err := Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestConditionalField(t *testing.T) {
+	r := record{Magic: "REC", Flags: 0, Extra: []byte("ignored"), Version: 9, Body: []byte{}, Points: []point{}}
+	b, err := Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 4 + 1 + 4 + 1 + 2 + 8、ExtraとVersionは書かれない
+	if len(b) != 20 {
+		t.Fatalf("got %d bytes, want 20", len(b))
+	}
+	// Sizeはリトルエンディアン
+	if !bytes.Equal(b[5:9], []byte{0, 0, 0, 0}) {
+		t.Fatalf("unexpected size % x", b[5:9])
+	}
+}
+
+func TestErrors(t *testing.T) {
+	if _, err := Marshal(record{Count: 3}); !errors.Is(err, ErrLength) {
+		t.Errorf("count mismatch: got %v", err)
+	}
+	if _, err := Marshal(record{Magic: "TOO LONG"}); err == nil || !strings.Contains(err.Error(), "record.Magic") {
+		t.Errorf("long fixed string: got %v", err)
+	}
+	if _, err := Marshal(struct {
+		A uint8 `bin:"bits=3"`
+	}{}); !errors.Is(err, ErrBitAlignment) {
+		t.Errorf("unaligned bitfield: got %v", err)
+	}
+	if _, err := Marshal(struct {
+		A string
+	}{}); err == nil {
+		t.Error("string without size: no error")
+	}
+	if _, err := Marshal(struct {
+		A []byte `bin:"count=N"`
+		N uint8
+	}{}); err == nil {
+		t.Error("count field declared later: no error")
+	}
+
+	// 要素ごとの長さを書けないので、文字列やスライスの要素は型の検査で拒否する
+	var names struct {
+		Names []string `bin:"len=uint8"`
+	}
+	if err := Unmarshal([]byte{1, 'a'}, &names); err == nil {
+		t.Error("[]string: no error")
+	}
+	if _, err := Marshal(names); err == nil {
+		t.Error("[]string: no error on encode")
+	}
+	var nested struct {
+		Data [2][][]byte
+	}
+	if err := Unmarshal([]byte{1, 'a'}, &nested); err == nil {
+		t.Error("[2][][]byte: no error")
+	}
+
+	var r record
+	b, _ := Marshal(record{Magic: "REC", Name: "Gopher", Points: []point{}})
+	if err := Unmarshal(b[:10], &r); err != io.ErrUnexpectedEOF {
+		t.Errorf("truncated: got %v", err)
+	}
+	if err := NewDecoder(bytes.NewReader(nil)).Decode(&r); err != io.EOF {
+		t.Errorf("empty: got %v", err)
+	}
+	var s struct {
+		Data []uint32 `bin:"len=uint32"`
+	}
+	if err := Unmarshal([]byte{0xff, 0xff, 0xff, 0xff}, &s); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("huge length: got %v", err)
+	}
+	if _, err := Marshal(struct {
+		Data []byte `bin:"len=uint8"`
+	}{make([]byte, 256)}); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("length overflows prefix: got %v", err)
+	}
+	if _, err := Marshal(struct {
+		Text string `bin:"len=uint16"`
+	}{strings.Repeat("a", 65536)}); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("string length overflows prefix: got %v", err)
+	}
+}
+
+func TestStream(t *testing.T) {
+	var buffer bytes.Buffer
+	encoder := NewEncoder(&buffer)
+	for i := int16(0); i < 3; i++ {
+		if err := encoder.Encode(point{X: i, Y: -i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	decoder := NewDecoder(&buffer)
+	for i := int16(0); ; i++ {
+		var p point
+		err := decoder.Decode(&p)
+		if err == io.EOF {
+			if i != 3 {
+				t.Fatalf("got %d points, want 3", i)
+			}
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.X != i || p.Y != -i {
+			t.Fatalf("got %+v", p)
+		}
+	}
+}
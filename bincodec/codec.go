@@ -0,0 +1,466 @@
+// bincodecパッケージは構造体のタグに従って、構造体とバイナリデータを相互に変換する
+// read.goではbinary.Read()でビッグエンディアンのint32を1つ読んだが、ファイルのヘッダーやパケットの形式を
+// binary.Read()の呼び出しを並べる代わりに構造体として宣言的に書けるようにしたもの
+//
+//	type Header struct {
+//		Magic   string `bin:"size=4"`
+//		Version uint8  `bin:"bits=4"`
+//		Flags   uint8  `bin:"bits=4"`
+//		Length  uint32 `bin:"le"`
+//		Name    string `bin:"len=uint8"`
+//		Extra   []byte `bin:"if=Flags&0x1,len=uint16"`
+//	}
+//
+// タグの書き方はfield.parse()を参照
+// binary.Read()と同じく、数値は固定長で、boolは1バイト、配列は要素を順に並べる
+package bincodec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+)
+
+var (
+	ErrBitAlignment = errors.New("bincodec: bitfields must end on a byte boundary")
+	ErrLength       = errors.New("bincodec: length does not match")
+	ErrTooLarge     = errors.New("bincodec: slice too large")
+)
+
+// フィールドの読み書きでのエラー
+type FieldError struct {
+	Struct string
+	Field  string
+	Err    error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("bincodec: %s.%s: %v", e.Struct, e.Field, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// 構造体をビッグエンディアンで書き出したバイト列を返す
+func Marshal(v interface{}) ([]byte, error) {
+	var buffer bytes.Buffer
+	if err := NewEncoder(&buffer).Encode(v); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// バイト列を構造体に読み込む
+// 構造体を読み終えたあとにデータが残っていてもエラーにはしない
+func Unmarshal(b []byte, v interface{}) error {
+	return NewDecoder(bytes.NewReader(b)).Decode(v)
+}
+
+// io.Writerに構造体を書き込む
+type Encoder struct {
+	w io.Writer
+	// タグで指定しなかったフィールドのバイトオーダー(既定はビッグエンディアン)
+	ByteOrder binary.ByteOrder
+	// ビットフィールドの書きかけのビット
+	bits  uint64
+	nbits int
+}
+
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w, ByteOrder: binary.BigEndian}
+}
+
+// vは構造体か構造体へのポインタ
+func (e *Encoder) Encode(v interface{}) error {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("bincodec: cannot encode %T", v)
+	}
+	return e.encodeStruct(rv, e.ByteOrder)
+}
+
+func (e *Encoder) encodeStruct(v reflect.Value, order binary.ByteOrder) error {
+	fields, err := layoutOf(v.Type())
+	if err != nil {
+		return err
+	}
+	for _, f := range fields {
+		if err := e.encodeField(v, f, order); err != nil {
+			var fieldError *FieldError
+			if errors.As(err, &fieldError) {
+				return err
+			}
+			return &FieldError{Struct: v.Type().Name(), Field: f.name, Err: err}
+		}
+	}
+	if e.nbits != 0 {
+		return &FieldError{Struct: v.Type().Name(), Field: fields[len(fields)-1].name, Err: ErrBitAlignment}
+	}
+	return nil
+}
+
+func (e *Encoder) encodeField(v reflect.Value, f *field, order binary.ByteOrder) error {
+	if f.cond != nil {
+		ok, err := f.cond.eval(v)
+		if err != nil || !ok {
+			return err
+		}
+	}
+	fv := v.Field(f.index)
+	if f.bits > 0 {
+		x, _ := uintValue(fv)
+		if x>>uint(f.bits) != 0 {
+			return fmt.Errorf("value %d does not fit in %d bits", x, f.bits)
+		}
+		return e.writeBits(x, f.bits)
+	}
+	if e.nbits != 0 {
+		return ErrBitAlignment
+	}
+	if f.order != nil {
+		order = f.order
+	}
+	switch {
+	case f.size > 0:
+		var data []byte
+		if fv.Kind() == reflect.String {
+			data = []byte(fv.String())
+		} else {
+			data = fv.Bytes()
+		}
+		if len(data) > f.size {
+			return fmt.Errorf("%d bytes do not fit in size %d", len(data), f.size)
+		}
+		padded := make([]byte, f.size)
+		copy(padded, data)
+		return e.write(padded)
+	case f.prefix > 0:
+		// 書ける長さを超えると上位のビットが落ち、読み直すと短いデータになってしまう
+		if f.prefix < 8 && uint64(fv.Len())>>uint(8*f.prefix) != 0 {
+			return fmt.Errorf("%w: %d elements do not fit in %d-bit length", ErrTooLarge, fv.Len(), 8*f.prefix)
+		}
+		if err := e.writeUint(uint64(fv.Len()), f.prefix, order); err != nil {
+			return err
+		}
+	case f.count >= 0:
+		n, err := uintValue(v.Field(f.count))
+		if err != nil {
+			return err
+		}
+		if n != uint64(fv.Len()) {
+			return fmt.Errorf("%w: %d elements but count is %d", ErrLength, fv.Len(), n)
+		}
+	}
+	return e.encodeValue(fv, order)
+}
+
+func (e *Encoder) encodeValue(v reflect.Value, order binary.ByteOrder) error {
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return e.write([]byte{1})
+		}
+		return e.write([]byte{0})
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return e.writeUint(uint64(v.Int()), int(v.Type().Size()), order)
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return e.writeUint(v.Uint(), int(v.Type().Size()), order)
+	case reflect.Float32:
+		return e.writeUint(uint64(math.Float32bits(float32(v.Float()))), 4, order)
+	case reflect.Float64:
+		return e.writeUint(math.Float64bits(v.Float()), 8, order)
+	case reflect.String:
+		return e.write([]byte(v.String()))
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			if v.Kind() == reflect.Slice {
+				return e.write(v.Bytes())
+			}
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			return e.write(b)
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := e.encodeValue(v.Index(i), order); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Struct:
+		return e.encodeStruct(v, order)
+	}
+	// intやuintは環境によって大きさが変わるので使えない
+	return fmt.Errorf("unsupported type %s", v.Type())
+}
+
+func (e *Encoder) write(b []byte) error {
+	_, err := e.w.Write(b)
+	return err
+}
+
+func (e *Encoder) writeUint(x uint64, size int, order binary.ByteOrder) error {
+	b := make([]byte, 8)
+	switch size {
+	case 1:
+		b[0] = byte(x)
+	case 2:
+		order.PutUint16(b, uint16(x))
+	case 4:
+		order.PutUint32(b, uint32(x))
+	case 8:
+		order.PutUint64(b, x)
+	}
+	return e.write(b[:size])
+}
+
+// 上位ビットから詰めて、1バイト分たまったら書き出す
+func (e *Encoder) writeBits(x uint64, n int) error {
+	for i := n - 1; i >= 0; i-- {
+		e.bits = e.bits<<1 | (x>>uint(i))&1
+		e.nbits++
+		if e.nbits == 8 {
+			if err := e.write([]byte{byte(e.bits)}); err != nil {
+				return err
+			}
+			e.bits, e.nbits = 0, 0
+		}
+	}
+	return nil
+}
+
+// io.Readerから構造体を読み込む
+type Decoder struct {
+	r io.Reader
+	// タグで指定しなかったフィールドのバイトオーダー(既定はビッグエンディアン)
+	ByteOrder binary.ByteOrder
+	// 長さのプレフィックスで指定できる要素数の上限
+	// 壊れたデータで巨大なスライスを確保しないようにする
+	MaxLength int
+	// ビットフィールドの読みかけのバイト
+	bits  byte
+	nbits int
+}
+
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: r, ByteOrder: binary.BigEndian, MaxLength: 1 << 20}
+}
+
+// vは構造体へのポインタ
+// データが途中で終わっていればio.ErrUnexpectedEOF、最初のフィールドの前で終わっていればio.EOFを返す
+func (d *Decoder) Decode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("bincodec: cannot decode into %T", v)
+	}
+	return d.decodeStruct(rv.Elem(), d.ByteOrder)
+}
+
+func (d *Decoder) decodeStruct(v reflect.Value, order binary.ByteOrder) error {
+	fields, err := layoutOf(v.Type())
+	if err != nil {
+		return err
+	}
+	for i, f := range fields {
+		if err := d.decodeField(v, f, order); err != nil {
+			if err == io.EOF && i > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return err
+			}
+			var fieldError *FieldError
+			if errors.As(err, &fieldError) {
+				return err
+			}
+			return &FieldError{Struct: v.Type().Name(), Field: f.name, Err: err}
+		}
+	}
+	if d.nbits != 0 {
+		return &FieldError{Struct: v.Type().Name(), Field: fields[len(fields)-1].name, Err: ErrBitAlignment}
+	}
+	return nil
+}
+
+func (d *Decoder) decodeField(v reflect.Value, f *field, order binary.ByteOrder) error {
+	if f.cond != nil {
+		ok, err := f.cond.eval(v)
+		if err != nil || !ok {
+			return err
+		}
+	}
+	fv := v.Field(f.index)
+	if f.bits > 0 {
+		x, err := d.readBits(f.bits)
+		if err != nil {
+			return err
+		}
+		if fv.Kind() == reflect.Bool {
+			fv.SetBool(x != 0)
+		} else {
+			fv.SetUint(x)
+		}
+		return nil
+	}
+	if d.nbits != 0 {
+		return ErrBitAlignment
+	}
+	if f.order != nil {
+		order = f.order
+	}
+	n := -1
+	switch {
+	case f.size > 0:
+		b := make([]byte, f.size)
+		if err := d.read(b); err != nil {
+			return err
+		}
+		if fv.Kind() == reflect.String {
+			// 固定長の文字列は後ろのNULを取り除く
+			end := len(b)
+			for end > 0 && b[end-1] == 0 {
+				end--
+			}
+			fv.SetString(string(b[:end]))
+		} else {
+			fv.SetBytes(b)
+		}
+		return nil
+	case f.rest:
+		var b []byte
+		buffer := make([]byte, 4096)
+		for {
+			m, err := d.r.Read(buffer)
+			b = append(b, buffer[:m]...)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+		}
+		fv.SetBytes(b)
+		return nil
+	case f.prefix > 0:
+		x, err := d.readUint(f.prefix, order)
+		if err != nil {
+			return err
+		}
+		if x > uint64(d.MaxLength) {
+			return fmt.Errorf("%w: %d elements", ErrTooLarge, x)
+		}
+		n = int(x)
+	case f.count >= 0:
+		x, err := uintValue(v.Field(f.count))
+		if err != nil {
+			return err
+		}
+		if x > uint64(d.MaxLength) {
+			return fmt.Errorf("%w: %d elements", ErrTooLarge, x)
+		}
+		n = int(x)
+	}
+	return d.decodeValue(fv, n, order)
+}
+
+// nはスライスと文字列の要素数
+func (d *Decoder) decodeValue(v reflect.Value, n int, order binary.ByteOrder) error {
+	switch v.Kind() {
+	case reflect.Bool:
+		x, err := d.readUint(1, order)
+		v.SetBool(x != 0)
+		return err
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		size := int(v.Type().Size())
+		x, err := d.readUint(size, order)
+		// 符号を拡張する
+		shift := uint(64 - size*8)
+		v.SetInt(int64(x<<shift) >> shift)
+		return err
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		x, err := d.readUint(int(v.Type().Size()), order)
+		v.SetUint(x)
+		return err
+	case reflect.Float32:
+		x, err := d.readUint(4, order)
+		v.SetFloat(float64(math.Float32frombits(uint32(x))))
+		return err
+	case reflect.Float64:
+		x, err := d.readUint(8, order)
+		v.SetFloat(math.Float64frombits(x))
+		return err
+	case reflect.String:
+		b := make([]byte, n)
+		if err := d.read(b); err != nil {
+			return err
+		}
+		v.SetString(string(b))
+		return nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, n)
+			if err := d.read(b); err != nil {
+				return err
+			}
+			v.SetBytes(b)
+			return nil
+		}
+		v.Set(reflect.MakeSlice(v.Type(), n, n))
+		fallthrough
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := d.decodeValue(v.Index(i), -1, order); err != nil {
+				if err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				return err
+			}
+		}
+		return nil
+	case reflect.Struct:
+		return d.decodeStruct(v, order)
+	}
+	return fmt.Errorf("unsupported type %s", v.Type())
+}
+
+// 1バイトも読めなければio.EOF、途中までならio.ErrUnexpectedEOF
+func (d *Decoder) read(b []byte) error {
+	_, err := io.ReadFull(d.r, b)
+	return err
+}
+
+func (d *Decoder) readUint(size int, order binary.ByteOrder) (uint64, error) {
+	b := make([]byte, size)
+	if err := d.read(b); err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return uint64(b[0]), nil
+	case 2:
+		return uint64(order.Uint16(b)), nil
+	case 4:
+		return uint64(order.Uint32(b)), nil
+	}
+	return order.Uint64(b), nil
+}
+
+func (d *Decoder) readBits(n int) (uint64, error) {
+	var x uint64
+	for i := 0; i < n; i++ {
+		if d.nbits == 0 {
+			b := make([]byte, 1)
+			if err := d.read(b); err != nil {
+				return 0, err
+			}
+			d.bits, d.nbits = b[0], 8
+		}
+		d.nbits--
+		x = x<<1 | uint64(d.bits>>uint(d.nbits))&1
+	}
+	return x, nil
+}
@@ -0,0 +1,216 @@
+package bincodec
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 構造体のフィールド1つ分の読み書きの方法
+type field struct {
+	index int
+	name  string
+	// nilなら親(構造体やEncoder、Decoder)のバイトオーダー
+	order binary.ByteOrder
+	// 固定長の文字列、[]byteのバイト数
+	size int
+	// 長さのプレフィックスのバイト数(1、2、4、8)
+	prefix int
+	// 要素数を持つフィールドの番号(-1ならなし)
+	count int
+	// 残りのデータを全て読む([]byteのみ)
+	rest bool
+	// ビットフィールドのビット数
+	bits int
+	cond *condition
+}
+
+// if=Flags&0x01のような、前のフィールドの値による条件
+type condition struct {
+	index int
+	// "", "==", "!=", "&"
+	op    string
+	value uint64
+}
+
+func (c *condition) eval(v reflect.Value) (bool, error) {
+	x, err := uintValue(v.Field(c.index))
+	if err != nil {
+		return false, err
+	}
+	switch c.op {
+	case "==":
+		return x == c.value, nil
+	case "!=":
+		return x != c.value, nil
+	case "&":
+		return x&c.value != 0, nil
+	}
+	return x != 0, nil
+}
+
+func uintValue(v reflect.Value) (uint64, error) {
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return 1, nil
+		}
+		return 0, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return uint64(v.Int()), nil
+	}
+	return 0, fmt.Errorf("bincodec: %s is not an integer", v.Type())
+}
+
+var layouts sync.Map
+
+// 構造体の型ごとにタグを解析した結果をキャッシュする
+func layoutOf(t reflect.Type) ([]*field, error) {
+	if cached, ok := layouts.Load(t); ok {
+		return cached.([]*field), nil
+	}
+	var fields []*field
+	names := make(map[string]int)
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("bin")
+		if tag == "-" || sf.PkgPath != "" {
+			continue
+		}
+		f := &field{index: i, name: sf.Name, count: -1}
+		if err := f.parse(tag, sf.Type, names); err != nil {
+			return nil, fmt.Errorf("bincodec: %s.%s: %v", t.Name(), sf.Name, err)
+		}
+		names[sf.Name] = i
+		fields = append(fields, f)
+	}
+	layouts.Store(t, fields)
+	return fields, nil
+}
+
+// タグはカンマ区切り
+//   - be、le: バイトオーダー
+//   - size=N: 固定長の文字列や[]byte(短ければNULで埋める)
+//   - len=uint8|uint16|uint32|uint64: 要素数のプレフィックスを付けたスライスや文字列
+//   - count=Field: 要素数を前のフィールドから取る
+//   - rest: 残りのデータ全て([]byte)
+//   - bits=N: ビットフィールド(上位ビットから詰める)
+//   - if=Field、if=Field==N、if=Field!=N、if=Field&N: 前のフィールドの値がこの条件を満たすときだけ読み書きする
+func (f *field) parse(tag string, t reflect.Type, names map[string]int) error {
+	for _, option := range strings.Split(tag, ",") {
+		option = strings.TrimSpace(option)
+		key, value := option, ""
+		if i := strings.IndexByte(option, '='); i >= 0 && !strings.HasPrefix(option, "if=") {
+			key, value = option[:i], option[i+1:]
+		} else if strings.HasPrefix(option, "if=") {
+			key, value = "if", option[3:]
+		}
+		var err error
+		switch key {
+		case "":
+		case "be":
+			f.order = binary.BigEndian
+		case "le":
+			f.order = binary.LittleEndian
+		case "size":
+			f.size, err = strconv.Atoi(value)
+			if err == nil && f.size <= 0 {
+				err = fmt.Errorf("invalid size %q", value)
+			}
+		case "len":
+			sizes := map[string]int{"uint8": 1, "uint16": 2, "uint32": 4, "uint64": 8}
+			var ok bool
+			if f.prefix, ok = sizes[value]; !ok {
+				err = fmt.Errorf("invalid length prefix %q", value)
+			}
+		case "count":
+			var ok bool
+			if f.count, ok = names[value]; !ok {
+				err = fmt.Errorf("count field %q must be declared before this field", value)
+			}
+		case "rest":
+			f.rest = true
+		case "bits":
+			f.bits, err = strconv.Atoi(value)
+			if err == nil && (f.bits <= 0 || f.bits > 64) {
+				err = fmt.Errorf("invalid bit count %q", value)
+			}
+		case "if":
+			f.cond, err = parseCondition(value, names)
+		default:
+			err = fmt.Errorf("unknown tag option %q", option)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	kind := t.Kind()
+	variable := kind == reflect.Slice || kind == reflect.String
+	n := 0
+	for _, set := range []bool{f.size > 0, f.prefix > 0, f.count >= 0, f.rest} {
+		if set {
+			n++
+		}
+	}
+	switch {
+	case n > 1:
+		return fmt.Errorf("size, len, count and rest are exclusive")
+	case variable && n == 0:
+		return fmt.Errorf("%s needs size, len, count or rest", t)
+	case !variable && n > 0:
+		return fmt.Errorf("size, len, count and rest apply only to slices and strings")
+	case f.size > 0 && !(kind == reflect.String || t.Elem().Kind() == reflect.Uint8):
+		return fmt.Errorf("size applies only to strings and []byte")
+	case f.rest && !(kind == reflect.Slice && t.Elem().Kind() == reflect.Uint8):
+		return fmt.Errorf("rest applies only to []byte")
+	case f.bits > 0 && !(kind >= reflect.Uint && kind <= reflect.Uint64 || kind == reflect.Bool):
+		return fmt.Errorf("bits applies only to unsigned integers and bool")
+	case f.bits > 0 && kind == reflect.Bool && f.bits != 1:
+		return fmt.Errorf("bool bitfield must be 1 bit")
+	case f.bits > 0 && kind != reflect.Bool && f.bits > t.Bits():
+		return fmt.Errorf("%d bits do not fit in %s", f.bits, t)
+	}
+	if kind == reflect.Slice || kind == reflect.Array {
+		return checkElem(t.Elem())
+	}
+	return nil
+}
+
+// スライスや配列の要素には長さのタグを付けられないので、文字列やスライスは使えない
+// 要素ごとに長さが必要なら、タグを付けたフィールドを持つ構造体のスライスにする
+func checkElem(t reflect.Type) error {
+	switch t.Kind() {
+	case reflect.String, reflect.Slice:
+		return fmt.Errorf("elements of type %s need their own length; use a slice of structs with a len tag", t)
+	case reflect.Array:
+		return checkElem(t.Elem())
+	}
+	return nil
+}
+
+func parseCondition(s string, names map[string]int) (*condition, error) {
+	c := &condition{}
+	name := s
+	for _, op := range []string{"==", "!=", "&"} {
+		if i := strings.Index(s, op); i >= 0 {
+			name, c.op = s[:i], op
+			value, err := strconv.ParseUint(s[i+len(op):], 0, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid condition %q", s)
+			}
+			c.value = value
+			break
+		}
+	}
+	var ok bool
+	if c.index, ok = names[name]; !ok {
+		return nil, fmt.Errorf("condition field %q must be declared before this field", name)
+	}
+	return c, nil
+}
@@ -0,0 +1,145 @@
+// charsetパッケージはShift_JIS、EUC-JP、ISO-2022-JP、UTF-16のテキストをUTF-8に変換しながら読み書きする
+// Goの文字列はUTF-8が前提なので、read.goの郵便番号CSV(Shift_JIS)やメール(ISO-2022-JP)のような
+// 他の文字コードのデータは、io.Readerとio.Writerの間に変換を挟んで扱う
+//
+//	reader, err := charset.NewReader(file, "shift_jis")
+//	reader, name, err := charset.Sniff(file)
+package charset
+
+import (
+	"errors"
+	"io"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// 正規化した文字コードの名前
+const (
+	UTF8      = "utf-8"
+	UTF16     = "utf-16"
+	UTF16BE   = "utf-16be"
+	UTF16LE   = "utf-16le"
+	ShiftJIS  = "shift_jis"
+	EUCJP     = "euc-jp"
+	ISO2022JP = "iso-2022-jp"
+)
+
+var ErrUnknown = errors.New("charset: unknown encoding")
+
+// 別名から正規化した名前への対応(大文字と小文字は区別しない)
+var aliases = map[string]string{
+	"utf-8":          UTF8,
+	"utf8":           UTF8,
+	"us-ascii":       UTF8,
+	"ascii":          UTF8,
+	"utf-16":         UTF16,
+	"utf16":          UTF16,
+	"utf-16be":       UTF16BE,
+	"utf-16le":       UTF16LE,
+	"shift_jis":      ShiftJIS,
+	"shift-jis":      ShiftJIS,
+	"sjis":           ShiftJIS,
+	"x-sjis":         ShiftJIS,
+	"ms_kanji":       ShiftJIS,
+	"windows-31j":    ShiftJIS,
+	"cp932":          ShiftJIS,
+	"euc-jp":         EUCJP,
+	"eucjp":          EUCJP,
+	"x-euc-jp":       EUCJP,
+	"iso-2022-jp":    ISO2022JP,
+	"csiso2022jp":    ISO2022JP,
+	"jis":            ISO2022JP,
+	"iso-2022-jp-ms": ISO2022JP,
+}
+
+// 名前を正規化する。知らない名前ならErrUnknownを返す
+func Normalize(name string) (string, error) {
+	if normalized, ok := aliases[strings.ToLower(strings.TrimSpace(name))]; ok {
+		return normalized, nil
+	}
+	return "", ErrUnknown
+}
+
+// 名前に対応するx/textのEncodingを返す
+// Shift_JISはWindowsの機種依存文字(①や㈱など)を含むCP932として扱う
+// UTF-16はBOMがあればそれに従い、なければビッグエンディアンとして読む。書き出すときはBOMを付ける
+// UTF-8のBOMはNewReader()では取り除き、NewWriter()では付けない
+func Lookup(name string) (encoding.Encoding, error) {
+	normalized, err := Normalize(name)
+	if err != nil {
+		return nil, err
+	}
+	switch normalized {
+	case UTF16:
+		return unicode.UTF16(unicode.BigEndian, unicode.UseBOM), nil
+	case UTF16BE:
+		return unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM), nil
+	case UTF16LE:
+		return unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM), nil
+	case ShiftJIS:
+		return japanese.ShiftJIS, nil
+	case EUCJP:
+		return japanese.EUCJP, nil
+	case ISO2022JP:
+		return japanese.ISO2022JP, nil
+	}
+	return unicode.UTF8, nil
+}
+
+// UTF-8への変換。UTF-8ならBOMがあれば取り除く
+func newDecoder(name string) (*encoding.Decoder, error) {
+	normalized, err := Normalize(name)
+	if err != nil {
+		return nil, err
+	}
+	if normalized == UTF8 {
+		return unicode.UTF8BOM.NewDecoder(), nil
+	}
+	e, err := Lookup(normalized)
+	if err != nil {
+		return nil, err
+	}
+	return e.NewDecoder(), nil
+}
+
+// nameの文字コードのデータをUTF-8に変換しながら読むio.Reader
+// 変換できないバイト列はU+FFFDに置き換わる
+func NewReader(r io.Reader, name string) (io.Reader, error) {
+	decoder, err := newDecoder(name)
+	if err != nil {
+		return nil, err
+	}
+	return transform.NewReader(r, decoder), nil
+}
+
+// UTF-8の文字列をnameの文字コードに変換して書き出すio.WriteCloser
+// ISO-2022-JPの最後のエスケープシーケンスなどはClose()で書き出されるので、必ず呼ぶ(wは閉じない)
+// 変換先にない文字があるとエラーになる
+func NewWriter(w io.Writer, name string) (io.WriteCloser, error) {
+	e, err := Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	return transform.NewWriter(w, e.NewEncoder()), nil
+}
+
+// 文字列を変換する
+func DecodeString(s, name string) (string, error) {
+	decoder, err := newDecoder(name)
+	if err != nil {
+		return "", err
+	}
+	return decoder.String(s)
+}
+
+func EncodeString(s, name string) (string, error) {
+	e, err := Lookup(name)
+	if err != nil {
+		return "", err
+	}
+	return e.NewEncoder().String(s)
+}
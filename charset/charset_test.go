@@ -0,0 +1,244 @@
+package charset
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const text = "その中山から、少し離れた山の中に、「ごんぎつね」という狐がいました。ﾄｳｷｮｳﾄ ①"
+
+func encode(t *testing.T, s, name string) []byte {
+	var buffer bytes.Buffer
+	w, err := NewWriter(&buffer, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, name := range []string{"Shift_JIS", "cp932", "EUC-JP", "ISO-2022-JP", "UTF-16", "utf-16le", "utf-16be", "UTF-8"} {
+		s := text
+		if normalized, _ := Normalize(name); normalized == EUCJP || normalized == ISO2022JP {
+			// ①はCP932の機種依存文字で、EUC-JPとISO-2022-JPにはない
+			s = strings.TrimSuffix(s, " ①")
+		}
+		b := encode(t, s, name)
+		if name != "UTF-8" && bytes.Equal(b, []byte(s)) {
+			t.Errorf("%s: not encoded", name)
+		}
+		reader, err := NewReader(bytes.NewReader(b), name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != s {
+			t.Errorf("%s: got %q", name, got)
+		}
+	}
+	if _, err := NewReader(nil, "koi8-r"); err != ErrUnknown {
+		t.Errorf("got %v, want ErrUnknown", err)
+	}
+}
+
+func TestBOM(t *testing.T) {
+	tests := []struct {
+		b    []byte
+		name string
+	}{
+		{[]byte("\xef\xbb\xbfabc"), UTF8},
+		{[]byte("\xfe\xff\x00a\x00b\x00c"), UTF16},
+		{[]byte("\xff\xfea\x00b\x00c\x00"), UTF16},
+	}
+	for _, tt := range tests {
+		reader, name, err := Sniff(bytes.NewReader(tt.b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := ioutil.ReadAll(reader)
+		if name != tt.name || string(got) != "abc" {
+			t.Errorf("% x: got %s %q", tt.b, name, got)
+		}
+	}
+	if b := encode(t, "a", UTF16); !bytes.Equal(b, []byte("\xfe\xff\x00a")) {
+		t.Errorf("UTF-16 without BOM: % x", b)
+	}
+	if b := encode(t, "a", UTF8); !bytes.Equal(b, []byte("a")) {
+		t.Errorf("UTF-8 with BOM: % x", b)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		s    string
+		name string
+	}{
+		{text, ShiftJIS},
+		{strings.TrimSuffix(text, " ①"), EUCJP},
+		{strings.TrimSuffix(text, " ①"), ISO2022JP},
+		{text, UTF8},
+		{"Hello, Gopher", UTF16LE},
+		{"Hello, Gopher", UTF16BE},
+		// 半角カナだけのShift_JISはEUC-JPとしても正しいバイト列になる
+		{"ﾄｳｷｮｳﾄ,ﾁﾖﾀﾞｸ,ﾋﾄﾂﾊﾞｼ", ShiftJIS},
+		{"ひらがなだけ", EUCJP},
+		{"ひらがなだけ", ShiftJIS},
+	}
+	for _, tt := range tests {
+		b := encode(t, tt.s, tt.name)
+		if got := Detect(b); got != tt.name {
+			t.Errorf("%s in %s: detected %s", tt.s, tt.name, got)
+		}
+		// 途中で切れていても判断できる
+		if got := Detect(b[:len(b)-1]); tt.name != UTF16LE && tt.name != UTF16BE && got != tt.name {
+			t.Errorf("%s in %s (truncated): detected %s", tt.s, tt.name, got)
+		}
+	}
+}
+
+func TestTransport(t *testing.T) {
+	sjis := encode(t, text, ShiftJIS)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/charset":
+			w.Header().Set("Content-Type", "text/plain; charset=Shift_JIS")
+			_, _ = w.Write(sjis)
+		case "/sniff":
+			w.Header().Set("Content-Type", "text/csv")
+			_, _ = w.Write(sjis)
+		case "/binary":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			_, _ = w.Write(sjis)
+		case "/utf8":
+			w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+			_, _ = io.WriteString(w, text)
+		}
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: &Transport{}}
+	for _, path := range []string{"/charset", "/sniff", "/binary", "/utf8"} {
+		response, err := client.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(response.Body)
+		_ = response.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, contentType := text, "text/plain; charset=utf-8"
+		switch path {
+		case "/sniff":
+			contentType = "text/csv; charset=utf-8"
+		case "/binary":
+			want, contentType = string(sjis), "application/octet-stream"
+		case "/utf8":
+			// もともとUTF-8なら書き換えず、Content-Lengthも残す
+			contentType = "text/plain; charset=UTF-8"
+			if response.ContentLength != int64(len(text)) {
+				t.Errorf("%s: got Content-Length %d", path, response.ContentLength)
+			}
+		}
+		if string(body) != want {
+			t.Errorf("%s: got %q", path, body)
+		}
+		if got := response.Header.Get("Content-Type"); got != contentType {
+			t.Errorf("%s: got Content-Type %q, want %q", path, got, contentType)
+		}
+	}
+}
+
+// charsetのないストリームでも、最初のデータが届いた時点で読める
+func TestTransportStream(t *testing.T) {
+	first := encode(t, "ごんぎつね\n", EUCJP)
+	release := make(chan struct{})
+	ascii := strings.Repeat("a", 99) + "\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		if r.URL.Path == "/ascii" {
+			// ASCIIだけが先に届いても、あとから届くShift_JISを正しく変換する
+			_, _ = io.WriteString(w, ascii)
+			w.(http.Flusher).Flush()
+			time.Sleep(100 * time.Millisecond)
+			_, _ = w.Write(encode(t, "こんにちは", ShiftJIS))
+			return
+		}
+		_, _ = w.Write(first)
+		w.(http.Flusher).Flush()
+		<-release
+		_, _ = w.Write(encode(t, "おしまい\n", EUCJP))
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := &http.Client{Transport: &Transport{}, Timeout: 5 * time.Second}
+	response, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	line, err := bufio.NewReader(response.Body).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "ごんぎつね\n" {
+		t.Errorf("got %q", line)
+	}
+	if got := response.Header.Get("Content-Type"); got != "text/event-stream; charset=utf-8" {
+		t.Errorf("got Content-Type %q", got)
+	}
+
+	response, err = client.Get(server.URL + "/ascii")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	reader := bufio.NewReader(response.Body)
+	line, err = reader.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != ascii {
+		t.Errorf("got %q", line)
+	}
+	// ASCIIしか読んでいない間は、文字コードが分からないので書き換えない
+	if got := response.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("got Content-Type %q before sniffing", got)
+	}
+	rest, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(rest) != "こんにちは" {
+		t.Errorf("got %q", rest)
+	}
+	if got := response.Header.Get("Content-Type"); got != "text/event-stream; charset=utf-8" {
+		t.Errorf("got Content-Type %q", got)
+	}
+}
+
+func ExampleDetect() {
+	b, _ := EncodeString("ごんぎつね", EUCJP)
+	name := Detect([]byte(b))
+	s, _ := DecodeString(b, name)
+	fmt.Println(name, s)
+	// Output: euc-jp ごんぎつね
+}
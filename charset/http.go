@@ -0,0 +1,111 @@
+package charset
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Content-Typeのcharsetパラメーター(なければ空文字列)
+func FromContentType(contentType string) string {
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return params["charset"]
+}
+
+// 文字コードを変換してよいテキストの形式か
+func isText(mediaType string) bool {
+	return strings.HasPrefix(mediaType, "text/") ||
+		strings.HasSuffix(mediaType, "+xml") ||
+		mediaType == "application/xml" ||
+		mediaType == "application/javascript"
+}
+
+// HTTPのレスポンスのボディをUTF-8に変換しながら読むio.Readerと、元の文字コードの名前を返す
+// Content-Typeのcharsetに従い、charsetのないテキストは*SniffReaderで読みながら推測する
+// その場合は名前は空文字列で、推測した名前はASCII以外のバイトを読んでから(*SniffReader).Name()で分かる
+// テキストでないボディや知らない文字コードは変換せずにresponse.Bodyをそのまま返す(名前は空文字列)
+func NewResponseReader(response *http.Response) (io.Reader, string, error) {
+	mediaType, params, err := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	if err != nil {
+		return response.Body, "", nil
+	}
+	if name, err := Normalize(params["charset"]); err == nil {
+		reader, err := NewReader(response.Body, name)
+		return reader, name, err
+	}
+	if params["charset"] != "" || !isText(mediaType) {
+		return response.Body, "", nil
+	}
+	// Sniff()で先に読むと、ストリームではデータが貯まるまでここで止まってしまう
+	return NewSniffReader(response.Body), "", nil
+}
+
+// ボディをUTF-8に変換するhttp.RoundTripper
+// http.Client{Transport: &charset.Transport{}}のように使うと、どのサーバーからのテキストもUTF-8で読める
+// 変換したレスポンスはContent-Typeのcharsetをutf-8に書き換え、Content-Lengthを取り除く
+// 文字コードを推測するレスポンスでは、ボディを読んで推測が終わるまでContent-Typeを書き換えない
+// そのためボディを読んでいる間は、別のgoroutineからヘッダーを読まないようにする
+// もともとcharset=utf-8のレスポンスは何も変えずに返す
+type Transport struct {
+	// nilならhttp.DefaultTransport
+	Base http.RoundTripper
+}
+
+func (t *Transport) RoundTrip(request *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	response, err := base.RoundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+	reader, name, err := NewResponseReader(response)
+	if err != nil {
+		_ = response.Body.Close()
+		return nil, err
+	}
+	sniffer, sniffing := reader.(*SniffReader)
+	if name == UTF8 || name == "" && !sniffing {
+		return response, nil
+	}
+	response.Header.Del("Content-Length")
+	response.ContentLength = -1
+	if sniffing {
+		response.Body = &sniffBody{SniffReader: sniffer, Closer: response.Body, header: response.Header}
+		return response, nil
+	}
+	setUTF8(response.Header)
+	response.Body = struct {
+		io.Reader
+		io.Closer
+	}{reader, response.Body}
+	return response, nil
+}
+
+func setUTF8(header http.Header) {
+	mediaType, params, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	params["charset"] = UTF8
+	header.Set("Content-Type", mime.FormatMediaType(mediaType, params))
+}
+
+// 推測が終わったときにContent-Typeを書き換えるボディ
+type sniffBody struct {
+	*SniffReader
+	io.Closer
+	header http.Header
+	done   bool
+}
+
+func (b *sniffBody) Read(p []byte) (int, error) {
+	n, err := b.SniffReader.Read(p)
+	if !b.done && b.Name() != "" {
+		b.done = true
+		setUTF8(b.header)
+	}
+	return n, err
+}
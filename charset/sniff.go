@@ -0,0 +1,271 @@
+package charset
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"unicode/utf8"
+)
+
+// Sniff()が推測に使う先頭のバイト数
+const sniffLen = 4096
+
+// 先頭のデータから文字コードを推測し、正規化した名前を返す
+//  1. BOMがあればそれに従う
+//  2. ISO-2022-JPのエスケープシーケンスがあればISO-2022-JP
+//  3. UTF-8として正しければUTF-8(ASCIIだけの場合も含む)
+//  4. Shift_JISとEUC-JPのうち、正しいバイト列になっている方。両方正しければ、全角のひらがなとカタカナが多い方
+//     Shift_JISの半角カナだけのテキストはEUC-JPとしても正しいことが多いが、EUC-JPのかなにはならない
+//
+// bは途中で切れていてもよい(最後の文字が欠けていても無視する)
+func Detect(b []byte) string {
+	switch {
+	case bytes.HasPrefix(b, []byte{0xef, 0xbb, 0xbf}):
+		return UTF8
+	case bytes.HasPrefix(b, []byte{0xfe, 0xff}), bytes.HasPrefix(b, []byte{0xff, 0xfe}):
+		// BOMを見てエンディアンを決める
+		return UTF16
+	}
+	if name := detectUTF16(b); name != "" {
+		return name
+	}
+	for _, escape := range []string{"\x1b$B", "\x1b$@", "\x1b(J", "\x1b(I"} {
+		if bytes.Contains(b, []byte(escape)) {
+			return ISO2022JP
+		}
+	}
+	if validUTF8(b) {
+		return UTF8
+	}
+	sjisErrors, sjisScore := scanShiftJIS(b)
+	eucErrors, eucScore := scanEUCJP(b)
+	switch {
+	case eucErrors < sjisErrors:
+		return EUCJP
+	case eucErrors == sjisErrors && eucScore > sjisScore:
+		return EUCJP
+	}
+	return ShiftJIS
+}
+
+// BOMのないUTF-16は、ASCIIの文字の上位バイトの0が偶数番目と奇数番目のどちらにあるかで判断する
+// 日本語だけのテキストでは判断できないので、0が半分近くを占める場合だけにする
+func detectUTF16(b []byte) string {
+	if len(b) < 4 {
+		return ""
+	}
+	var even, odd int
+	for i := 0; i+1 < len(b); i += 2 {
+		if b[i] == 0 {
+			even++
+		}
+		if b[i+1] == 0 {
+			odd++
+		}
+	}
+	pairs := len(b) / 2
+	switch {
+	case even*2 >= pairs && odd == 0:
+		return UTF16BE
+	case odd*2 >= pairs && even == 0:
+		return UTF16LE
+	}
+	return ""
+}
+
+func validUTF8(b []byte) bool {
+	// 途中で切れた最後の文字を除く
+	for i := len(b) - 1; i >= 0 && i >= len(b)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(b[i]) {
+			if !utf8.FullRune(b[i:]) {
+				b = b[:i]
+			}
+			break
+		}
+	}
+	return utf8.Valid(b)
+}
+
+// 不正なバイトの数と、全角のひらがなとカタカナの数を返す
+func scanShiftJIS(b []byte) (errors, score int) {
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		switch {
+		case c < 0x80:
+		case c >= 0xa1 && c <= 0xdf:
+			// 半角カナはEUC-JPの2バイト文字の一部であることも多いので数えない
+		case c >= 0x81 && c <= 0x9f || c >= 0xe0 && c <= 0xfc:
+			if i+1 == len(b) {
+				return
+			}
+			t := b[i+1]
+			if t < 0x40 || t == 0x7f || t > 0xfc {
+				errors++
+				continue
+			}
+			i++
+			// 0x829f-0x82f1がひらがな、0x8340-0x8396がカタカナ
+			if c == 0x82 && t >= 0x9f && t <= 0xf1 || c == 0x83 && t <= 0x96 {
+				score++
+			}
+		default:
+			errors++
+		}
+	}
+	return
+}
+
+func scanEUCJP(b []byte) (errors, score int) {
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		switch {
+		case c < 0x80:
+		case c == 0x8e:
+			// 半角カナ
+			if i+1 == len(b) {
+				return
+			}
+			if t := b[i+1]; t < 0xa1 || t > 0xdf {
+				errors++
+				continue
+			}
+			i++
+			score++
+		case c == 0x8f:
+			// JIS X 0212の補助漢字
+			if i+2 >= len(b) {
+				return
+			}
+			if !eucByte(b[i+1]) || !eucByte(b[i+2]) {
+				errors++
+				continue
+			}
+			i += 2
+		case eucByte(c):
+			if i+1 == len(b) {
+				return
+			}
+			if !eucByte(b[i+1]) {
+				errors++
+				continue
+			}
+			i++
+			// 0xa4xxがひらがな、0xa5xxがカタカナ
+			if c == 0xa4 || c == 0xa5 {
+				score++
+			}
+		default:
+			errors++
+		}
+	}
+	return
+}
+
+func eucByte(c byte) bool {
+	return c >= 0xa1 && c <= 0xfe
+}
+
+// 先頭を読んで文字コードを推測し、UTF-8に変換しながら読むio.Readerと推測した名前を返す
+// 先頭のsniffLenバイトを読むかEOFになるまで返らないので、少しずつ届くストリームにはNewSniffReader()を使う
+func Sniff(r io.Reader) (io.Reader, string, error) {
+	br := bufio.NewReaderSize(r, sniffLen)
+	b, err := br.Peek(sniffLen)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, "", err
+	}
+	name := Detect(b)
+	reader, err := NewReader(br, name)
+	return reader, name, err
+}
+
+// 届いたデータから文字コードを推測し、UTF-8に変換して読むio.Reader
+// 作るときには読み込まないので、text/event-streamやチャンク形式で少しずつ届くHTTPのボディでも待たされない
+// ASCIIはどの文字コードでも同じなので、ASCIIだけが届いている間はそのまま返し、
+// 最初にASCII以外のバイトが届いたときに、そこから届いているデータ(最大sniffLenバイト)で推測する
+// その時点で届いているデータが短いと、Sniff()より推測を誤りやすい
+type SniffReader struct {
+	r      io.Reader
+	reader io.Reader
+	name   string
+	buffer []byte
+	// 読み込んだがまだ返していないデータと、そのときのエラー
+	pending []byte
+	err     error
+}
+
+func NewSniffReader(r io.Reader) *SniffReader {
+	return &SniffReader{r: r}
+}
+
+// 推測した文字コードの名前
+// ASCII以外のバイトが届くまでは空文字列で、ASCIIだけで終わった場合はUTF-8
+func (s *SniffReader) Name() string {
+	return s.name
+}
+
+func (s *SniffReader) Read(p []byte) (int, error) {
+	if s.reader != nil {
+		return s.reader.Read(p)
+	}
+	if s.buffer == nil {
+		s.buffer = make([]byte, sniffLen)
+	}
+	for len(s.pending) == 0 {
+		if s.err != nil {
+			if s.err == io.EOF {
+				s.name = UTF8
+			}
+			return 0, s.err
+		}
+		// 1回のRead()で返ってくる分だけを使い、それ以上は待たない
+		n, err := s.r.Read(s.buffer)
+		s.pending, s.err = s.buffer[:n], err
+	}
+	i := 0
+	for i < len(s.pending) && plainASCII(s.pending[i]) {
+		i++
+	}
+	if i > 0 {
+		n := copy(p, s.pending[:i])
+		s.pending = s.pending[n:]
+		return n, nil
+	}
+	if err := s.sniff(); err != nil {
+		return 0, err
+	}
+	return s.reader.Read(p)
+}
+
+// ISO-2022-JPのエスケープシーケンスとUTF-16の0は推測に使うので、そのまま返さない
+func plainASCII(c byte) bool {
+	return c < 0x80 && c != 0x1b && c != 0
+}
+
+// ASCII以外のバイトから始まるpendingで推測し、残りを続けて変換するio.Readerを作る
+func (s *SniffReader) sniff() error {
+	readers := []io.Reader{bytes.NewReader(s.pending)}
+	switch s.err {
+	case nil:
+		readers = append(readers, s.r)
+	case io.EOF:
+	default:
+		readers = append(readers, &errorReader{s.err})
+	}
+	name := Detect(s.pending)
+	reader, err := NewReader(io.MultiReader(readers...), name)
+	if err != nil {
+		return err
+	}
+	s.name, s.reader = name, reader
+	s.pending, s.err = nil, nil
+	return nil
+}
+
+// 先頭と一緒に読んだエラーを、先頭を返したあとで返す
+type errorReader struct {
+	err error
+}
+
+func (e *errorReader) Read([]byte) (int, error) {
+	return 0, e.err
+}
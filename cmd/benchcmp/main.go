@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"system-programming/benchmark"
+)
+
+// loadgen -jsonで保存した2つの結果を比較し、差が統計的に有意かどうかを表示する
+// 同じ条件で何回か実行して追記しておくと、スループットも検定できる
+// レイテンシのp値は分布全体の検定で、平均とp50/p90/p99の行には同じ値が表示される
+//
+//	for i in 1 2 3 4 5; do go run ./cmd/loadgen -json >> old.json; done
+//	go run ./cmd/benchcmp old.json new.json
+func main() {
+	alpha := flag.Float64("alpha", 0.05, "significance level")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: benchcmp [-alpha 0.05] old.json new.json")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	base, err := readResults(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	head, err := readResults(flag.Arg(1))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	deltas := benchmark.Compare(base, head)
+	if len(deltas) == 0 {
+		fmt.Fprintln(os.Stderr, "benchcmp: no common configurations to compare")
+		os.Exit(1)
+	}
+	if err := benchmark.WriteComparison(os.Stdout, deltas, *alpha); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func readResults(path string) ([]*benchmark.Result, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	return benchmark.ReadResults(file)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"system-programming/internal/atomicfile"
+	"system-programming/kenall"
+)
+
+// 日本郵便の郵便番号データ(KEN_ALL.CSV)から索引ファイルを作り、郵便番号や住所で検索する
+// 索引ファイルはメモリにマップして使うので、検索のたびにCSVを読み直す必要がない
+//
+//	go run ./cmd/kenall build -o ken_all.idx KEN_ALL.CSV
+//	go run ./cmd/kenall zip -index ken_all.idx 100-0003
+//	go run ./cmd/kenall address -index ken_all.idx 東京都千代田区一ツ橋
+//	go run ./cmd/kenall zip -csv KEN_ALL.CSV 1000003
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	var err error
+	switch os.Args[1] {
+	case "build":
+		err = build(os.Args[2:])
+	case "zip", "address":
+		err = search(os.Args[1], os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `usage: kenall build -o ken_all.idx KEN_ALL.CSV
+       kenall zip (-index ken_all.idx | -csv KEN_ALL.CSV) zipcode...
+       kenall address (-index ken_all.idx | -csv KEN_ALL.CSV) prefix...`)
+	os.Exit(2)
+}
+
+func build(args []string) error {
+	flags := flag.NewFlagSet("build", flag.ExitOnError)
+	flags.Usage = usage
+	output := flags.String("o", "", "output index file")
+	_ = flags.Parse(args)
+	if flags.NArg() != 1 || *output == "" {
+		usage()
+	}
+	index, err := load(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(*output, atomicfile.Mode(*output, 0644), func(w io.Writer) error {
+		_, err := index.WriteTo(w)
+		return err
+	})
+}
+
+func search(command string, args []string) error {
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	flags.Usage = usage
+	indexPath := flags.String("index", "", "index file made by kenall build")
+	csvPath := flags.String("csv", "", "KEN_ALL.CSV (Shift_JIS)")
+	_ = flags.Parse(args)
+	if flags.NArg() == 0 || (*indexPath == "") == (*csvPath == "") {
+		usage()
+	}
+	var index interface {
+		Lookup(zip string) []*kenall.Record
+		SearchPrefix(prefix string) []*kenall.Record
+	}
+	if *indexPath != "" {
+		mapped, err := kenall.Open(*indexPath)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = mapped.Close()
+		}()
+		index = mapped
+	} else {
+		loaded, err := load(*csvPath)
+		if err != nil {
+			return err
+		}
+		index = loaded
+	}
+	for _, query := range flags.Args() {
+		var records []*kenall.Record
+		if command == "zip" {
+			records = index.Lookup(query)
+		} else {
+			records = index.SearchPrefix(query)
+		}
+		if len(records) == 0 {
+			fmt.Fprintf(os.Stderr, "%s: not found\n", query)
+		}
+		for _, r := range records {
+			fmt.Printf("%s (%s%s%s)\n", r, r.PrefectureKana, r.CityKana, r.TownKana)
+		}
+	}
+	return nil
+}
+
+func load(path string) (*kenall.Index, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	return kenall.Load(file)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"system-programming/benchmark"
+)
+
+// benchmarkパッケージのサーバー(あるいは同じ応答をするサーバー)に負荷をかけてスループットとレイテンシを表示する
+// -addrを省略すると、ネットワークごとにbenchmarkパッケージのサーバーをプロセス内で起動して順番に計測する
+//
+//	go run ./cmd/loadgen -network tcp,unix,unixgram,unixpacket,udp -c 8 -d 10s -keepalive -pipeline 4
+//	go run ./cmd/loadgen -network unix -addr /tmp/app.sock -c 8 -d 10s
+func main() {
+	var config benchmark.Config
+	networks := flag.String("network", "tcp", "comma separated list of tcp, unix, unixgram, unixpacket and udp")
+	flag.StringVar(&config.Address, "addr", "", "server address or socket path (default: start a built-in server)")
+	flag.IntVar(&config.Concurrency, "c", 1, "number of concurrent connections")
+	flag.DurationVar(&config.Duration, "d", 10*time.Second, "duration of each run")
+	flag.BoolVar(&config.KeepAlive, "keepalive", false, "reuse connections instead of dialing for each pipeline")
+	flag.IntVar(&config.Pipeline, "pipeline", 1, "number of requests sent before reading responses")
+	flag.IntVar(&config.PayloadSize, "payload", 0, "request payload size in bytes")
+	flag.BoolVar(&config.Compression, "gzip", false, "ask the server for gzip compressed responses")
+	flag.DurationVar(&config.Timeout, "timeout", time.Second, "timeout of each round trip")
+	asJSON := flag.Bool("json", false, "print the result as JSON")
+	flag.Parse()
+
+	// Ctrl+Cで途中で止めてもそこまでの結果を表示する
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	go func() {
+		<-signals
+		cancel()
+	}()
+
+	for _, network := range strings.Split(*networks, ",") {
+		config := config
+		config.Network = network
+		if err := run(ctx, config, *asJSON); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+}
+
+func run(ctx context.Context, config benchmark.Config, asJSON bool) error {
+	if config.Address == "" {
+		server, err := benchmark.StartServer(config.Network)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = server.Close()
+		}()
+		<-server.Ready()
+		config.Address = server.Addr().String()
+	}
+	result, err := benchmark.Run(ctx, config)
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		return result.WriteJSON(os.Stdout)
+	}
+	return result.WriteText(os.Stdout)
+}
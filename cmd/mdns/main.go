@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"system-programming/udpcast"
+	"system-programming/udpcast/mdns"
+)
+
+// mDNS/DNS-SDでサービスを告知したり、ネットワーク上のサービスを探したりする
+// -instanceを指定すると告知し、省略すると-serviceのインスタンスを探して追加と削除を表示する
+//
+//	go run ./cmd/mdns -instance "My Web" -service _http._tcp -port 8080 -txt path=/,version=1
+//	go run ./cmd/mdns -service _http._tcp
+func main() {
+	var service mdns.Service
+	flag.StringVar(&service.Instance, "instance", "", "instance name to announce (default: browse)")
+	flag.StringVar(&service.Service, "service", "_http._tcp", "service type")
+	flag.StringVar(&service.Domain, "domain", "local.", "domain")
+	flag.StringVar(&service.Host, "host", "", "host name (default: <hostname>.local.)")
+	port := flag.Uint("port", 80, "port number of the service")
+	text := flag.String("txt", "", "comma separated list of key=value TXT records")
+	iface := flag.String("iface", "", "network interface name (default: chosen by the OS)")
+	flag.Parse()
+	service.Port = uint16(*port)
+	if *text != "" {
+		service.Text = strings.Split(*text, ",")
+	}
+	config := mdns.DefaultConfig()
+	config.Interface = *iface
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	go func() {
+		<-signals
+		cancel()
+	}()
+
+	var err error
+	if service.Instance != "" {
+		err = announce(ctx, config, service)
+	} else {
+		err = browse(ctx, config, service.Service, service.Domain)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func announce(ctx context.Context, config udpcast.GroupConfig, service mdns.Service) error {
+	responder, err := mdns.NewResponder(config)
+	if err != nil {
+		return err
+	}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- responder.Serve()
+	}()
+	if err := responder.Register(service); err != nil {
+		_ = responder.Close()
+		return err
+	}
+	fmt.Printf("Announcing %s.%s.%s port %d\n", service.Instance, service.Service, service.Domain, service.Port)
+	select {
+	case <-ctx.Done():
+		// 終了時にgoodbyeを送る
+		return responder.Close()
+	case err := <-errs:
+		_ = responder.Close()
+		return err
+	}
+}
+
+func browse(ctx context.Context, config udpcast.GroupConfig, service, domain string) error {
+	browser, err := mdns.NewBrowser(config, service, domain)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = browser.Close()
+	}()
+	return browser.Browse(ctx, func(event mdns.Event) {
+		e := event.Entry
+		fmt.Printf("%-7s %s %s:%d %v %q\n", event.Type, e.InstanceName(), e.Host, e.Port, e.IPs, e.Text)
+	})
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"text/tabwriter"
+
+	"system-programming/pngchunk"
+)
+
+// PNGファイルのチャンクを一覧表示する
+// read.goのdumpChunkと違い、主なチャンクのデータを解釈して表示し、オフセットとCRCが正しいかも表示する
+// 壊れたチャンクやCRCの不一致が1つでもあれば終了コード1で終わるので、画像を生成する処理のチェックにも使える
+//
+//	go run ./cmd/pngdump img.png secret.png
+//	go run ./cmd/pngdump -json secret.png | jq '.chunks[] | select(.type == "tEXt")'
+func main() {
+	asJSON := flag.Bool("json", false, "output JSON (one object per file)")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: pngdump [-json] file.png...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	ok := true
+	for _, path := range flag.Args() {
+		report := inspect(path)
+		if !report.Valid {
+			ok = false
+		}
+		var err error
+		if *asJSON {
+			err = json.NewEncoder(os.Stdout).Encode(report)
+		} else {
+			err = report.writeText(os.Stdout)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+type chunkReport struct {
+	Offset     int64         `json:"offset"`
+	Type       pngchunk.Type `json:"type"`
+	Length     uint32        `json:"length"`
+	CRC        string        `json:"crc"`
+	CRCValid   bool          `json:"crc_valid"`
+	Critical   bool          `json:"critical"`
+	Public     bool          `json:"public"`
+	SafeToCopy bool          `json:"safe_to_copy"`
+	Data       interface{}   `json:"data,omitempty"`
+	Error      string        `json:"error,omitempty"`
+}
+
+type fileReport struct {
+	File   string         `json:"file"`
+	Size   int64          `json:"size"`
+	Valid  bool           `json:"valid"`
+	Error  string         `json:"error,omitempty"`
+	Chunks []*chunkReport `json:"chunks"`
+}
+
+func inspect(path string) *fileReport {
+	report := &fileReport{File: path, Valid: true}
+	fail := func(err error) *fileReport {
+		report.Valid = false
+		report.Error = err.Error()
+		return report
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return fail(err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	decoder := pngchunk.NewDecoder(file)
+	for {
+		h, err := decoder.NextHeader()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fail(err)
+		}
+		chunk := &chunkReport{
+			Offset:     h.Offset,
+			Type:       h.Type,
+			Length:     h.Length,
+			Critical:   h.Type.IsCritical(),
+			Public:     h.Type.IsPublic(),
+			SafeToCopy: h.Type.IsSafeToCopy(),
+		}
+		report.Chunks = append(report.Chunks, chunk)
+
+		// 画像のデータ(IDAT)など解釈しないチャンクは、長さを信用してメモリに読み込まずに読み捨てる
+		// どちらの場合もデータの最後まで読むとDecoderがCRCを確かめる
+		var data []byte
+		if !pngchunk.HasPayload(h.Type) {
+			_, err = io.Copy(ioutil.Discard, decoder)
+		} else {
+			data, err = ioutil.ReadAll(decoder)
+		}
+		chunk.CRC = fmt.Sprintf("%08x", decoder.CRC())
+		chunk.CRCValid = err == nil
+		if err != nil && !errors.Is(err, pngchunk.ErrCRC) {
+			// CRC以外のエラーは途中でファイルが終わった場合などで、続きは読めない
+			chunk.Error = err.Error()
+			return fail(err)
+		}
+		if err != nil {
+			report.Valid = false
+			chunk.Error = err.Error()
+			continue
+		}
+		payload, err := pngchunk.ParsePayload(&pngchunk.Chunk{Header: h, Data: data, CRC: decoder.CRC()})
+		if err != nil {
+			report.Valid = false
+			chunk.Error = err.Error()
+			continue
+		}
+		chunk.Data = payload
+	}
+	report.Size = decoder.Offset()
+	return report
+}
+
+func (r *fileReport) writeText(w io.Writer) error {
+	fmt.Fprintf(w, "%s:\n", r.File)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "offset\ttype\tlength\tcrc\t")
+	for _, c := range r.Chunks {
+		status := "ok"
+		if !c.CRCValid {
+			status = "BAD"
+		}
+		detail := ""
+		if c.Data != nil {
+			detail = fmt.Sprint(c.Data)
+		}
+		if c.Error != "" {
+			detail = "error: " + c.Error
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%s %s\t%s\n", c.Offset, c.Type, c.Length, c.CRC, status, detail)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if r.Error != "" {
+		_, err := fmt.Fprintf(w, "error: %s\n", r.Error)
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%d chunks, %d bytes\n", len(r.Chunks), r.Size)
+	return err
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"system-programming/internal/atomicfile"
+	"system-programming/pngchunk"
+	"system-programming/pngchunk/stego"
+)
+
+// PNGファイルの非公開チャンクに任意のファイルを埋め込んだり、取り出したりする
+// パスフレーズはコマンドライン引数に書くとpsなどで見えてしまうので、ファイルか環境変数PNGSTEGO_PASSPHRASEで渡す
+//
+//	go run ./cmd/pngstego embed -z -o hidden.png img.png secret.txt
+//	PNGSTEGO_PASSPHRASE=secret go run ./cmd/pngstego embed -encrypt -o hidden.png img.png secret.txt
+//	PNGSTEGO_PASSPHRASE=secret go run ./cmd/pngstego extract hidden.png > secret.txt
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	var err error
+	switch os.Args[1] {
+	case "embed":
+		err = embed(os.Args[2:])
+	case "extract":
+		err = extract(os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `usage: pngstego embed [-z] [-encrypt] [-passfile file] [-type stEg] [-chunk size] -o out.png in.png payload
+       pngstego extract [-passfile file] [-type stEg] [-o payload] in.png`)
+	os.Exit(2)
+}
+
+func embed(args []string) error {
+	flags := flag.NewFlagSet("embed", flag.ExitOnError)
+	flags.Usage = usage
+	var options stego.Options
+	flags.BoolVar(&options.Compress, "z", false, "compress the payload with gzip")
+	encrypt := flags.Bool("encrypt", false, "encrypt the payload with a passphrase (from -passfile or $PNGSTEGO_PASSPHRASE)")
+	passfile := flags.String("passfile", "", "file containing the passphrase")
+	typ := flags.String("type", string(stego.DefaultType), "private ancillary chunk type")
+	flags.IntVar(&options.ChunkSize, "chunk", stego.DefaultChunkSize, "maximum payload bytes per chunk")
+	output := flags.String("o", "", "output PNG file (may be the same as the input)")
+	_ = flags.Parse(args)
+	if flags.NArg() != 2 || *output == "" {
+		usage()
+	}
+	options.Type = pngchunk.Type(*typ)
+	if *encrypt || *passfile != "" {
+		passphrase, err := readPassphrase(*passfile)
+		if err != nil {
+			return err
+		}
+		options.Passphrase = passphrase
+	}
+	payload, err := ioutil.ReadFile(flags.Arg(1))
+	if err != nil {
+		return err
+	}
+	input, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = input.Close()
+	}()
+	info, err := input.Stat()
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(*output, info.Mode().Perm(), func(w io.Writer) error {
+		return stego.Embed(w, input, payload, &options)
+	})
+}
+
+func extract(args []string) error {
+	flags := flag.NewFlagSet("extract", flag.ExitOnError)
+	flags.Usage = usage
+	var options stego.Options
+	passfile := flags.String("passfile", "", "file containing the passphrase")
+	typ := flags.String("type", string(stego.DefaultType), "private ancillary chunk type")
+	output := flags.String("o", "", "output file (default: stdout)")
+	_ = flags.Parse(args)
+	if flags.NArg() != 1 {
+		usage()
+	}
+	options.Type = pngchunk.Type(*typ)
+	// 暗号化されていない場合はパスフレーズは使われないので、環境変数があれば渡しておく
+	if passphrase, err := readPassphrase(*passfile); err == nil {
+		options.Passphrase = passphrase
+	} else if *passfile != "" {
+		return err
+	}
+	input, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = input.Close()
+	}()
+	// 改ざんされていた場合に途中までのデータを書き出さないように、全て確かめてから書き出す
+	payload, err := stego.Extract(input, &options)
+	if err != nil {
+		return err
+	}
+	if *output == "" {
+		_, err = os.Stdout.Write(payload)
+		return err
+	}
+	// 取り出したデータは秘密のものなので、自分だけが読めるようにする
+	return atomicfile.WriteFile(*output, 0600, func(w io.Writer) error {
+		_, err := w.Write(payload)
+		return err
+	})
+}
+
+func readPassphrase(path string) ([]byte, error) {
+	if path != "" {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		// echo secret > file で作ったファイルの末尾の改行は含めない
+		return bytes.TrimRight(b, "\r\n"), nil
+	}
+	if passphrase := os.Getenv("PNGSTEGO_PASSPHRASE"); passphrase != "" {
+		return []byte(passphrase), nil
+	}
+	return nil, fmt.Errorf("pngstego: passphrase required: use -passfile or set PNGSTEGO_PASSPHRASE")
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"system-programming/internal/atomicfile"
+	"system-programming/pngchunk"
+)
+
+// PNGファイルからメタデータのチャンクを取り除く
+// 重要チャンクと-keepで指定したチャンクだけを残し、テキストやExif、更新日時などを捨てる
+// データを流しながらコピーするので、大きなファイルでもメモリをほとんど使わない
+//
+//	go run ./cmd/pngstrip -o stripped.png secret.png
+//	go run ./cmd/pngstrip -keep gAMA,sRGB -v < secret.png > stripped.png
+//	go run ./cmd/pngstrip -keep "" -o secret.png secret.png
+func main() {
+	keep := flag.String("keep", typesString(pngchunk.DefaultKeep), "comma separated list of ancillary chunks to keep")
+	output := flag.String("o", "", "output file (default: stdout); may be the same as the input")
+	verbose := flag.Bool("v", false, "print removed chunks to stderr")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: pngstrip [-keep types] [-o out.png] [-v] [in.png]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() > 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	var types []pngchunk.Type
+	for _, t := range strings.Split(*keep, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types = append(types, pngchunk.Type(t))
+		}
+	}
+
+	var input io.Reader = os.Stdin
+	// 出力先のパーミッションは入力のファイルに合わせる
+	mode := atomicfile.Mode(*output, 0644)
+	if flag.NArg() == 1 {
+		file, err := os.Open(flag.Arg(0))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer func() {
+			_ = file.Close()
+		}()
+		if info, err := file.Stat(); err == nil {
+			mode = info.Mode().Perm()
+		}
+		input = file
+	}
+	var dropped []pngchunk.Header
+	strip := func(w io.Writer) error {
+		var err error
+		dropped, err = pngchunk.Strip(w, input, types...)
+		return err
+	}
+	var err error
+	if *output == "" {
+		err = strip(os.Stdout)
+	} else {
+		err = atomicfile.WriteFile(*output, mode, strip)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *verbose {
+		for _, h := range dropped {
+			fmt.Fprintf(os.Stderr, "removed '%s' (%d bytes) at offset %d\n", h.Type, h.Length, h.Offset)
+		}
+	}
+}
+
+func typesString(types []pngchunk.Type) string {
+	s := make([]string, len(types))
+	for i, t := range types {
+		s[i] = string(t)
+	}
+	return strings.Join(s, ",")
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"system-programming/internal/atomicfile"
+	"system-programming/pngchunk"
+)
+
+// PNGファイルのテキスト(tEXt、zTXt、iTXt)を表示したり、追加、置き換え、削除したりする
+// ファイルは同じディレクトリの一時ファイルに書き出してからリネームで置き換えるので、途中で失敗しても元のファイルは壊れない
+//
+//	go run ./cmd/pngtext list secret.png
+//	go run ./cmd/pngtext add secret.png Author "Gopher"
+//	go run ./cmd/pngtext add -lang ja -z secret.png Title "システムプログラミング"
+//	go run ./cmd/pngtext set secret.png Comment "ASCII PROGRAMMING++"
+//	go run ./cmd/pngtext delete secret.png Author
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	var err error
+	switch command, args := os.Args[1], os.Args[2:]; command {
+	case "list":
+		err = list(args)
+	case "add", "set":
+		err = write(command, args)
+	case "delete":
+		err = remove(args)
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `usage: pngtext list file.png
+       pngtext add [-type tEXt|zTXt|iTXt] [-z] [-lang tag] [-translated keyword] file.png keyword text
+       pngtext set [-type tEXt|zTXt|iTXt] [-z] [-lang tag] [-translated keyword] file.png keyword text
+       pngtext delete file.png keyword`)
+	os.Exit(2)
+}
+
+func list(args []string) error {
+	if len(args) != 1 {
+		usage()
+	}
+	file, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	texts, err := pngchunk.ReadTexts(file)
+	if err != nil {
+		return err
+	}
+	for _, t := range texts {
+		fmt.Println(t)
+	}
+	return nil
+}
+
+// addは同じキーワードがあっても追加し、setは同じキーワードのテキストを全て置き換える
+func write(command string, args []string) error {
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	flags.Usage = usage
+	typ := flags.String("type", "", "chunk type (default: tEXt if the text is Latin-1, otherwise iTXt)")
+	compress := flags.Bool("z", false, "compress the text (zTXt, or compressed iTXt)")
+	language := flags.String("lang", "", "language tag such as ja or en-US (iTXt)")
+	translated := flags.String("translated", "", "keyword translated into the language (iTXt)")
+	_ = flags.Parse(args)
+	if flags.NArg() != 3 {
+		usage()
+	}
+	path, keyword, value := flags.Arg(0), flags.Arg(1), flags.Arg(2)
+
+	text := pngchunk.NewText(keyword, value)
+	if *compress && text.Type == pngchunk.TypeText {
+		text.Type = pngchunk.TypeCompressedText
+	}
+	if *language != "" || *translated != "" {
+		text.Type = pngchunk.TypeInternational
+	}
+	if *typ != "" {
+		text.Type = pngchunk.Type(*typ)
+	}
+	if text.Type == pngchunk.TypeInternational {
+		text.Compressed = *compress
+		text.Language = *language
+		text.TranslatedKeyword = *translated
+	}
+	// 書き換える前にチャンクに変換できるかを確かめておく
+	if _, err := text.Chunk(); err != nil {
+		return err
+	}
+
+	return rewrite(path, func(w io.Writer, r io.Reader) error {
+		if command == "add" {
+			return pngchunk.RewriteTexts(w, r, nil, text)
+		}
+		replaced := false
+		edit := func(t *pngchunk.Text) *pngchunk.Text {
+			if t.Keyword != keyword {
+				return t
+			}
+			// 最初のものを置き換え、残りは削除する
+			if replaced {
+				return nil
+			}
+			replaced = true
+			return text
+		}
+		// 置き換えるものがなかったときだけ追加したいので、一度読んで確かめる
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = file.Close()
+		}()
+		texts, err := pngchunk.ReadTexts(file)
+		if err != nil {
+			return err
+		}
+		for _, t := range texts {
+			if t.Keyword == keyword {
+				return pngchunk.RewriteTexts(w, r, edit)
+			}
+		}
+		return pngchunk.RewriteTexts(w, r, edit, text)
+	})
+}
+
+func remove(args []string) error {
+	if len(args) != 2 {
+		usage()
+	}
+	path, keyword := args[0], args[1]
+	found := false
+	err := rewrite(path, func(w io.Writer, r io.Reader) error {
+		return pngchunk.RewriteTexts(w, r, func(t *pngchunk.Text) *pngchunk.Text {
+			if t.Keyword == keyword {
+				found = true
+				return nil
+			}
+			return t
+		})
+	})
+	if err == nil && !found {
+		return fmt.Errorf("pngtext: keyword %q not found in %s", keyword, path)
+	}
+	return err
+}
+
+// pathのファイルをfで書き換える
+// 一時ファイルに書き出してからリネームするので、他のプロセスから書きかけのファイルが見えることはない
+func rewrite(path string, f func(w io.Writer, r io.Reader) error) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = src.Close()
+	}()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(path, info.Mode().Perm(), func(w io.Writer) error {
+		return f(w, src)
+	})
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"system-programming/udpcast"
+)
+
+// udp.goのマルチキャストのtickサーバーとクライアントを、グループやインターフェースを指定して動かせるようにしたもの
+// -serveで時刻を送信し、省略すると受信して送信元との時計のずれ、ジッター、抜けや重複を表示する
+// -broadcastを指定するとマルチキャストの代わりにブロードキャストを使う。メッセージの形式は同じ
+//
+//	go run ./cmd/tick -serve -group 224.0.0.1,239.1.2.3 -iface en0 -ttl 4
+//	go run ./cmd/tick -group 224.0.0.1,239.1.2.3 -iface en0
+//	go run ./cmd/tick -group 232.1.2.3 -source 192.168.1.10 -iface en0
+//	go run ./cmd/tick -group ff02::1:3 -iface lo -loopback
+//	go run ./cmd/tick -serve -broadcast -iface en0
+//	go run ./cmd/tick -broadcast
+func main() {
+	var config udpcast.GroupConfig
+	serve := flag.Bool("serve", false, "send ticks instead of listening")
+	groups := flag.String("group", "224.0.0.1", "comma separated list of multicast group addresses")
+	sources := flag.String("source", "", "comma separated list of source addresses for source-specific multicast")
+	flag.IntVar(&config.Port, "port", 9999, "port number")
+	flag.StringVar(&config.Interface, "iface", "", "network interface name (default: chosen by the OS)")
+	flag.IntVar(&config.TTL, "ttl", 1, "TTL (hop limit) of sent packets")
+	flag.BoolVar(&config.Loopback, "loopback", false, "deliver sent packets to listeners on the same host")
+	broadcast := flag.Bool("broadcast", false, "use broadcast instead of multicast")
+	limited := flag.Bool("limited", false, "send to the limited broadcast address 255.255.255.255 (with -broadcast)")
+	broadcastAddrs := flag.String("baddr", "", "comma separated list of broadcast addresses (with -broadcast, default: computed from the interfaces)")
+	interval := flag.Duration("interval", udpcast.DefaultInterval, "tick interval")
+	flag.Parse()
+
+	var err error
+	if *broadcast {
+		bconfig := udpcast.BroadcastConfig{Port: config.Port, Interface: config.Interface, Limited: *limited}
+		if bconfig.Addrs, err = parseIPs(*broadcastAddrs); err == nil {
+			err = runBroadcast(bconfig, *serve, *interval)
+		}
+	} else {
+		if config.Groups, err = parseIPs(*groups); err == nil {
+			config.Sources, err = parseIPs(*sources)
+		}
+		if err == nil {
+			err = runMulticast(config, *serve, *interval)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func runMulticast(config udpcast.GroupConfig, serve bool, interval time.Duration) error {
+	if serve {
+		conn, err := udpcast.DialGroup(config)
+		if err != nil {
+			return err
+		}
+		return runServer(conn, conn.GroupAddrs(), interval)
+	}
+	conn, err := udpcast.ListenGroup(config)
+	if err != nil {
+		return err
+	}
+	for _, addr := range conn.GroupAddrs() {
+		fmt.Printf("Listen tick server at %v\n", addr)
+	}
+	return runListener(conn)
+}
+
+func runBroadcast(config udpcast.BroadcastConfig, serve bool, interval time.Duration) error {
+	if serve {
+		conn, err := udpcast.DialBroadcast(config)
+		if err != nil {
+			return err
+		}
+		return runServer(conn, conn.Addrs(), interval)
+	}
+	conn, err := udpcast.ListenBroadcast(config)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Listen tick server at %v\n", conn.LocalAddr())
+	return runListener(conn)
+}
+
+func parseIPs(s string) ([]net.IP, error) {
+	var ips []net.IP
+	if s == "" {
+		return nil, nil
+	}
+	for _, field := range strings.Split(s, ",") {
+		ip := net.ParseIP(field)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address: %s", field)
+		}
+		ips = append(ips, ip)
+	}
+	return ips, nil
+}
+
+type sender interface {
+	udpcast.Sender
+	Close() error
+}
+
+func runServer(conn sender, addrs []*net.UDPAddr, interval time.Duration) error {
+	defer func() {
+		_ = conn.Close()
+	}()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	go func() {
+		<-signals
+		cancel()
+	}()
+	for _, addr := range addrs {
+		fmt.Printf("Start tick server at %v\n", addr)
+	}
+	return udpcast.ServeTicks(ctx, conn, interval)
+}
+
+func runListener(conn net.PacketConn) error {
+	// Ctrl+Cでソケットを閉じて受信を終わらせ、送信元ごとの統計を表示する
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	interrupted := make(chan struct{})
+	go func() {
+		<-signals
+		close(interrupted)
+		_ = conn.Close()
+	}()
+	monitor := udpcast.NewTickMonitor()
+	err := udpcast.ReadTicks(conn, func(tick udpcast.Tick) {
+		stats := monitor.Observe(tick)
+		fmt.Printf("Server %v seq=%d\n", tick.From, tick.Sequence)
+		fmt.Printf("Now    %s (offset %v, jitter %v, lost %d)\n", tick.Wall, stats.Offset, stats.Jitter, stats.Lost)
+	})
+	select {
+	case <-interrupted:
+		for _, stats := range monitor.Stats() {
+			fmt.Println(stats)
+		}
+		return nil
+	default:
+		_ = conn.Close()
+		return err
+	}
+}
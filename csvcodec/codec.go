@@ -0,0 +1,329 @@
+// csvcodecパッケージはCSVの行と構造体を相互に変換する
+// read.goではcsv.Readerで読んだ[]stringをline[2]のように位置で参照していたが、
+// ヘッダーの名前か列の番号を構造体のタグで指定して、数値、bool、時刻に変換しながら1行ずつ読み書きする
+//
+//	type Address struct {
+//		Zip        string `csv:",index=2"`
+//		Prefecture string `csv:",index=6"`
+//	}
+//
+//	decoder := csvcodec.NewDecoder(file)
+//	decoder.NoHeader = true
+//	for {
+//		var address Address
+//		err := decoder.Decode(&address)
+//		if err == io.EOF {
+//			break
+//		}
+//		...
+//	}
+package csvcodec
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"time"
+
+	"system-programming/charset"
+)
+
+var ErrMissingColumn = errors.New("csvcodec: missing column")
+
+// 値の変換に失敗した位置
+// Rowはヘッダーを含めて1から数えたレコードの番号(引用符の中の改行があると行番号とは一致しない)
+// Columnは1から数えた列の番号
+type ParseError struct {
+	Row    int
+	Column int
+	Name   string
+	Err    error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("csvcodec: row %d, column %d (%s): %v", e.Row, e.Column, e.Name, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// 列の番号とフィールドの対応
+type column struct {
+	*field
+	position int
+}
+
+// io.Readerから1行ずつ構造体に読み込む
+// 各フィールドは最初のDecode()の前に設定する
+type Decoder struct {
+	// 区切り文字(既定は',')
+	Comma rune
+	// この文字で始まる行を無視する(既定は0で無効)
+	Comment rune
+	// 引用符で囲まれていないフィールドの中の引用符を許す
+	LazyQuotes bool
+	// フィールドの先頭の空白を取り除く
+	TrimLeadingSpace bool
+	// 1行目をヘッダーとして扱わない。タグで全ての列の番号を指定する必要がある
+	NoHeader bool
+	// time.Timeのフィールドの既定の書式(既定はtime.RFC3339)
+	TimeLayout string
+	// 入力の文字コード(charsetパッケージの名前)。空ならUTF-8、"auto"なら先頭から推測する
+	Charset string
+
+	r       io.Reader
+	reader  *csv.Reader
+	header  []string
+	row     int
+	columns map[reflect.Type][]column
+}
+
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{Comma: ',', TimeLayout: time.RFC3339, r: r, columns: make(map[reflect.Type][]column)}
+}
+
+func (d *Decoder) init() error {
+	if d.reader != nil {
+		return nil
+	}
+	r := d.r
+	switch d.Charset {
+	case "":
+	case "auto":
+		sniffed, _, err := charset.Sniff(r)
+		if err != nil {
+			return err
+		}
+		r = sniffed
+	default:
+		decoded, err := charset.NewReader(r, d.Charset)
+		if err != nil {
+			return err
+		}
+		r = decoded
+	}
+	d.reader = csv.NewReader(r)
+	d.reader.Comma = d.Comma
+	d.reader.Comment = d.Comment
+	d.reader.LazyQuotes = d.LazyQuotes
+	d.reader.TrimLeadingSpace = d.TrimLeadingSpace
+	// 1行ごとに[]stringを確保しない。値は構造体にコピーするので問題ない
+	d.reader.ReuseRecord = true
+	if d.NoHeader {
+		return nil
+	}
+	header, err := d.reader.Read()
+	if err != nil {
+		return err
+	}
+	d.row++
+	d.header = append([]string(nil), header...)
+	return nil
+}
+
+// ヘッダーの行(NoHeaderならnil)
+func (d *Decoder) Header() ([]string, error) {
+	if err := d.init(); err != nil {
+		return nil, err
+	}
+	return d.header, nil
+}
+
+// 次の行をvに読み込む。vは構造体へのポインタ
+// 全ての行を読み終えるとio.EOFを返す
+func (d *Decoder) Decode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("csvcodec: cannot decode into %T", v)
+	}
+	if err := d.init(); err != nil {
+		return err
+	}
+	columns, err := d.columnsOf(rv.Elem().Type())
+	if err != nil {
+		return err
+	}
+	record, err := d.reader.Read()
+	if err != nil {
+		// csv.ParseErrorには行と列が含まれている
+		return err
+	}
+	d.row++
+	s := rv.Elem()
+	for _, c := range columns {
+		e := &ParseError{Row: d.row, Column: c.position + 1, Name: c.name}
+		if c.position >= len(record) {
+			e.Err = ErrMissingColumn
+			return e
+		}
+		layout := c.layout
+		if layout == "" {
+			layout = d.TimeLayout
+		}
+		if err := parse(s.FieldByIndex(c.index), record[c.position], layout); err != nil {
+			e.Err = err
+			return e
+		}
+	}
+	return nil
+}
+
+// 構造体のフィールドをヘッダーの位置に対応させる
+func (d *Decoder) columnsOf(t reflect.Type) ([]column, error) {
+	if columns, ok := d.columns[t]; ok {
+		return columns, nil
+	}
+	fields, err := fieldsOf(t)
+	if err != nil {
+		return nil, err
+	}
+	columns := make([]column, 0, len(fields))
+	for _, f := range fields {
+		position := f.column
+		if position < 0 {
+			if d.NoHeader {
+				return nil, fmt.Errorf("csvcodec: %s: no header to find column %q, use index=N", t.Name(), f.name)
+			}
+			for i, name := range d.header {
+				if name == f.name {
+					position = i
+					break
+				}
+			}
+			if position < 0 {
+				return nil, fmt.Errorf("%w %q", ErrMissingColumn, f.name)
+			}
+		}
+		columns = append(columns, column{field: f, position: position})
+	}
+	d.columns[t] = columns
+	return columns, nil
+}
+
+// 構造体を1行ずつio.Writerに書き出す
+// 各フィールドは最初のEncode()の前に設定する
+type Encoder struct {
+	// 区切り文字(既定は',')
+	Comma rune
+	// 改行を\r\nにする
+	UseCRLF bool
+	// ヘッダーの行を書かない
+	NoHeader bool
+	// time.Timeのフィールドの既定の書式(既定はtime.RFC3339)
+	TimeLayout string
+	// 出力の文字コード(charsetパッケージの名前)。空ならUTF-8
+	// 指定した場合は最後にClose()を呼ぶ
+	Charset string
+
+	w       io.Writer
+	writer  *csv.Writer
+	// Charsetを指定したときの変換
+	encoder io.WriteCloser
+	typ     reflect.Type
+	columns []column
+	record  []string
+}
+
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{Comma: ',', TimeLayout: time.RFC3339, w: w}
+}
+
+// vを1行として書き出す。vは構造体か構造体へのポインタで、全て同じ型でなければならない
+// 最初の呼び出しでヘッダーを書き出す
+// csv.Writerでバッファリングされるので、最後にFlush()を呼ぶ
+func (e *Encoder) Encode(v interface{}) error {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("csvcodec: cannot encode %T", v)
+	}
+	if e.writer == nil {
+		if err := e.init(rv.Type()); err != nil {
+			return err
+		}
+	} else if rv.Type() != e.typ {
+		return fmt.Errorf("csvcodec: cannot encode %s after %s", rv.Type(), e.typ)
+	}
+	for _, c := range e.columns {
+		layout := c.layout
+		if layout == "" {
+			layout = e.TimeLayout
+		}
+		s, err := format(rv.FieldByIndex(c.index), layout)
+		if err != nil {
+			return fmt.Errorf("csvcodec: %s: %v", c.name, err)
+		}
+		e.record[c.position] = s
+	}
+	return e.writer.Write(e.record)
+}
+
+// 列の番号を指定したフィールドはその位置に、それ以外は後ろに宣言の順に並べる
+func (e *Encoder) init(t reflect.Type) error {
+	fields, err := fieldsOf(t)
+	if err != nil {
+		return err
+	}
+	width := 0
+	for _, f := range fields {
+		if f.column >= width {
+			width = f.column + 1
+		}
+	}
+	header := make([]string, width)
+	used := make([]bool, width)
+	for _, f := range fields {
+		position := f.column
+		if position < 0 {
+			position = len(header)
+			header = append(header, f.name)
+			used = append(used, true)
+		} else if used[position] {
+			return fmt.Errorf("csvcodec: %s: column %d is used twice", t.Name(), position)
+		} else {
+			header[position] = f.name
+			used[position] = true
+		}
+		e.columns = append(e.columns, column{field: f, position: position})
+	}
+	e.typ = t
+	e.record = make([]string, len(header))
+	w := e.w
+	if e.Charset != "" {
+		encoder, err := charset.NewWriter(w, e.Charset)
+		if err != nil {
+			return err
+		}
+		e.encoder, w = encoder, encoder
+	}
+	e.writer = csv.NewWriter(w)
+	e.writer.Comma = e.Comma
+	e.writer.UseCRLF = e.UseCRLF
+	if e.NoHeader {
+		return nil
+	}
+	return e.writer.Write(header)
+}
+
+// バッファリングされた行を書き出す
+func (e *Encoder) Flush() error {
+	if e.writer == nil {
+		return nil
+	}
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+// 残りを書き出し、Charsetを指定した場合は文字コードの変換を終える(ISO-2022-JPの最後のエスケープシーケンスなど)
+// 元のio.Writerは閉じない
+func (e *Encoder) Close() error {
+	if err := e.Flush(); err != nil {
+		return err
+	}
+	if e.encoder == nil {
+		return nil
+	}
+	return e.encoder.Close()
+}
@@ -0,0 +1,196 @@
+package csvcodec
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// read.goと同じ郵便番号データの形式
+const kenAll = `13101,"100  ","1000003","ﾄｳｷｮｳﾄ","ﾁﾖﾀﾞｸ","ﾋﾄﾂﾊﾞｼ(1ﾁｮｳﾒ)","東京都","千代田区","一ツ橋（１丁目）",1,0,1,0,0,0
+13101,"100  ","1000004","ﾄｳｷｮｳﾄ","ﾁﾖﾀﾞｸ","ｵｵﾃﾏﾁ","東京都","千代田区","大手町",0,0,1,0,0,0
+`
+
+type address struct {
+	Code       int    `csv:",index=0"`
+	Zip        string `csv:",index=2"`
+	Prefecture string `csv:",index=6"`
+	City       string `csv:",index=7"`
+	Town       string `csv:",index=8"`
+	Multiple   bool   `csv:",index=9"`
+}
+
+func TestDecodeByIndex(t *testing.T) {
+	decoder := NewDecoder(strings.NewReader(kenAll))
+	decoder.NoHeader = true
+	var got []address
+	for {
+		var a address
+		err := decoder.Decode(&a)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, a)
+	}
+	want := []address{
+		{13101, "1000003", "東京都", "千代田区", "一ツ橋（１丁目）", true},
+		{13101, "1000004", "東京都", "千代田区", "大手町", false},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+type Base struct {
+	ID int `csv:"id"`
+}
+
+type item struct {
+	Base
+	Name    string
+	Price   float64   `csv:"price"`
+	Stock   uint      `csv:"stock"`
+	Date    time.Time `csv:"date,format=2006-01-02"`
+	Updated time.Time `csv:"updated"`
+	Status  status    `csv:"status"`
+	Memo    string    `csv:"-"`
+}
+
+// encoding.TextMarshaler、TextUnmarshalerを実装した型
+type status int
+
+func (s status) MarshalText() ([]byte, error) {
+	return []byte([]string{"draft", "published"}[s]), nil
+}
+
+func (s *status) UnmarshalText(b []byte) error {
+	switch string(b) {
+	case "draft":
+		*s = 0
+	case "published":
+		*s = 1
+	default:
+		return errors.New("unknown status " + strconv.Quote(string(b)))
+	}
+	return nil
+}
+
+func TestRoundTrip(t *testing.T) {
+	items := []item{
+		{Base{1}, "Gopher, plush", 12.5, 3, time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC), time.Date(2021, 6, 2, 3, 4, 5, 0, time.UTC), 1, ""},
+		{Base{2}, "\"quoted\"\nname", 0, 0, time.Time{}, time.Time{}, 0, ""},
+	}
+	var buffer bytes.Buffer
+	encoder := NewEncoder(&buffer)
+	encoder.Comma = ';'
+	for _, i := range items {
+		if err := encoder.Encode(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := encoder.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buffer.String(), "id;Name;price;stock;date;updated;status\n1;Gopher, plush;12.5;3;2021-06-01;2021-06-02T03:04:05Z;published\n") {
+		t.Fatalf("unexpected output:\n%s", buffer.String())
+	}
+
+	decoder := NewDecoder(&buffer)
+	decoder.Comma = ';'
+	for _, want := range items {
+		var got item
+		if err := decoder.Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %+v, want %+v", got, want)
+		}
+	}
+	var i item
+	if err := decoder.Decode(&i); err != io.EOF {
+		t.Fatalf("got %v, want io.EOF", err)
+	}
+}
+
+func TestHeaderOrder(t *testing.T) {
+	// ヘッダーの順番が構造体と違っても、名前で対応させる
+	source := "status,stock,price,date,updated,Name,id,extra\npublished,1,2,,,x,3,ignored\n"
+	decoder := NewDecoder(strings.NewReader(source))
+	var got item
+	if err := decoder.Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	want := item{Base: Base{3}, Name: "x", Price: 2, Stock: 1, Status: 1}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	source := "id,Name,price,stock,date,updated,status\n1,a,1,1,,,draft\n2,b,x,1,,,draft\n"
+	decoder := NewDecoder(strings.NewReader(source))
+	var i item
+	if err := decoder.Decode(&i); err != nil {
+		t.Fatal(err)
+	}
+	err := decoder.Decode(&i)
+	var parseError *ParseError
+	if !errors.As(err, &parseError) || parseError.Row != 3 || parseError.Column != 3 || parseError.Name != "price" {
+		t.Fatalf("got %v", err)
+	}
+	if !errors.Is(err, strconv.ErrSyntax) {
+		t.Errorf("got %v, want strconv.ErrSyntax", err)
+	}
+
+	decoder = NewDecoder(strings.NewReader("id,Name\n1,a\n"))
+	if err := decoder.Decode(&i); !errors.Is(err, ErrMissingColumn) {
+		t.Errorf("missing column: got %v", err)
+	}
+
+	decoder = NewDecoder(strings.NewReader("A,B\nx\"y,z\n"))
+	var s struct{ A, B string }
+	if err := decoder.Decode(&s); err == nil {
+		t.Error("bare quote: no error")
+	}
+	decoder = NewDecoder(strings.NewReader("A,B\nx\"y,z\n"))
+	decoder.LazyQuotes = true
+	if err := decoder.Decode(&s); err != nil || s.A != "x\"y" {
+		t.Errorf("lazy quotes: got %q, %v", s.A, err)
+	}
+}
+
+func TestCharset(t *testing.T) {
+	var buffer bytes.Buffer
+	encoder := NewEncoder(&buffer)
+	encoder.NoHeader = true
+	encoder.Charset = "Shift_JIS"
+	want := address{13101, "1000003", "東京都", "千代田区", "一ツ橋（１丁目）", true}
+	if err := encoder.Encode(want); err != nil {
+		t.Fatal(err)
+	}
+	if err := encoder.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(buffer.Bytes(), []byte("東京都")) {
+		t.Fatal("not encoded in Shift_JIS")
+	}
+
+	decoder := NewDecoder(&buffer)
+	decoder.NoHeader = true
+	decoder.Charset = "auto"
+	var got address
+	if err := decoder.Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
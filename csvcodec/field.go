@@ -0,0 +1,183 @@
+package csvcodec
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 構造体のフィールドと列の対応
+type field struct {
+	index []int
+	// ヘッダーの名前
+	name string
+	// 列の番号(0から、-1ならヘッダーの名前で探す)
+	column int
+	// time.Timeの書式(空ならEncoder、DecoderのTimeLayout)
+	layout string
+}
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// タグは`csv:"名前,index=N,format=レイアウト"`
+// 名前を省略するとフィールド名、index=Nを指定するとヘッダーに関係なくN番目(0から)の列を使う
+// `csv:"-"`のフィールドと非公開のフィールドは無視する。埋め込まれた構造体のフィールドは展開する
+func fieldsOf(t reflect.Type) ([]*field, error) {
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("csvcodec: %s is not a struct", t)
+	}
+	var fields []*field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("csv")
+		if tag == "-" {
+			continue
+		}
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct && tag == "" {
+			embedded, err := fieldsOf(sf.Type)
+			if err != nil {
+				return nil, err
+			}
+			for _, f := range embedded {
+				f.index = append([]int{i}, f.index...)
+				fields = append(fields, f)
+			}
+			continue
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+		f := &field{index: []int{i}, name: sf.Name, column: -1}
+		options := strings.Split(tag, ",")
+		if options[0] != "" {
+			f.name = options[0]
+		}
+		for _, option := range options[1:] {
+			switch {
+			case strings.HasPrefix(option, "index="):
+				n, err := strconv.Atoi(option[len("index="):])
+				if err != nil || n < 0 {
+					return nil, fmt.Errorf("csvcodec: %s.%s: invalid index %q", t.Name(), sf.Name, option)
+				}
+				f.column = n
+			case strings.HasPrefix(option, "format="):
+				f.layout = option[len("format="):]
+			default:
+				return nil, fmt.Errorf("csvcodec: %s.%s: unknown tag option %q", t.Name(), sf.Name, option)
+			}
+		}
+		if !supported(sf.Type) {
+			return nil, fmt.Errorf("csvcodec: %s.%s: unsupported type %s", t.Name(), sf.Name, sf.Type)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+func supported(t reflect.Type) bool {
+	if t == timeType || reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// 文字列をフィールドの型に変換する
+// 空文字列は数値、bool、time.Timeではゼロ値にする
+func parse(v reflect.Value, s, layout string) error {
+	if v.Type() == timeType {
+		if s == "" {
+			v.Set(reflect.ValueOf(time.Time{}))
+			return nil
+		}
+		t, err := time.Parse(layout, s)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	}
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(s))
+	}
+	if v.Kind() == reflect.String {
+		v.SetString(s)
+		return nil
+	}
+	if s == "" {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	}
+	return nil
+}
+
+// フィールドの値を文字列にする
+func format(v reflect.Value, layout string) (string, error) {
+	if v.Type() == timeType {
+		t := v.Interface().(time.Time)
+		if t.IsZero() {
+			return "", nil
+		}
+		return t.Format(layout), nil
+	}
+	if v.Type().Implements(textMarshalerType) {
+		b, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(b), err
+	}
+	if v.CanAddr() && v.Addr().Type().Implements(textMarshalerType) {
+		b, err := v.Addr().Interface().(encoding.TextMarshaler).MarshalText()
+		return string(b), err
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits()), nil
+	}
+	return "", fmt.Errorf("unsupported type %s", v.Type())
+}
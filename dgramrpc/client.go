@@ -0,0 +1,171 @@
+package dgramrpc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+var (
+	ErrTimeout = errors.New("dgramrpc: request timed out")
+	ErrClosed  = errors.New("dgramrpc: client closed")
+)
+
+// 1つのサーバーにリクエストを送るクライアント
+// 設定のフィールドは最初のCall()より前に変更する
+type Client struct {
+	// 最初の再送までの待ち時間。再送するたびに倍になり、MaxRetransmitIntervalで頭打ちになる
+	RetransmitInterval    time.Duration
+	MaxRetransmitInterval time.Duration
+	// ctxに期限がない場合のCall()全体のタイムアウト
+	Timeout         time.Duration
+	MaxDatagramSize int
+	// 受け付けるレスポンスの最大サイズ
+	MaxMessageSize int
+
+	conn    net.PacketConn
+	addr    net.Addr
+	mutex   sync.Mutex
+	nextID  uint32
+	pending map[uint32]*call
+	closed  bool
+	done    chan struct{}
+}
+
+type call struct {
+	response *reassembly
+	result   chan []byte
+}
+
+// connから受信するgoroutineを起動する
+// connはこのクライアント専用にする(他のデータグラムは読み捨てられる)
+func NewClient(conn net.PacketConn, addr net.Addr) *Client {
+	c := &Client{
+		RetransmitInterval:    100 * time.Millisecond,
+		MaxRetransmitInterval: 2 * time.Second,
+		Timeout:               5 * time.Second,
+		MaxDatagramSize:       DefaultMaxDatagramSize,
+		MaxMessageSize:        DefaultMaxMessageSize,
+		nextID:                randomID(),
+		conn:                  conn,
+		addr:                  addr,
+		pending:               make(map[uint32]*call),
+		done:                  make(chan struct{}),
+	}
+	go c.readLoop()
+	return c
+}
+
+// サーバーは送信元のアドレスとメッセージIDで重複を取り除くので、
+// 再起動したクライアントが同じアドレスで以前と同じIDを使うと、前のプロセスに返したレスポンスが返ってきてしまう
+// そのため最初のIDは乱数で決める
+func randomID() uint32 {
+	var b [4]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return uint32(time.Now().UnixNano())
+	}
+	return binary.BigEndian.Uint32(b[:])
+}
+
+func (c *Client) readLoop() {
+	defer close(c.done)
+	buffer := make([]byte, 64*1024)
+	for {
+		n, from, err := c.conn.ReadFrom(buffer)
+		if err != nil {
+			c.mutex.Lock()
+			c.closed = true
+			c.mutex.Unlock()
+			return
+		}
+		if from == nil || from.String() != c.addr.String() {
+			continue
+		}
+		h, ok := parseHeader(buffer[:n], maxFragments)
+		if !ok || h.kind != typeResponse {
+			continue
+		}
+		c.mutex.Lock()
+		pending, ok := c.pending[h.id]
+		if ok {
+			if pending.response == nil {
+				pending.response = newReassembly(h.count, c.MaxMessageSize)
+			}
+			if pending.response.add(h, buffer[headerSize:n]) {
+				// 遅れて届いた重複したレスポンスは、pendingから消えているので無視される
+				delete(c.pending, h.id)
+				pending.result <- pending.response.message()
+			}
+		}
+		c.mutex.Unlock()
+	}
+}
+
+// リクエストを送ってレスポンスを待つ
+// レスポンスの断片が全てそろうまで、間隔を倍にしながらリクエスト全体を再送する
+// サーバー側で重複は取り除かれるので、再送してもハンドラーが2回呼ばれることはない
+func (c *Client) Call(ctx context.Context, request []byte) ([]byte, error) {
+	if _, ok := ctx.Deadline(); !ok && c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	c.mutex.Lock()
+	if c.closed {
+		c.mutex.Unlock()
+		return nil, ErrClosed
+	}
+	c.nextID++
+	id := c.nextID
+	pending := &call{result: make(chan []byte, 1)}
+	c.pending[id] = pending
+	c.mutex.Unlock()
+	defer func() {
+		c.mutex.Lock()
+		delete(c.pending, id)
+		c.mutex.Unlock()
+	}()
+
+	packets, err := fragment(typeRequest, id, request, c.MaxDatagramSize)
+	if err != nil {
+		return nil, err
+	}
+	interval := c.RetransmitInterval
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	for {
+		for _, packet := range packets {
+			if _, err := c.conn.WriteTo(packet, c.addr); err != nil {
+				return nil, err
+			}
+		}
+		select {
+		case response := <-pending.result:
+			return response, nil
+		case <-c.done:
+			return nil, ErrClosed
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				return nil, ErrTimeout
+			}
+			return nil, ctx.Err()
+		case <-timer.C:
+			interval *= 2
+			if interval > c.MaxRetransmitInterval {
+				interval = c.MaxRetransmitInterval
+			}
+			timer.Reset(interval)
+		}
+	}
+}
+
+// connを閉じ、待っているCall()をErrClosedで終了させる
+func (c *Client) Close() error {
+	err := c.conn.Close()
+	<-c.done
+	return err
+}
@@ -0,0 +1,207 @@
+package dgramrpc
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 書き込んだデータグラムを一定の確率で捨てるnet.PacketConn
+type lossyConn struct {
+	net.PacketConn
+	mutex  sync.Mutex
+	random *rand.Rand
+	loss   float64
+}
+
+func newLossyConn(conn net.PacketConn, loss float64, seed int64) *lossyConn {
+	return &lossyConn{PacketConn: conn, random: rand.New(rand.NewSource(seed)), loss: loss}
+}
+
+func (c *lossyConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	c.mutex.Lock()
+	drop := c.random.Float64() < c.loss
+	c.mutex.Unlock()
+	if drop {
+		return len(b), nil
+	}
+	return c.PacketConn.WriteTo(b, addr)
+}
+
+func testCalls(t *testing.T, serverConn, clientConn net.PacketConn) {
+	var calls int64
+	server := &Server{
+		Handler: func(request []byte, addr net.Addr) []byte {
+			atomic.AddInt64(&calls, 1)
+			return bytes.ToUpper(request)
+		},
+	}
+	go func() {
+		_ = server.Serve(newLossyConn(serverConn, 0.2, 1))
+	}()
+	defer serverConn.Close()
+
+	client := NewClient(newLossyConn(clientConn, 0.2, 2), serverConn.LocalAddr())
+	client.RetransmitInterval = 10 * time.Millisecond
+	defer client.Close()
+
+	// 1500バイトのバッファに収まらないので分割される
+	large := bytes.Repeat([]byte("hello "), 2000)
+	requests := [][]byte{[]byte("hello"), {}, large}
+	for i := 0; i < 10; i++ {
+		for _, request := range requests {
+			response, err := client.Call(context.Background(), request)
+			if err != nil {
+				t.Fatalf("call %d (%d bytes): %v", i, len(request), err)
+			}
+			if !bytes.Equal(response, bytes.ToUpper(request)) {
+				t.Fatalf("response of %d bytes does not match request of %d bytes", len(response), len(request))
+			}
+		}
+	}
+	// レスポンスが失われて再送されても、ハンドラーは1回ずつしか呼ばれない
+	if n := atomic.LoadInt64(&calls); n != int64(10*len(requests)) {
+		t.Errorf("handler called %d times, want %d", n, 10*len(requests))
+	}
+}
+
+func TestUDP(t *testing.T) {
+	serverConn, err := net.ListenPacket("udp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientConn, err := net.ListenPacket("udp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCalls(t, serverConn, clientConn)
+}
+
+func TestUnixgram(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dgramrpc-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	serverConn, err := net.ListenPacket("unixgram", filepath.Join(dir, "server.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientConn, err := net.ListenPacket("unixgram", filepath.Join(dir, "client.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCalls(t, serverConn, clientConn)
+}
+
+func TestTimeout(t *testing.T) {
+	// 誰も応答しないアドレス
+	silent, err := net.ListenPacket("udp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+	clientConn, err := net.ListenPacket("udp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewClient(clientConn, silent.LocalAddr())
+	client.RetransmitInterval = 10 * time.Millisecond
+	client.Timeout = 100 * time.Millisecond
+	defer client.Close()
+	start := time.Now()
+	if _, err := client.Call(context.Background(), []byte("hello")); err != ErrTimeout {
+		t.Fatalf("err = %v, want %v", err, ErrTimeout)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("timeout took %v", elapsed)
+	}
+}
+
+func TestFragment(t *testing.T) {
+	message := bytes.Repeat([]byte{1, 2, 3}, 1000)
+	packets, err := fragment(typeRequest, 7, message, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 逆順で、しかも重複して届いても組み立てられる
+	var assembly *reassembly
+	complete := false
+	for i := len(packets) - 1; i >= 0; i-- {
+		for j := 0; j < 2; j++ {
+			h, ok := parseHeader(packets[i], maxCount(len(message), 100))
+			if !ok || h.id != 7 || len(packets[i]) > 100 {
+				t.Fatalf("bad packet %d", i)
+			}
+			if assembly == nil {
+				assembly = newReassembly(h.count, len(message))
+			}
+			complete = assembly.add(h, packets[i][headerSize:])
+		}
+	}
+	if !complete || !bytes.Equal(assembly.message(), message) {
+		t.Error("reassembled message does not match")
+	}
+	// 最大サイズのメッセージより多い断片を名乗るデータグラムは捨てる
+	if _, ok := parseHeader(packets[0], len(packets)-1); ok {
+		t.Error("accepted too many fragments")
+	}
+}
+
+func TestReassemblyLimit(t *testing.T) {
+	serverConn, err := net.ListenPacket("udp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer serverConn.Close()
+	server := &Server{
+		Handler: func(request []byte, addr net.Addr) []byte {
+			return request
+		},
+		MaxReassembliesPerAddr: 2,
+	}
+	go func() {
+		_ = server.Serve(serverConn)
+	}()
+
+	// 断片の1つ目だけを送り続ける送信元
+	attacker, err := net.ListenPacket("udp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer attacker.Close()
+	for id := uint32(1); id <= 5; id++ {
+		packet := make([]byte, headerSize+1)
+		header{kind: typeRequest, id: id, index: 0, count: 2}.put(packet)
+		if _, err := attacker.WriteTo(packet, serverConn.LocalAddr()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 別の送信元のリクエストは処理される
+	// Serve()は順番に処理するので、レスポンスが返ってきた時点で上のデータグラムは処理済み
+	clientConn, err := net.ListenPacket("udp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewClient(clientConn, serverConn.LocalAddr())
+	client.RetransmitInterval = 10 * time.Millisecond
+	defer client.Close()
+	if _, err := client.Call(context.Background(), []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	if n := server.assemblingAddrs[attacker.LocalAddr().String()]; n != 2 {
+		t.Errorf("%d reassemblies from one address, want 2", n)
+	}
+}
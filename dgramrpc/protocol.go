@@ -0,0 +1,156 @@
+// dgramrpcパッケージはUDPやunixgramのようなデータグラム型のソケット(net.PacketConn)の上に、信頼性のあるリクエスト/レスポンスの仕組みを作る
+// データグラムは失われたり、重複したり、順序が入れ替わったりするので、次のことを行う
+//   - メッセージIDでリクエストとレスポンスを対応付ける
+//   - レスポンスが来なければ間隔を倍にしながら再送し、全体のタイムアウトで諦める
+//   - サーバー側では処理済みのメッセージIDのレスポンスを覚えておき、再送されたリクエストを二重に処理せずに同じレスポンスを返す
+//   - 1つのデータグラムに収まらない大きなメッセージは分割して送り、受信側で組み立てる
+package dgramrpc
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// データグラムの先頭に付けるヘッダー(ビッグエンディアン)
+//
+//	0: マジックナンバー 'R'
+//	1: 種類(リクエストかレスポンスか)
+//	2-5: メッセージID
+//	6-7: 分割したうちの何番目か
+//	8-9: 全部でいくつに分割したか
+const headerSize = 10
+
+const magic = 'R'
+
+const (
+	typeRequest  = 1
+	typeResponse = 2
+)
+
+// 1つのデータグラムの最大サイズの初期値
+// unix.goやudp.goの例と同じく1500バイトのバッファで受け取れる大きさにする
+const DefaultMaxDatagramSize = 1500
+
+// 1つのメッセージの最大サイズの初期値
+const DefaultMaxMessageSize = 1 << 20
+
+// 分割できる数の上限
+const maxFragments = 1<<16 - 1
+
+var ErrMessageTooLarge = errors.New("dgramrpc: message too large")
+
+type header struct {
+	kind  byte
+	id    uint32
+	index uint16
+	count uint16
+}
+
+func (h header) put(b []byte) {
+	b[0] = magic
+	b[1] = h.kind
+	binary.BigEndian.PutUint32(b[2:], h.id)
+	binary.BigEndian.PutUint16(b[6:], h.index)
+	binary.BigEndian.PutUint16(b[8:], h.count)
+}
+
+// maxMessageSizeのメッセージをmaxDatagramSizeで分割したときの断片の数
+// これより多い断片を名乗るデータグラムは、組み立てるためのメモリを確保する前に捨てる
+func maxCount(maxMessageSize, maxDatagramSize int) int {
+	chunkSize := maxDatagramSize - headerSize
+	if chunkSize <= 0 {
+		return 1
+	}
+	count := (maxMessageSize + chunkSize - 1) / chunkSize
+	if count < 1 {
+		count = 1
+	}
+	if count > maxFragments {
+		count = maxFragments
+	}
+	return count
+}
+
+func parseHeader(b []byte, maxCount int) (header, bool) {
+	if len(b) < headerSize || b[0] != magic {
+		return header{}, false
+	}
+	h := header{
+		kind:  b[1],
+		id:    binary.BigEndian.Uint32(b[2:]),
+		index: binary.BigEndian.Uint16(b[6:]),
+		count: binary.BigEndian.Uint16(b[8:]),
+	}
+	if h.count == 0 || h.index >= h.count || int(h.count) > maxCount {
+		return header{}, false
+	}
+	return h, true
+}
+
+// メッセージをヘッダー付きのデータグラムに分割する
+// 空のメッセージも1つのデータグラムとして送る
+func fragment(kind byte, id uint32, message []byte, maxDatagramSize int) ([][]byte, error) {
+	chunkSize := maxDatagramSize - headerSize
+	if chunkSize <= 0 {
+		return nil, errors.New("dgramrpc: datagram size too small")
+	}
+	count := (len(message) + chunkSize - 1) / chunkSize
+	if count == 0 {
+		count = 1
+	}
+	if count > maxFragments {
+		return nil, ErrMessageTooLarge
+	}
+	packets := make([][]byte, count)
+	for i := range packets {
+		start := i * chunkSize
+		end := start + chunkSize
+		if end > len(message) {
+			end = len(message)
+		}
+		packet := make([]byte, headerSize+end-start)
+		header{kind: kind, id: id, index: uint16(i), count: uint16(count)}.put(packet)
+		copy(packet[headerSize:], message[start:end])
+		packets[i] = packet
+	}
+	return packets, nil
+}
+
+// 分割されたデータグラムを組み立てる
+// 重複して届いた断片は無視し、順序が入れ替わっていても組み立てられる
+// 合計がmaxSizeを超える断片は捨てるので、そのメッセージは組み立てられずにタイムアウトする
+type reassembly struct {
+	fragments [][]byte
+	received  int
+	size      int
+	maxSize   int
+}
+
+func newReassembly(count uint16, maxSize int) *reassembly {
+	return &reassembly{fragments: make([][]byte, count), maxSize: maxSize}
+}
+
+// 全ての断片がそろったらtrueを返す
+func (r *reassembly) add(h header, payload []byte) bool {
+	if int(h.count) != len(r.fragments) {
+		return false
+	}
+	if r.fragments[h.index] == nil && r.size+len(payload) <= r.maxSize {
+		r.fragments[h.index] = append([]byte{}, payload...)
+		r.received++
+		r.size += len(payload)
+	}
+	return r.received == len(r.fragments)
+}
+
+func (r *reassembly) message() []byte {
+	var size int
+	for _, f := range r.fragments {
+		size += len(f)
+	}
+	message := make([]byte, 0, size)
+	for _, f := range r.fragments {
+		message = append(message, f...)
+	}
+	return message
+}
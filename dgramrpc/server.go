@@ -0,0 +1,187 @@
+package dgramrpc
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// リクエストを処理してレスポンスを返す
+type Handler func(request []byte, addr net.Addr) []byte
+
+type Server struct {
+	Handler         Handler
+	MaxDatagramSize int
+	// 受け付けるリクエストの最大サイズ
+	// 断片の数の上限はMaxDatagramSizeで分割した場合から決めるので、クライアントのMaxDatagramSizeはサーバー以上にする
+	MaxMessageSize int
+	// レスポンスを覚えておく時間
+	// この間に同じ送信元から同じIDのリクエストが再送されてきたら、ハンドラーを呼ばずに覚えておいたレスポンスを返す
+	// クライアントのタイムアウトより長くしておく
+	DedupWindow time.Duration
+	// 断片がそろわないリクエストを破棄するまでの時間
+	ReassemblyTimeout time.Duration
+	// 組み立て途中のリクエストの数の上限(全体と送信元ごと)
+	// 上限に達している間は、新しいリクエストの断片を捨てる
+	MaxReassemblies        int
+	MaxReassembliesPerAddr int
+
+	mutex    sync.Mutex
+	requests map[requestKey]*request
+	// 組み立て途中のリクエストの数
+	assembling      int
+	assemblingAddrs map[string]int
+}
+
+// メッセージIDはクライアントごとに振られるので、送信元のアドレスと組み合わせて区別する
+type requestKey struct {
+	addr string
+	id   uint32
+}
+
+type request struct {
+	assembly *reassembly
+	// nilの間はまだハンドラーが処理中
+	response [][]byte
+	expires  time.Time
+}
+
+func (s *Server) init() {
+	if s.MaxDatagramSize <= 0 {
+		s.MaxDatagramSize = DefaultMaxDatagramSize
+	}
+	if s.DedupWindow <= 0 {
+		s.DedupWindow = 30 * time.Second
+	}
+	if s.ReassemblyTimeout <= 0 {
+		s.ReassemblyTimeout = 10 * time.Second
+	}
+	if s.MaxMessageSize <= 0 {
+		s.MaxMessageSize = DefaultMaxMessageSize
+	}
+	if s.MaxReassemblies <= 0 {
+		s.MaxReassemblies = 1024
+	}
+	if s.MaxReassembliesPerAddr <= 0 {
+		s.MaxReassembliesPerAddr = 16
+	}
+	s.requests = make(map[requestKey]*request)
+	s.assembling = 0
+	s.assemblingAddrs = make(map[string]int)
+}
+
+// connから受信したリクエストを処理する
+// ハンドラーはリクエストごとにgoroutineで呼ばれる
+// connが閉じられるとエラーを返して終了する
+func (s *Server) Serve(conn net.PacketConn) error {
+	s.mutex.Lock()
+	s.init()
+	s.mutex.Unlock()
+	buffer := make([]byte, 64*1024)
+	count := maxCount(s.MaxMessageSize, s.MaxDatagramSize)
+	lastSweep := time.Now()
+	for {
+		n, addr, err := conn.ReadFrom(buffer)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		if now.Sub(lastSweep) > time.Second {
+			s.sweep(now)
+			lastSweep = now
+		}
+		h, ok := parseHeader(buffer[:n], count)
+		if !ok || h.kind != typeRequest || addr == nil {
+			continue
+		}
+		key := requestKey{addr: addr.String(), id: h.id}
+
+		s.mutex.Lock()
+		r, ok := s.requests[key]
+		if !ok {
+			if s.assembling >= s.MaxReassemblies || s.assemblingAddrs[key.addr] >= s.MaxReassembliesPerAddr {
+				s.mutex.Unlock()
+				continue
+			}
+			s.assembling++
+			s.assemblingAddrs[key.addr]++
+			r = &request{assembly: newReassembly(h.count, s.MaxMessageSize), expires: now.Add(s.ReassemblyTimeout)}
+			s.requests[key] = r
+		}
+		switch {
+		case r.response != nil:
+			// 処理済みのリクエストの再送なので、レスポンスが失われたとみなして送り直す
+			// 分割されたリクエストでは断片ごとに送り直さないように、先頭の断片が届いたときだけ送る
+			response := r.response
+			s.mutex.Unlock()
+			if h.index == 0 {
+				s.send(conn, response, addr)
+			}
+		case r.assembly == nil:
+			// ハンドラーが処理中なので、終わったら送るレスポンスを待ってもらう
+			s.mutex.Unlock()
+		case r.assembly.add(h, buffer[headerSize:n]):
+			message := r.assembly.message()
+			r.assembly = nil
+			s.doneAssembling(key.addr)
+			s.mutex.Unlock()
+			go s.handle(conn, key, message, addr)
+		default:
+			s.mutex.Unlock()
+		}
+	}
+}
+
+func (s *Server) handle(conn net.PacketConn, key requestKey, message []byte, addr net.Addr) {
+	packets, err := fragment(typeResponse, key.id, s.Handler(message, addr), s.MaxDatagramSize)
+	if err != nil {
+		// 大きすぎるレスポンスは返せないので、クライアントはタイムアウトする
+		s.mutex.Lock()
+		delete(s.requests, key)
+		s.mutex.Unlock()
+		return
+	}
+	s.mutex.Lock()
+	if r, ok := s.requests[key]; ok {
+		r.response = packets
+		r.expires = time.Now().Add(s.DedupWindow)
+	}
+	s.mutex.Unlock()
+	s.send(conn, packets, addr)
+}
+
+func (s *Server) send(conn net.PacketConn, packets [][]byte, addr net.Addr) {
+	for _, packet := range packets {
+		// 送信に失敗しても、クライアントが再送してくれば送り直せる
+		if _, err := conn.WriteTo(packet, addr); err != nil {
+			return
+		}
+	}
+}
+
+// 期限切れのレスポンスと組み立て途中のリクエストを捨てる
+func (s *Server) sweep(now time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for key, r := range s.requests {
+		// ハンドラーが処理中のものは残す
+		if r.assembly == nil && r.response == nil {
+			continue
+		}
+		if now.After(r.expires) {
+			if r.assembly != nil {
+				s.doneAssembling(key.addr)
+			}
+			delete(s.requests, key)
+		}
+	}
+}
+
+// 組み立て途中のリクエストの数を減らす
+// s.mutexをロックしてから呼ぶ
+func (s *Server) doneAssembling(addr string) {
+	s.assembling--
+	if s.assemblingAddrs[addr]--; s.assemblingAddrs[addr] == 0 {
+		delete(s.assemblingAddrs, addr)
+	}
+}
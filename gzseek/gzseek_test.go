@@ -0,0 +1,169 @@
+package gzseek
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+// 1行ずつ番号の付いたログ
+func testLog(lines int) []byte {
+	var buffer bytes.Buffer
+	for i := 0; i < lines; i++ {
+		fmt.Fprintf(&buffer, "%06d gzip.Writer example\n", i)
+	}
+	return buffer.Bytes()
+}
+
+func compress(t *testing.T, data []byte, blockSize int, flushes ...int) []byte {
+	var buffer bytes.Buffer
+	w, err := NewWriterLevel(&buffer, gzip.BestSpeed, blockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Name = "test.log"
+	start := 0
+	for _, end := range append(flushes, len(data)) {
+		if _, err := w.Write(data[start:end]); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		start = end
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func TestGunzip(t *testing.T) {
+	data := testLog(10000)
+	compressed := compress(t, data, 4096, 100, 5000)
+	// 普通のgzipとして全体を展開できる
+	gz, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gz.Name != "test.log" {
+		t.Errorf("got name %q", gz.Name)
+	}
+	got, err := ioutil.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("decompressed data does not match")
+	}
+}
+
+func TestReadAt(t *testing.T) {
+	data := testLog(10000)
+	compressed := compress(t, data, 4096, 100, 5000)
+	// 索引がある場合と、索引が失われてメンバーのヘッダーから作り直す場合
+	indexed, err := NewReader(bytes.NewReader(compressed), int64(len(compressed)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	truncated := compressed[:len(compressed)-locatorSize-1]
+	scanned, err := NewReader(bytes.NewReader(truncated), int64(len(truncated)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []*Reader{indexed, scanned} {
+		if r.Size() != int64(len(data)) {
+			t.Fatalf("got size %d, want %d", r.Size(), len(data))
+		}
+		if r.Blocks() < len(data)/4096 {
+			t.Fatalf("got %d blocks", r.Blocks())
+		}
+		for _, off := range []int64{0, 99, 100, 4095, 4096, 5000, 123456, int64(len(data)) - 10} {
+			p := make([]byte, 5000)
+			n, err := r.ReadAt(p, off)
+			want := data[off:]
+			if len(want) > len(p) {
+				want = want[:len(p)]
+			} else if err != io.EOF {
+				t.Errorf("ReadAt(%d): got %v, want io.EOF", off, err)
+			}
+			if !bytes.Equal(p[:n], want) {
+				t.Errorf("ReadAt(%d): got %q...", off, p[:20])
+			}
+		}
+	}
+}
+
+func TestSeek(t *testing.T) {
+	data := testLog(3000)
+	compressed := compress(t, data, 1000)
+	r, err := NewReader(bytes.NewReader(compressed), int64(len(compressed)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 2000行目から
+	if _, err := r.Seek(2000*27, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	line := make([]byte, 27)
+	if _, err := io.ReadFull(r, line); err != nil || string(line) != "002000 gzip.Writer example\n" {
+		t.Fatalf("got %q, %v", line, err)
+	}
+	if _, err := r.Seek(-27, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	rest, err := ioutil.ReadAll(r)
+	if err != nil || string(rest) != "002999 gzip.Writer example\n" {
+		t.Fatalf("got %q, %v", rest, err)
+	}
+}
+
+func TestEmpty(t *testing.T) {
+	compressed := compress(t, nil, DefaultBlockSize)
+	r, err := NewReader(bytes.NewReader(compressed), int64(len(compressed)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Size() != 0 {
+		t.Fatalf("got size %d", r.Size())
+	}
+	if _, err := r.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("got %v, want io.EOF", err)
+	}
+}
+
+func TestNotSeekable(t *testing.T) {
+	var buffer bytes.Buffer
+	gz := gzip.NewWriter(&buffer)
+	_, _ = gz.Write(testLog(10))
+	_ = gz.Close()
+	if _, err := NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len())); err != ErrNotSeekable {
+		t.Fatalf("got %v, want ErrNotSeekable", err)
+	}
+}
+
+func TestCorruptIndex(t *testing.T) {
+	compressed := compress(t, testLog(1000), 4096)
+	size := int64(len(compressed))
+	// ロケーターのメンバーの拡張フィールドのデータは、ヘッダー(12バイト)とサブフィールドのヘッダー(4バイト)のあと
+	locator := compressed[size-locatorSize+16:]
+	indexOffset := int64(binary.LittleEndian.Uint64(locator))
+	// 索引の展開後の位置を全て5ずらし、展開後の大きさも合わせて5増やす
+	for offset := indexOffset; offset < size-locatorSize; {
+		extra := int64(binary.LittleEndian.Uint16(compressed[offset+10:]))
+		entries := compressed[offset+16 : offset+12+extra]
+		for i := 0; i < len(entries); i += entrySize {
+			uoffset := entries[i+8:]
+			binary.LittleEndian.PutUint64(uoffset, binary.LittleEndian.Uint64(uoffset)+5)
+		}
+		offset += 12 + extra + 10
+	}
+	binary.LittleEndian.PutUint64(locator[8:], binary.LittleEndian.Uint64(locator[8:])+5)
+	if _, err := NewReader(bytes.NewReader(compressed), size); err != ErrCorrupt {
+		t.Fatalf("got %v, want ErrCorrupt", err)
+	}
+}
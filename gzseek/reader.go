@@ -0,0 +1,253 @@
+package gzseek
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"sync"
+)
+
+var (
+	ErrNotSeekable = errors.New("gzseek: not a seekable gzip file")
+	ErrCorrupt     = errors.New("gzseek: corrupt file")
+)
+
+// ランダムアクセスできるgzipファイルを、展開後のデータに対するio.ReaderAt、io.ReadSeekerとして読む
+// 索引を使って必要なメンバーだけを展開する
+type Reader struct {
+	r      io.ReaderAt
+	blocks []block
+	size   int64
+	// Read()とSeek()の位置
+	offset int64
+
+	// 最後に展開したブロック(同じブロックを続けて読むことが多いので残しておく)
+	mu     sync.Mutex
+	cached int
+	cache  []byte
+}
+
+// sizeはファイルの大きさ(*os.FileならStat()のSize())
+// 末尾のロケーターから索引を読む。索引が失われている場合は、各メンバーのヘッダーをたどって索引を作り直す
+func NewReader(r io.ReaderAt, size int64) (*Reader, error) {
+	reader := &Reader{r: r, cached: -1}
+	err := reader.readIndex(size)
+	if err == ErrNotSeekable {
+		err = reader.scan(size)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return reader, nil
+}
+
+// 展開後の大きさ
+func (r *Reader) Size() int64 {
+	return r.size
+}
+
+// ブロックの数
+func (r *Reader) Blocks() int {
+	return len(r.blocks)
+}
+
+// 拡張フィールドだけを持つメンバーのヘッダーを読み、指定したIDのサブフィールドのデータを返す
+func readExtra(r io.ReaderAt, offset int64, id [2]byte) ([]byte, int64, error) {
+	header := make([]byte, 12)
+	if _, err := r.ReadAt(header, offset); err != nil {
+		return nil, 0, ErrNotSeekable
+	}
+	if header[0] != 0x1f || header[1] != 0x8b || header[2] != 8 || header[3]&0x04 == 0 {
+		return nil, 0, ErrNotSeekable
+	}
+	extra := make([]byte, binary.LittleEndian.Uint16(header[10:]))
+	if _, err := r.ReadAt(extra, offset+12); err != nil {
+		return nil, 0, ErrNotSeekable
+	}
+	for len(extra) >= 4 {
+		n := int(binary.LittleEndian.Uint16(extra[2:]))
+		if 4+n > len(extra) {
+			break
+		}
+		if extra[0] == id[0] && extra[1] == id[1] {
+			return extra[4 : 4+n], int64(12 + len(extra)), nil
+		}
+		extra = extra[4+n:]
+	}
+	return nil, 0, ErrNotSeekable
+}
+
+func (r *Reader) readIndex(size int64) error {
+	if size < locatorSize {
+		return ErrNotSeekable
+	}
+	locator, _, err := readExtra(r.r, size-locatorSize, locatorID)
+	if err != nil || len(locator) != 16 {
+		return ErrNotSeekable
+	}
+	indexOffset := int64(binary.LittleEndian.Uint64(locator))
+	r.size = int64(binary.LittleEndian.Uint64(locator[8:]))
+	if indexOffset < 0 || indexOffset > size-locatorSize {
+		return ErrCorrupt
+	}
+	// 索引のメンバーは空のdeflateとCRC、大きさ(10バイト)で終わる
+	for offset := indexOffset; offset < size-locatorSize; {
+		entries, headerSize, err := readExtra(r.r, offset, indexID)
+		if err != nil || len(entries)%entrySize != 0 {
+			return ErrCorrupt
+		}
+		for i := 0; i < len(entries); i += entrySize {
+			r.blocks = append(r.blocks, block{
+				offset:  int64(binary.LittleEndian.Uint64(entries[i:])),
+				uoffset: int64(binary.LittleEndian.Uint64(entries[i+8:])),
+			})
+		}
+		offset += headerSize + 10
+	}
+	// 索引は先頭のブロックから、ファイルの中の位置と展開後の位置の順に並んでいる
+	// そうでない索引を信じると、ReadAt()が負の位置やブロックの外を読もうとする
+	if r.size < 0 {
+		return ErrCorrupt
+	}
+	if len(r.blocks) == 0 {
+		if r.size != 0 {
+			return ErrCorrupt
+		}
+		return nil
+	}
+	if r.blocks[0].offset != 0 || r.blocks[0].uoffset != 0 {
+		return ErrCorrupt
+	}
+	// 各ブロックの大きさは次のブロックの位置との差なので、位置が減っていれば負になる
+	for i := range r.blocks {
+		next, unext := indexOffset, r.size
+		if i+1 < len(r.blocks) {
+			next, unext = r.blocks[i+1].offset, r.blocks[i+1].uoffset
+		}
+		b := &r.blocks[i]
+		b.size, b.usize = next-b.offset, unext-b.uoffset
+		if b.size <= 0 || b.usize < 0 {
+			return ErrCorrupt
+		}
+	}
+	return nil
+}
+
+// 先頭から各メンバーのヘッダーの"SZ"をたどって索引を作る
+// 索引やロケーターを書く前に中断したファイル(Flush()までのデータ)も読める
+func (r *Reader) scan(size int64) error {
+	var offset, uoffset int64
+	for offset < size {
+		sizes, _, err := readExtra(r.r, offset, sizeID)
+		if err != nil || len(sizes) != 8 {
+			if offset > 0 {
+				// 最後の索引のメンバーなど、"SZ"のないメンバーで終わる
+				break
+			}
+			return ErrNotSeekable
+		}
+		b := block{
+			offset:  offset,
+			size:    int64(binary.LittleEndian.Uint32(sizes)),
+			uoffset: uoffset,
+			usize:   int64(binary.LittleEndian.Uint32(sizes[4:])),
+		}
+		if b.size <= 0 || offset+b.size > size {
+			return ErrCorrupt
+		}
+		r.blocks = append(r.blocks, b)
+		offset += b.size
+		uoffset += b.usize
+	}
+	r.size = uoffset
+	return nil
+}
+
+// i番目のブロックを展開する
+func (r *Reader) block(i int) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cached == i {
+		return r.cache, nil
+	}
+	b := r.blocks[i]
+	gz, err := gzip.NewReader(io.NewSectionReader(r.r, b.offset, b.size))
+	if err != nil {
+		return nil, fmt.Errorf("gzseek: block %d: %v", i, err)
+	}
+	// 次のメンバーまで読み進めない
+	gz.Multistream(false)
+	data, err := ioutil.ReadAll(gz)
+	if err != nil {
+		return nil, fmt.Errorf("gzseek: block %d: %v", i, err)
+	}
+	if int64(len(data)) != b.usize {
+		return nil, fmt.Errorf("%w: block %d has %d bytes, want %d", ErrCorrupt, i, len(data), b.usize)
+	}
+	r.cached, r.cache = i, data
+	return data, nil
+}
+
+// 展開後のoffの位置から読む(io.ReaderAt)
+func (r *Reader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("gzseek: negative offset")
+	}
+	// offを含むブロック
+	i := sort.Search(len(r.blocks), func(i int) bool {
+		return r.blocks[i].uoffset+r.blocks[i].usize > off
+	})
+	n := 0
+	for n < len(p) {
+		if i >= len(r.blocks) || off >= r.size {
+			return n, io.EOF
+		}
+		data, err := r.block(i)
+		if err != nil {
+			return n, err
+		}
+		m := copy(p[n:], data[off-r.blocks[i].uoffset:])
+		n += m
+		off += int64(m)
+		i++
+	}
+	return n, nil
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	n, err := r.ReadAt(p, r.offset)
+	r.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, errors.New("gzseek: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("gzseek: negative position")
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+// ファイル全体を展開せずに、指定した範囲だけを読む
+func (r *Reader) Section(off, n int64) *io.SectionReader {
+	return io.NewSectionReader(r, off, n)
+}
@@ -0,0 +1,225 @@
+// gzseekパッケージはランダムアクセスできるgzipファイルを読み書きする
+// write.goのgzip.Writerはファイル全体を1つのストリームとして圧縮するので、途中を読むには先頭から展開するしかない
+// ここでは元のデータをBlockSizeごとに別々のgzipのメンバーとして圧縮し、最後に各メンバーの位置の索引を付ける
+// gzipは複数のメンバーをつなげたものも1つのファイルとして展開できるので、gunzipやzcatでもそのまま読める
+//
+// ファイルの構造
+//
+//	データのメンバー × N: ヘッダーの拡張フィールド(サブフィールドID "SZ")に、メンバーの大きさと展開後の大きさを持つ
+//	索引のメンバー × M: 展開すると空になるメンバーで、拡張フィールド("IX")に各データのメンバーの位置と展開後の位置を持つ
+//	ロケーター: 展開すると空になる固定長のメンバーで、拡張フィールド("IL")に最初の索引のメンバーの位置と展開後の全体の大きさを持つ
+//
+// 数値は全てリトルエンディアン(gzipのヘッダーに合わせる)
+package gzseek
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"time"
+)
+
+const (
+	// 既定のブロックの大きさ(展開後)
+	// 小さいほどランダムアクセスは速くなるが、圧縮率は下がる
+	DefaultBlockSize = 64 * 1024
+	// ブロックの大きさはヘッダーに32ビットで書くので、32ビット環境のintにも収まる2GB未満にする
+	MaxBlockSize = 1<<31 - 1
+
+	// データのメンバーのヘッダーの拡張フィールドで、メンバーの大きさの位置
+	// ヘッダー(10バイト) + XLEN(2バイト) + サブフィールドのIDと長さ(4バイト)
+	sizeFieldOffset = 16
+	// 索引の1項目の大きさ(メンバーの位置と展開後の位置)
+	entrySize = 16
+	// 索引のメンバー1つに入る項目の数(拡張フィールドは65535バイトまで)
+	entriesPerMember = (0xffff - 4) / entrySize
+	// ロケーターの大きさ: ヘッダー(10) + XLEN(2) + サブフィールド(4 + 16) + 空のdeflate(2) + CRCと大きさ(8)
+	locatorSize = 42
+)
+
+var (
+	sizeID    = [2]byte{'S', 'Z'}
+	indexID   = [2]byte{'I', 'X'}
+	locatorID = [2]byte{'I', 'L'}
+)
+
+var ErrClosed = errors.New("gzseek: writer is closed")
+
+// 索引の1項目
+type block struct {
+	// メンバーの先頭の位置と大きさ
+	offset int64
+	size   int64
+	// 展開後の先頭の位置と大きさ
+	uoffset int64
+	usize   int64
+}
+
+// ランダムアクセスできるgzipファイルを書き出す
+// Close()を呼ぶまで索引が書かれないので、必ず呼ぶ
+type Writer struct {
+	// 最初のメンバーのヘッダーに書く元のファイル名と更新日時(gzip.Headerと同じ)
+	Name    string
+	ModTime time.Time
+
+	w         io.Writer
+	blockSize int
+	// まだ圧縮していないデータ
+	pending []byte
+	// 圧縮したメンバーを作る場所
+	buffer bytes.Buffer
+	gz     *gzip.Writer
+	blocks []block
+	// 書き出したメンバーの合計と、展開後の合計
+	offset  int64
+	uoffset int64
+	closed  bool
+}
+
+func NewWriter(w io.Writer) *Writer {
+	writer, _ := NewWriterLevel(w, gzip.DefaultCompression, DefaultBlockSize)
+	return writer
+}
+
+// 圧縮レベルはgzip.NewWriterLevel()と同じ
+func NewWriterLevel(w io.Writer, level, blockSize int) (*Writer, error) {
+	if blockSize <= 0 || blockSize > MaxBlockSize {
+		return nil, errors.New("gzseek: invalid block size")
+	}
+	gz, err := gzip.NewWriterLevel(nil, level)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{w: w, blockSize: blockSize, gz: gz}, nil
+}
+
+// ブロックの大きさに達するごとに1つのメンバーとして圧縮して書き出す
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, ErrClosed
+	}
+	n := len(p)
+	for len(p) > 0 {
+		m := w.blockSize - len(w.pending)
+		if m > len(p) {
+			m = len(p)
+		}
+		w.pending = append(w.pending, p[:m]...)
+		p = p[m:]
+		if len(w.pending) == w.blockSize {
+			if err := w.writeBlock(); err != nil {
+				return n - len(p), err
+			}
+		}
+	}
+	return n, nil
+}
+
+// 書きかけのブロックを短いメンバーとして書き出す
+// ログのように少しずつ書く場合に、ここまでをgunzipなどで読めるようにする(索引はClose()まで書かれない)
+func (w *Writer) Flush() error {
+	if w.closed {
+		return ErrClosed
+	}
+	if len(w.pending) == 0 {
+		return nil
+	}
+	return w.writeBlock()
+}
+
+func (w *Writer) writeBlock() error {
+	w.buffer.Reset()
+	w.gz.Reset(&w.buffer)
+	// メンバーの大きさは圧縮するまでわからないので、0で埋めておいてあとで書き換える
+	w.gz.Header.Extra = subfield(sizeID, make([]byte, 8))
+	if len(w.blocks) == 0 {
+		w.gz.Header.Name = w.Name
+		w.gz.Header.ModTime = w.ModTime
+	}
+	if _, err := w.gz.Write(w.pending); err != nil {
+		return err
+	}
+	if err := w.gz.Close(); err != nil {
+		return err
+	}
+	member := w.buffer.Bytes()
+	binary.LittleEndian.PutUint32(member[sizeFieldOffset:], uint32(len(member)))
+	binary.LittleEndian.PutUint32(member[sizeFieldOffset+4:], uint32(len(w.pending)))
+	if _, err := w.w.Write(member); err != nil {
+		return err
+	}
+	w.blocks = append(w.blocks, block{offset: w.offset, size: int64(len(member)), uoffset: w.uoffset, usize: int64(len(w.pending))})
+	w.offset += int64(len(member))
+	w.uoffset += int64(len(w.pending))
+	w.pending = w.pending[:0]
+	return nil
+}
+
+// 残りのデータと索引、ロケーターを書き出す。元のio.Writerは閉じない
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	w.closed = true
+	indexOffset := w.offset
+	for start := 0; start < len(w.blocks) || start == 0; start += entriesPerMember {
+		end := start + entriesPerMember
+		if end > len(w.blocks) {
+			end = len(w.blocks)
+		}
+		entries := make([]byte, entrySize*(end-start))
+		for i, b := range w.blocks[start:end] {
+			binary.LittleEndian.PutUint64(entries[i*entrySize:], uint64(b.offset))
+			binary.LittleEndian.PutUint64(entries[i*entrySize+8:], uint64(b.uoffset))
+		}
+		member := emptyMember(subfield(indexID, entries))
+		if _, err := w.w.Write(member); err != nil {
+			return err
+		}
+		w.offset += int64(len(member))
+		if end == len(w.blocks) {
+			break
+		}
+	}
+	locator := make([]byte, 16)
+	binary.LittleEndian.PutUint64(locator, uint64(indexOffset))
+	binary.LittleEndian.PutUint64(locator[8:], uint64(w.uoffset))
+	_, err := w.w.Write(emptyMember(subfield(locatorID, locator)))
+	return err
+}
+
+// gzipのヘッダーの拡張フィールドのサブフィールド(ID 2バイト、長さ2バイト、データ)
+func subfield(id [2]byte, data []byte) []byte {
+	b := make([]byte, 4, 4+len(data))
+	copy(b, id[:])
+	binary.LittleEndian.PutUint16(b[2:], uint16(len(data)))
+	return append(b, data...)
+}
+
+// 展開すると空になるgzipのメンバー
+// 圧縮ライブラリの出力に左右されないように、固定のバイト列で作る
+func emptyMember(extra []byte) []byte {
+	b := []byte{
+		0x1f, 0x8b, // マジックナンバー
+		8,          // deflate
+		0x04,       // FEXTRA
+		0, 0, 0, 0, // 更新日時
+		0,    // XFL
+		0xff, // OS(不明)
+		0, 0, // XLEN
+	}
+	binary.LittleEndian.PutUint16(b[10:], uint16(len(extra)))
+	b = append(b, extra...)
+	// 空の最終ブロック(固定ハフマン符号でブロックの終わりだけ)
+	b = append(b, 0x03, 0x00)
+	// 空のデータのCRC-32と大きさ
+	trailer := make([]byte, 8)
+	binary.LittleEndian.PutUint32(trailer, crc32.ChecksumIEEE(nil))
+	return append(b, trailer...)
+}
@@ -0,0 +1,53 @@
+// atomicfileパッケージは、ファイルを一時ファイルに書き出してからリネームして丸ごと置き換える
+// cmd/pngtext、cmd/pngstrip、cmd/pngstego、cmd/kenallで、出力先に入力と同じファイルを指定できるようにするために使う
+package atomicfile
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// pathをfが書き出した内容に置き換え、パーミッションをmodeにする(umaskは適用されない)
+// rename(2)は同じファイルシステムの中でしかアトミックにならないので、一時ファイルは同じディレクトリに作る
+// 入力と同じファイルを指定しても、読み終わるまで元のファイルは残っている
+// 途中でエラーになった場合は書きかけのファイルを残さない
+func WriteFile(path string, mode os.FileMode, f func(w io.Writer) error) error {
+	// 一時ファイルは0600で作られるので、書き込み中に他のユーザーから読まれることはない
+	file, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// リネームに成功していれば一時ファイルはもうない
+		_ = os.Remove(file.Name())
+	}()
+	if err := f(file); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Chmod(mode); err != nil {
+		_ = file.Close()
+		return err
+	}
+	// リネームしたあとに電源が落ちても中身が空にならないように、先にディスクに書き出す
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// pathのパーミッションを返す。ファイルがなければdefaultModeを返す
+// 既存のファイルを置き換えるときに、元のパーミッションを引き継ぐために使う
+func Mode(path string, defaultMode os.FileMode) os.FileMode {
+	info, err := os.Stat(path)
+	if err != nil {
+		return defaultMode
+	}
+	return info.Mode().Perm()
+}
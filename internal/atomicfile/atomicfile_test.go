@@ -0,0 +1,77 @@
+package atomicfile
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestWriteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atomicfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	path := filepath.Join(dir, "secret.png")
+	if err := ioutil.WriteFile(path, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// 元のファイルを読みながら同じファイルに書き出せて、パーミッションも引き継げる
+	src, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = src.Close()
+	}()
+	err = WriteFile(path, Mode(path, 0644), func(w io.Writer) error {
+		if _, err := io.Copy(w, src); err != nil {
+			return err
+		}
+		_, err := io.WriteString(w, "+new")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil || string(b) != "old+new" {
+		t.Fatalf("got %q, %v", b, err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Errorf("got mode %v, want 0600", info.Mode().Perm())
+	}
+	if mode := Mode(filepath.Join(dir, "missing"), 0644); mode != 0644 {
+		t.Errorf("got default mode %v", mode)
+	}
+
+	// 失敗したら元のファイルはそのままで、一時ファイルも残らない
+	failure := errors.New("failure")
+	if err := WriteFile(path, 0644, func(w io.Writer) error {
+		_, _ = io.WriteString(w, "partial")
+		return failure
+	}); err != failure {
+		t.Fatalf("got %v, want %v", err, failure)
+	}
+	if b, _ := ioutil.ReadFile(path); string(b) != "old+new" {
+		t.Errorf("file was modified: %q", b)
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 {
+		t.Errorf("temporary file remains: %d files", len(infos))
+	}
+}
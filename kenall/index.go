@@ -0,0 +1,118 @@
+package kenall
+
+import (
+	"io"
+	"sort"
+	"strings"
+)
+
+// 郵便番号と住所の検索に必要な操作
+// メモリ上のIndexとファイルをマップしたMappedIndexで検索の処理を共有する
+type table interface {
+	Len() int
+	// 郵便番号順でi番目のレコードの郵便番号
+	zip(i int) string
+	// 住所順でi番目のレコードの住所と、郵便番号順での番号
+	address(i int) (string, int)
+	record(i int) *Record
+}
+
+// 郵便番号がzipで始まるレコードを返す
+// 7桁なら完全に一致するもの、3桁なら「100」で始まる全ての郵便番号になる。ハイフンは無視する
+func lookup(t table, zip string) []*Record {
+	zip = strings.Replace(zip, "-", "", -1)
+	if zip == "" {
+		return nil
+	}
+	n := t.Len()
+	start := sort.Search(n, func(i int) bool {
+		return t.zip(i) >= zip
+	})
+	var records []*Record
+	for i := start; i < n && strings.HasPrefix(t.zip(i), zip); i++ {
+		records = append(records, t.record(i))
+	}
+	return records
+}
+
+// 住所(都道府県名 + 市区町村名 + 町域名)がprefixで始まるレコードを返す
+func searchPrefix(t table, prefix string) []*Record {
+	if prefix == "" {
+		return nil
+	}
+	n := t.Len()
+	start := sort.Search(n, func(i int) bool {
+		address, _ := t.address(i)
+		return address >= prefix
+	})
+	var records []*Record
+	for i := start; i < n; i++ {
+		address, j := t.address(i)
+		if !strings.HasPrefix(address, prefix) {
+			break
+		}
+		records = append(records, t.record(j))
+	}
+	return records
+}
+
+// メモリ上の索引
+type Index struct {
+	// 郵便番号順
+	records []*Record
+	// 住所順に並べたrecordsの番号
+	addresses []int
+}
+
+// レコードから索引を作る
+func NewIndex(records []*Record) *Index {
+	index := &Index{records: append([]*Record(nil), records...)}
+	// 同じ郵便番号の中ではファイルの順番を保つ
+	sort.SliceStable(index.records, func(i, j int) bool {
+		return index.records[i].Zip < index.records[j].Zip
+	})
+	index.addresses = make([]int, len(index.records))
+	for i := range index.addresses {
+		index.addresses[i] = i
+	}
+	sort.SliceStable(index.addresses, func(i, j int) bool {
+		return index.records[index.addresses[i]].Address() < index.records[index.addresses[j]].Address()
+	})
+	return index
+}
+
+// Shift_JISのKEN_ALL.CSVを読み込んで索引を作る
+func Load(r io.Reader) (*Index, error) {
+	records, err := ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return NewIndex(records), nil
+}
+
+func (x *Index) Len() int {
+	return len(x.records)
+}
+
+func (x *Index) zip(i int) string {
+	return x.records[i].Zip
+}
+
+func (x *Index) address(i int) (string, int) {
+	j := x.addresses[i]
+	return x.records[j].Address(), j
+}
+
+func (x *Index) record(i int) *Record {
+	return x.records[i]
+}
+
+// 郵便番号(またはその先頭の数桁)で検索する
+func (x *Index) Lookup(zip string) []*Record {
+	return lookup(x, zip)
+}
+
+// 住所の前方一致で検索する
+func (x *Index) SearchPrefix(prefix string) []*Record {
+	return searchPrefix(x, prefix)
+}
@@ -0,0 +1,158 @@
+// kenallパッケージは日本郵便の郵便番号データ(KEN_ALL.CSV)を読み込み、郵便番号と住所で検索する
+// read.goのcsvSourceと同じ形式で、ファイルはShift_JISで書かれている
+// 町域名が長いと複数の行に分割されているので、1つのRecordにまとめて返す
+//
+//	https://www.post.japanpost.jp/zipcode/dl/readme.html
+package kenall
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"system-programming/charset"
+	"system-programming/csvcodec"
+)
+
+// 更新の表示
+const (
+	NotUpdated = 0
+	Updated    = 1
+	Abolished  = 2
+)
+
+// 町域名に書かれている、町域がない場合の説明
+const (
+	TownNotListed  = "以下に掲載がない場合"
+	TownFollowedBy = "の次に番地がくる場合"
+)
+
+// KEN_ALL.CSVの1行(分割された行はまとめたもの)
+type Record struct {
+	// 全国地方公共団体コード(JIS X0401、X0402)
+	Code string `csv:",index=0"`
+	// 旧郵便番号(5桁)
+	OldZip string `csv:",index=1"`
+	// 郵便番号(7桁)
+	Zip            string `csv:",index=2"`
+	PrefectureKana string `csv:",index=3"`
+	CityKana       string `csv:",index=4"`
+	TownKana       string `csv:",index=5"`
+	Prefecture     string `csv:",index=6"`
+	City           string `csv:",index=7"`
+	Town           string `csv:",index=8"`
+	// 一町域が二以上の郵便番号で表される
+	PartialTown bool `csv:",index=9"`
+	// 小字毎に番地が起番されている
+	Koaza bool `csv:",index=10"`
+	// 丁目を有する
+	Chome bool `csv:",index=11"`
+	// 一つの郵便番号で二以上の町域を表す
+	MultipleTowns bool `csv:",index=12"`
+	// 更新の表示(NotUpdated、Updated、Abolished)
+	Update int `csv:",index=13"`
+	// 変更理由(0: 変更なし、1: 市政・区政・町政・分区・政令指定都市施行、2: 住居表示の実施、3: 区画整理、
+	// 4: 郵便区調整等、5: 訂正、6: 廃止)
+	Reason int `csv:",index=14"`
+}
+
+// 町域名が実際の町域ではなく「以下に掲載がない場合」「○○の次に番地がくる場合」「○○町一円」のような説明であれば空文字列を返す
+// 滋賀県には「一円」という町域が実在するので、それだけは残す
+func (r *Record) TownName() string {
+	if r.Town == TownNotListed || strings.HasSuffix(r.Town, TownFollowedBy) || strings.HasSuffix(r.Town, "一円") && r.Town != "一円" {
+		return ""
+	}
+	return r.Town
+}
+
+// 都道府県名、市区町村名、町域名をつなげた住所
+func (r *Record) Address() string {
+	return r.Prefecture + r.City + r.TownName()
+}
+
+func (r *Record) String() string {
+	if len(r.Zip) != 7 {
+		return fmt.Sprintf("〒%s %s", r.Zip, r.Address())
+	}
+	return fmt.Sprintf("〒%s-%s %s", r.Zip[:3], r.Zip[3:], r.Address())
+}
+
+// KEN_ALL.CSVを1件ずつ読む
+type Reader struct {
+	decoder *csvcodec.Decoder
+	// 分割された行をまとめるときに先読みした次のレコード
+	pending *Record
+}
+
+// Shift_JISのKEN_ALL.CSVを読む
+func NewReader(r io.Reader) *Reader {
+	reader := NewUTF8Reader(r)
+	reader.decoder.Charset = charset.ShiftJIS
+	return reader
+}
+
+// UTF-8に変換済みのデータを読む
+func NewUTF8Reader(r io.Reader) *Reader {
+	decoder := csvcodec.NewDecoder(r)
+	decoder.NoHeader = true
+	return &Reader{decoder: decoder}
+}
+
+// 次のレコードを返す。終わりに達するとio.EOFを返す
+// 町域名の「（」が閉じていない行は、同じ郵便番号の続きの行と町域名をつなげる
+func (r *Reader) Read() (*Record, error) {
+	record, err := r.next()
+	if err != nil {
+		return nil, err
+	}
+	lastKana := record.TownKana
+	for strings.Contains(record.Town, "（") && !strings.Contains(record.Town, "）") {
+		next, err := r.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if next.Zip != record.Zip || next.Code != record.Code {
+			r.pending = next
+			break
+		}
+		record.Town += next.Town
+		// 読み仮名は続きの行に同じものが繰り返されていることがある
+		if next.TownKana != lastKana {
+			record.TownKana += next.TownKana
+			lastKana = next.TownKana
+		}
+	}
+	return record, nil
+}
+
+func (r *Reader) next() (*Record, error) {
+	if r.pending != nil {
+		record := r.pending
+		r.pending = nil
+		return record, nil
+	}
+	record := &Record{}
+	if err := r.decoder.Decode(record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// 全てのレコードを読み込む
+func ReadAll(r io.Reader) ([]*Record, error) {
+	reader := NewReader(r)
+	var records []*Record
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+}
@@ -0,0 +1,142 @@
+package kenall
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"golang.org/x/text/encoding/japanese"
+)
+
+// KEN_ALL.CSVからの抜粋(千歳市の町域名は3行に分割されている)
+const source = `01224,"066  ","0660005","ﾎｯｶｲﾄﾞｳ","ﾁﾄｾｼ","ｷｮｳﾜ(88-2､271-10､343-2､404-1､427-3､","北海道","千歳市","協和（８８－２、２７１－１０、３４３－２、４０４－１、４２７－３、",1,0,0,0,0,0
+01224,"066  ","0660005","ﾎｯｶｲﾄﾞｳ","ﾁﾄｾｼ","431-12､443-6､608-2､641-8､814､842-5､1137-3､","北海道","千歳市","４３１－１２、４４３－６、６０８－２、６４１－８、８１４、８４２－５、１１３７－３、",1,0,0,0,0,0
+01224,"066  ","0660005","ﾎｯｶｲﾄﾞｳ","ﾁﾄｾｼ","1392､1657､1752ﾊﾞﾝﾁ)","北海道","千歳市","１３９２、１６５７、１７５２番地）",1,0,0,0,0,0
+01224,"066  ","0660001","ﾎｯｶｲﾄﾞｳ","ﾁﾄｾｼ","ｷｮｳﾜ","北海道","千歳市","協和",1,0,0,0,0,0
+13101,"100  ","1000000","ﾄｳｷｮｳﾄ","ﾁﾖﾀﾞｸ","ｲｶﾆｹｲｻｲｶﾞﾅｲﾊﾞｱｲ","東京都","千代田区","以下に掲載がない場合",0,0,0,0,0,0
+13101,"102  ","1020072","ﾄｳｷｮｳﾄ","ﾁﾖﾀﾞｸ","ｲｲﾀﾞﾊﾞｼ","東京都","千代田区","飯田橋",0,0,1,0,0,0
+13101,"100  ","1000003","ﾄｳｷｮｳﾄ","ﾁﾖﾀﾞｸ","ﾋﾄﾂﾊﾞｼ(1ﾁｮｳﾒ)","東京都","千代田区","一ツ橋（１丁目）",1,0,1,0,0,0
+13101,"101  ","1010003","ﾄｳｷｮｳﾄ","ﾁﾖﾀﾞｸ","ﾋﾄﾂﾊﾞｼ(2ﾁｮｳﾒ)","東京都","千代田区","一ツ橋（２丁目）",1,0,1,0,0,0
+`
+
+func loadIndex(t *testing.T) *Index {
+	sjis, err := japanese.ShiftJIS.NewEncoder().Bytes([]byte(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := Load(bytes.NewReader(sjis))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return index
+}
+
+func zips(records []*Record) []string {
+	var zips []string
+	for _, r := range records {
+		zips = append(zips, r.Zip)
+	}
+	return zips
+}
+
+func TestReader(t *testing.T) {
+	index := loadIndex(t)
+	if index.Len() != 6 {
+		t.Fatalf("got %d records, want 6", index.Len())
+	}
+	records := index.Lookup("066-0005")
+	if len(records) != 1 {
+		t.Fatalf("got %d records, want 1", len(records))
+	}
+	r := records[0]
+	if r.Town != "協和（８８－２、２７１－１０、３４３－２、４０４－１、４２７－３、４３１－１２、４４３－６、６０８－２、６４１－８、８１４、８４２－５、１１３７－３、１３９２、１６５７、１７５２番地）" {
+		t.Errorf("town not joined: %s", r.Town)
+	}
+	if r.TownKana != "ｷｮｳﾜ(88-2､271-10､343-2､404-1､427-3､431-12､443-6､608-2､641-8､814､842-5､1137-3､1392､1657､1752ﾊﾞﾝﾁ)" {
+		t.Errorf("kana not joined: %s", r.TownKana)
+	}
+	if r.Code != "01224" || r.OldZip != "066  " || !r.PartialTown || r.Chome {
+		t.Errorf("unexpected record %+v", r)
+	}
+	if got := index.Lookup("1000000")[0].String(); got != "〒100-0000 東京都千代田区" {
+		t.Errorf("got %s", got)
+	}
+}
+
+func testIndex(t *testing.T, index interface {
+	Lookup(string) []*Record
+	SearchPrefix(string) []*Record
+}) {
+	tests := []struct {
+		query  string
+		prefix bool
+		want   []string
+	}{
+		{"1000003", false, []string{"1000003"}},
+		{"100", false, []string{"1000000", "1000003"}},
+		{"1", false, []string{"1000000", "1000003", "1010003", "1020072"}},
+		{"9999999", false, nil},
+		{"東京都千代田区一ツ橋", true, []string{"1000003", "1010003"}},
+		{"東京都千代田区", true, []string{"1000000", "1000003", "1010003", "1020072"}},
+		{"北海道千歳市協和", true, []string{"0660001", "0660005"}},
+		{"大阪府", true, nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		if tt.prefix {
+			got = zips(index.SearchPrefix(tt.query))
+		} else {
+			got = zips(index.Lookup(tt.query))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestIndex(t *testing.T) {
+	testIndex(t, loadIndex(t))
+}
+
+func TestMappedIndex(t *testing.T) {
+	index := loadIndex(t)
+	dir, err := ioutil.TempDir("", "kenall")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	path := filepath.Join(dir, "ken_all.idx")
+	var buffer bytes.Buffer
+	if _, err := index.WriteTo(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, buffer.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mapped, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = mapped.Close()
+	}()
+	testIndex(t, mapped)
+	for i := 0; i < index.Len(); i++ {
+		if got, want := mapped.record(i), index.record(i); !reflect.DeepEqual(got, want) {
+			t.Errorf("got %+v, want %+v", got, want)
+		}
+	}
+
+	// 壊れたファイル
+	if err := ioutil.WriteFile(path, buffer.Bytes()[:buffer.Len()-1], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path); err != ErrFormat {
+		t.Errorf("truncated: got %v", err)
+	}
+}
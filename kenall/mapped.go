@@ -0,0 +1,242 @@
+package kenall
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/edsrzf/mmap-go"
+)
+
+// 索引ファイルの形式(数値はビッグエンディアン)
+//
+//	ヘッダー(16バイト): マジック(8バイト)、レコード数(4バイト)、文字列領域の大きさ(4バイト)
+//	レコード(56バイト × レコード数、郵便番号順):
+//		団体コード(5バイト)、旧郵便番号(5バイト)、郵便番号(7バイト)、フラグ(1バイト)、更新の表示(1バイト)、変更理由(1バイト)、
+//		6つの文字列の文字列領域での位置(4バイト)と長さ(2バイト)
+//		(都道府県名カナ、市区町村名カナ、町域名カナ、都道府県名、市区町村名、町域名の順)
+//	住所順の索引(4バイト × レコード数): 郵便番号順でのレコードの番号
+//	文字列領域: UTF-8の文字列を重複を除いて並べたもの
+//
+// ファイルをメモリにマップすれば、読み込みや解析をせずにそのまま二分探索できる
+const (
+	magic      = "KENALL\x00\x01"
+	headerSize = 16
+	entrySize  = 56
+	// 6つの文字列の位置と長さの先頭
+	stringsOffset = 20
+)
+
+// フラグのビット
+const (
+	flagPartialTown = 1 << iota
+	flagKoaza
+	flagChome
+	flagMultipleTowns
+)
+
+var ErrFormat = errors.New("kenall: invalid index file")
+
+// 索引ファイルの形式で書き出す
+func (x *Index) WriteTo(w io.Writer) (int64, error) {
+	// 文字列の重複を除く(都道府県名や市区町村名はほとんどが重複している)
+	var table []byte
+	offsets := make(map[string]uint32)
+	intern := func(s string) (uint32, error) {
+		if len(s) > 0xffff {
+			return 0, fmt.Errorf("kenall: string too long: %q", s)
+		}
+		if offset, ok := offsets[s]; ok {
+			return offset, nil
+		}
+		offset := uint32(len(table))
+		offsets[s] = offset
+		table = append(table, s...)
+		return offset, nil
+	}
+	entries := make([]byte, entrySize*len(x.records))
+	for i, r := range x.records {
+		e := entries[i*entrySize : (i+1)*entrySize]
+		for _, f := range []struct {
+			value string
+			b     []byte
+		}{{r.Code, e[0:5]}, {r.OldZip, e[5:10]}, {r.Zip, e[10:17]}} {
+			if len(f.value) > len(f.b) {
+				return 0, fmt.Errorf("kenall: %q is longer than %d bytes", f.value, len(f.b))
+			}
+			copy(f.b, f.value)
+		}
+		var flags byte
+		if r.PartialTown {
+			flags |= flagPartialTown
+		}
+		if r.Koaza {
+			flags |= flagKoaza
+		}
+		if r.Chome {
+			flags |= flagChome
+		}
+		if r.MultipleTowns {
+			flags |= flagMultipleTowns
+		}
+		e[17], e[18], e[19] = flags, byte(r.Update), byte(r.Reason)
+		for k, s := range []string{r.PrefectureKana, r.CityKana, r.TownKana, r.Prefecture, r.City, r.Town} {
+			offset, err := intern(s)
+			if err != nil {
+				return 0, err
+			}
+			p := e[stringsOffset+k*6:]
+			binary.BigEndian.PutUint32(p, offset)
+			binary.BigEndian.PutUint16(p[4:], uint16(len(s)))
+		}
+	}
+	addresses := make([]byte, 4*len(x.addresses))
+	for i, j := range x.addresses {
+		binary.BigEndian.PutUint32(addresses[i*4:], uint32(j))
+	}
+	header := make([]byte, headerSize)
+	copy(header, magic)
+	binary.BigEndian.PutUint32(header[8:], uint32(len(x.records)))
+	binary.BigEndian.PutUint32(header[12:], uint32(len(table)))
+
+	bw := bufio.NewWriter(w)
+	var n int64
+	for _, b := range [][]byte{header, entries, addresses, table} {
+		m, err := bw.Write(b)
+		n += int64(m)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, bw.Flush()
+}
+
+// 索引ファイルをメモリにマップしたもの
+type MappedIndex struct {
+	file      *os.File
+	m         mmap.MMap
+	count     int
+	entries   []byte
+	addresses []byte
+	strings   []byte
+}
+
+// WriteTo()で書き出した索引ファイルを開く
+func Open(path string) (*MappedIndex, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	m, err := mmap.Map(file, mmap.RDONLY, 0)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	x := &MappedIndex{file: file, m: m}
+	if err := x.parse(); err != nil {
+		_ = x.Close()
+		return nil, err
+	}
+	return x, nil
+}
+
+// 各領域の大きさを確かめてから分割する
+// 以降のアクセスで範囲外を読まないように、文字列の位置もここで全て確かめる
+func (x *MappedIndex) parse() error {
+	b := []byte(x.m)
+	if len(b) < headerSize || string(b[:8]) != magic {
+		return ErrFormat
+	}
+	count := int64(binary.BigEndian.Uint32(b[8:]))
+	stringsSize := int64(binary.BigEndian.Uint32(b[12:]))
+	if int64(len(b)) != headerSize+count*(entrySize+4)+stringsSize {
+		return ErrFormat
+	}
+	x.count = int(count)
+	x.entries = b[headerSize : headerSize+count*entrySize]
+	x.addresses = b[headerSize+count*entrySize : headerSize+count*(entrySize+4)]
+	x.strings = b[headerSize+count*(entrySize+4):]
+	for i := 0; i < x.count; i++ {
+		e := x.entries[i*entrySize:]
+		for k := 0; k < 6; k++ {
+			p := e[stringsOffset+k*6:]
+			if int64(binary.BigEndian.Uint32(p))+int64(binary.BigEndian.Uint16(p[4:])) > stringsSize {
+				return ErrFormat
+			}
+		}
+		if binary.BigEndian.Uint32(x.addresses[i*4:]) >= uint32(count) {
+			return ErrFormat
+		}
+	}
+	return nil
+}
+
+func (x *MappedIndex) Close() error {
+	err := x.m.Unmap()
+	if closeErr := x.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (x *MappedIndex) Len() int {
+	return x.count
+}
+
+func (x *MappedIndex) zip(i int) string {
+	return trimNull(x.entries[i*entrySize+10 : i*entrySize+17])
+}
+
+// k番目の文字列(都道府県名カナ、市区町村名カナ、町域名カナ、都道府県名、市区町村名、町域名)
+func (x *MappedIndex) text(i, k int) string {
+	p := x.entries[i*entrySize+stringsOffset+k*6:]
+	offset := binary.BigEndian.Uint32(p)
+	return string(x.strings[offset : offset+uint32(binary.BigEndian.Uint16(p[4:]))])
+}
+
+func (x *MappedIndex) address(i int) (string, int) {
+	j := int(binary.BigEndian.Uint32(x.addresses[i*4:]))
+	r := Record{Prefecture: x.text(j, 3), City: x.text(j, 4), Town: x.text(j, 5)}
+	return r.Address(), j
+}
+
+func (x *MappedIndex) record(i int) *Record {
+	e := x.entries[i*entrySize : (i+1)*entrySize]
+	return &Record{
+		Code:           trimNull(e[0:5]),
+		OldZip:         trimNull(e[5:10]),
+		Zip:            trimNull(e[10:17]),
+		PrefectureKana: x.text(i, 0),
+		CityKana:       x.text(i, 1),
+		TownKana:       x.text(i, 2),
+		Prefecture:     x.text(i, 3),
+		City:           x.text(i, 4),
+		Town:           x.text(i, 5),
+		PartialTown:    e[17]&flagPartialTown != 0,
+		Koaza:          e[17]&flagKoaza != 0,
+		Chome:          e[17]&flagChome != 0,
+		MultipleTowns:  e[17]&flagMultipleTowns != 0,
+		Update:         int(e[18]),
+		Reason:         int(e[19]),
+	}
+}
+
+// 郵便番号(またはその先頭の数桁)で検索する
+func (x *MappedIndex) Lookup(zip string) []*Record {
+	return lookup(x, zip)
+}
+
+// 住所の前方一致で検索する
+func (x *MappedIndex) SearchPrefix(prefix string) []*Record {
+	return searchPrefix(x, prefix)
+}
+
+func trimNull(b []byte) string {
+	for len(b) > 0 && b[len(b)-1] == 0 {
+		b = b[:len(b)-1]
+	}
+	return string(b)
+}
@@ -0,0 +1,150 @@
+// pngchunkパッケージはPNGファイルをチャンク単位で読み書きする
+// read.goのreadChunks、dumpChunk、textChunkをパッケージとして切り出したもの
+//
+// PNGファイルはシグニチャ(8バイト)のあとにチャンクが並んだ構造になっていて、各チャンクは次の形式
+//
+//	長さ(4バイト、ビッグエンディアン) + 種類(4バイト) + データ(長さ分) + CRC(4バイト)
+//
+// CRCは種類とデータを合わせたものに対して計算する
+package pngchunk
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// PNGファイルの先頭の8バイト
+const Signature = "\x89PNG\r\n\x1a\n"
+
+// チャンクのデータの長さの上限(PNGの仕様で2^31-1まで)
+const MaxLength = 1<<31 - 1
+
+var (
+	ErrSignature = errors.New("pngchunk: not a PNG file")
+	ErrCRC       = errors.New("pngchunk: CRC mismatch")
+	ErrLength    = errors.New("pngchunk: chunk too large")
+	ErrType      = errors.New("pngchunk: invalid chunk type")
+	ErrOrder     = errors.New("pngchunk: invalid chunk order")
+)
+
+// チャンクの種類(IHDR、IDAT、tEXtなど)
+// 4文字の大文字と小文字で性質を表している
+type Type string
+
+func (t Type) bit(i int) bool {
+	return len(t) == 4 && t[i]&0x20 == 0
+}
+
+// 1文字目が大文字なら、画像の表示に必須の重要チャンク(IHDR、PLTE、IDAT、IEND)
+func (t Type) IsCritical() bool {
+	return t.bit(0)
+}
+
+// 2文字目が大文字なら、仕様で定められた公開チャンク。小文字ならアプリケーション独自の非公開チャンク
+func (t Type) IsPublic() bool {
+	return t.bit(1)
+}
+
+// 4文字目が小文字なら、画像のデータを変更したエディタでもそのままコピーしてよい
+func (t Type) IsSafeToCopy() bool {
+	return !t.bit(3)
+}
+
+// 4文字ともASCIIの英字で、予約されている3文字目が大文字であるか
+func (t Type) Valid() bool {
+	if len(t) != 4 {
+		return false
+	}
+	for i := 0; i < 4; i++ {
+		c := t[i]
+		if !('A' <= c && c <= 'Z' || 'a' <= c && c <= 'z') {
+			return false
+		}
+	}
+	return t.bit(2)
+}
+
+// チャンクの先頭(長さと種類)
+// Offsetはファイル先頭からの長さのフィールドの位置で、ファイルから読み込んだもの以外は-1
+type Header struct {
+	Offset int64
+	Length uint32
+	Type   Type
+}
+
+// 長さと種類、CRCを含めたチャンク全体の大きさ
+func (h Header) Size() int64 {
+	return int64(h.Length) + 12
+}
+
+type Chunk struct {
+	Header
+	Data []byte
+	// ファイルから読み込んだ場合は記録されていた値、New()で作った場合は計算した値
+	CRC uint32
+}
+
+// 種類とデータからCRCを計算してチャンクを作る
+func New(t Type, data []byte) *Chunk {
+	return &Chunk{
+		Header: Header{Offset: -1, Length: uint32(len(data)), Type: t},
+		Data:   data,
+		CRC:    ComputeCRC(t, data),
+	}
+}
+
+// 種類とデータのCRC-32(IEEE)
+func ComputeCRC(t Type, data []byte) uint32 {
+	crc := crc32.NewIEEE()
+	_, _ = io.WriteString(crc, string(t))
+	_, _ = crc.Write(data)
+	return crc.Sum32()
+}
+
+// 記録されているCRCがデータと一致しているか
+func (c *Chunk) ValidCRC() bool {
+	return c.CRC == ComputeCRC(c.Type, c.Data)
+}
+
+func (c *Chunk) String() string {
+	return fmt.Sprintf("chunk '%s', (%d bytes)", c.Type, c.Length)
+}
+
+// チャンクを読み書きするときのエラーに、位置と種類を付け加えたもの
+type ChunkError struct {
+	Offset int64
+	Type   Type
+	Err    error
+}
+
+func (e *ChunkError) Error() string {
+	if e.Type == "" {
+		return fmt.Sprintf("%v at offset %d", e.Err, e.Offset)
+	}
+	return fmt.Sprintf("%v in chunk '%s' at offset %d", e.Err, e.Type, e.Offset)
+}
+
+func (e *ChunkError) Unwrap() error {
+	return e.Err
+}
+
+func parseHeader(b []byte, offset int64) (Header, error) {
+	h := Header{
+		Offset: offset,
+		Length: binary.BigEndian.Uint32(b[:4]),
+		Type:   Type(b[4:8]),
+	}
+	if h.Length > MaxLength {
+		return h, &ChunkError{Offset: offset, Type: h.Type, Err: ErrLength}
+	}
+	// 予約ビット(3文字目)が小文字のものは未知のチャンクとして読み飛ばせるように、ここでは英字であるかだけを確かめる
+	for i := 0; i < 4; i++ {
+		if c := h.Type[i] | 0x20; c < 'a' || 'z' < c {
+			return h, &ChunkError{Offset: offset, Err: ErrType}
+		}
+	}
+	return h, nil
+}
@@ -0,0 +1,199 @@
+package pngchunk
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+)
+
+// io.ReaderからPNGのチャンクを順番に読み込む
+// ファイル全体をメモリに読み込まないので、パイプやネットワークから届くPNGにも使える
+//
+//	decoder := pngchunk.NewDecoder(reader)
+//	for {
+//		chunk, err := decoder.Next()
+//		if err == io.EOF {
+//			break
+//		}
+//		...
+//	}
+type Decoder struct {
+	r      io.Reader
+	offset int64
+	// シグニチャを読み込んだか
+	started bool
+	// IENDを読み込んだか
+	ended bool
+	// 読み込み中のチャンク
+	current   Header
+	remaining int64
+	crc       hash.Hash32
+	verified  bool
+	// 現在のチャンクに記録されていたCRC
+	stored uint32
+	// trueならCRCを確かめない
+	IgnoreCRC bool
+}
+
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: r}
+}
+
+// 現在の位置(ファイルの先頭からのバイト数)
+func (d *Decoder) Offset() int64 {
+	return d.offset
+}
+
+func (d *Decoder) readFull(b []byte) error {
+	n, err := io.ReadFull(d.r, b)
+	d.offset += int64(n)
+	return err
+}
+
+func (d *Decoder) start() error {
+	if d.started {
+		return nil
+	}
+	d.started = true
+	signature := make([]byte, len(Signature))
+	if err := d.readFull(signature); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return ErrSignature
+		}
+		return err
+	}
+	if string(signature) != Signature {
+		return ErrSignature
+	}
+	return nil
+}
+
+// 次のチャンクの長さと種類を読み込む
+// 前のチャンクのデータを読み終えていなければ、残りを読み捨ててCRCを確かめる
+// IENDのあとはio.EOFを返し、IENDより前にファイルが終わった場合はio.ErrUnexpectedEOFを返す
+// データはRead()で少しずつ読み込めるので、大きなチャンクもメモリに載せずに扱える
+func (d *Decoder) NextHeader() (Header, error) {
+	if err := d.start(); err != nil {
+		return Header{}, err
+	}
+	if err := d.finish(); err != nil {
+		return Header{}, err
+	}
+	if d.ended {
+		return Header{}, io.EOF
+	}
+	b := make([]byte, 8)
+	offset := d.offset
+	if err := d.readFull(b); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return Header{}, err
+	}
+	h, err := parseHeader(b, offset)
+	if err != nil {
+		return h, err
+	}
+	d.current = h
+	d.remaining = int64(h.Length)
+	d.crc = crc32.NewIEEE()
+	_, _ = io.WriteString(d.crc, string(h.Type))
+	d.verified = false
+	if h.Type == "IEND" {
+		d.ended = true
+	}
+	return h, nil
+}
+
+// 現在のチャンクのデータを読み込む
+// データの終わりでCRCを確かめて、一致しなければio.EOFの代わりにErrCRCを含むエラーを返す
+func (d *Decoder) Read(p []byte) (int, error) {
+	if d.remaining == 0 {
+		if err := d.verify(); err != nil {
+			return 0, err
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > d.remaining {
+		p = p[:d.remaining]
+	}
+	n, err := d.r.Read(p)
+	d.offset += int64(n)
+	d.remaining -= int64(n)
+	_, _ = d.crc.Write(p[:n])
+	if err == io.EOF {
+		if d.remaining > 0 {
+			return n, io.ErrUnexpectedEOF
+		}
+		err = nil
+	}
+	return n, err
+}
+
+// データの後ろのCRCを読み込んで確かめる
+func (d *Decoder) verify() error {
+	if d.verified {
+		return nil
+	}
+	d.verified = true
+	b := make([]byte, 4)
+	if err := d.readFull(b); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	d.stored = binary.BigEndian.Uint32(b)
+	if !d.IgnoreCRC && d.stored != d.crc.Sum32() {
+		return &ChunkError{Offset: d.current.Offset, Type: d.current.Type, Err: ErrCRC}
+	}
+	return nil
+}
+
+// 現在のチャンクに記録されていたCRC
+// データを最後まで読み込んだあとでなければ0を返す
+func (d *Decoder) CRC() uint32 {
+	if !d.verified {
+		return 0
+	}
+	return d.stored
+}
+
+func (d *Decoder) finish() error {
+	if d.current.Type == "" {
+		return nil
+	}
+	if d.remaining > 0 {
+		if _, err := io.Copy(ioutil.Discard, d); err != nil {
+			return err
+		}
+	}
+	return d.verify()
+}
+
+// 次のチャンクをデータごと読み込む
+// CRCが一致しない場合は、読み込んだチャンクとErrCRCを含むエラーを両方返す
+func (d *Decoder) Next() (*Chunk, error) {
+	h, err := d.NextHeader()
+	if err != nil {
+		return nil, err
+	}
+	return d.readChunk(h)
+}
+
+// NextHeader()で読み込んだチャンクの残りのデータを読み込む
+func (d *Decoder) readChunk(h Header) (*Chunk, error) {
+	// 長さのフィールドが壊れていても巨大なバッファを確保しないように、実際に読めた分だけ伸ばす
+	data, err := ioutil.ReadAll(d)
+	c := &Chunk{Header: h, Data: data, CRC: d.stored}
+	if err != nil {
+		if errors.Is(err, ErrCRC) {
+			return c, err
+		}
+		return nil, err
+	}
+	return c, nil
+}
@@ -0,0 +1,99 @@
+package pngchunk
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+)
+
+// io.WriterにPNGのチャンクを書き込む
+// 最初の書き込みの前にシグニチャを書き込み、CRCは常に書き込むデータから計算する
+type Encoder struct {
+	w       io.Writer
+	started bool
+	offset  int64
+	// 最後に書き込んだチャンクのCRC
+	crc uint32
+}
+
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// これまでに書き込んだバイト数
+func (e *Encoder) Offset() int64 {
+	return e.offset
+}
+
+// 最後に書き込んだチャンクのCRC
+func (e *Encoder) CRC() uint32 {
+	return e.crc
+}
+
+func (e *Encoder) write(b []byte) error {
+	n, err := e.w.Write(b)
+	e.offset += int64(n)
+	return err
+}
+
+func (e *Encoder) start() error {
+	if e.started {
+		return nil
+	}
+	e.started = true
+	return e.write([]byte(Signature))
+}
+
+// 種類とデータからチャンクを書き込む
+func (e *Encoder) WriteChunk(t Type, data []byte) error {
+	if int64(len(data)) > MaxLength {
+		return &ChunkError{Offset: e.offset, Type: t, Err: ErrLength}
+	}
+	if err := e.start(); err != nil {
+		return err
+	}
+	b := make([]byte, 12+len(data))
+	binary.BigEndian.PutUint32(b, uint32(len(data)))
+	copy(b[4:], t)
+	copy(b[8:], data)
+	e.crc = ComputeCRC(t, data)
+	binary.BigEndian.PutUint32(b[8+len(data):], e.crc)
+	return e.write(b)
+}
+
+// チャンクを書き込む
+// Chunk.CRCは使わずに計算し直すので、読み込んだチャンクのデータを書き換えてもそのまま書き込める
+func (e *Encoder) Write(c *Chunk) error {
+	return e.WriteChunk(c.Type, c.Data)
+}
+
+// 長さがlengthのデータをrから読みながらチャンクを書き込む
+// データ全体をメモリに載せないので、大きなIDATチャンクなどのコピーに使う
+func (e *Encoder) WriteChunkFrom(t Type, length uint32, r io.Reader) error {
+	if length > MaxLength {
+		return &ChunkError{Offset: e.offset, Type: t, Err: ErrLength}
+	}
+	if err := e.start(); err != nil {
+		return err
+	}
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header, length)
+	copy(header[4:], t)
+	if err := e.write(header); err != nil {
+		return err
+	}
+	crc := crc32.NewIEEE()
+	_, _ = io.WriteString(crc, string(t))
+	n, err := io.Copy(io.MultiWriter(e.w, crc), io.LimitReader(r, int64(length)))
+	e.offset += n
+	if err != nil {
+		return err
+	}
+	if n != int64(length) {
+		return io.ErrUnexpectedEOF
+	}
+	e.crc = crc.Sum32()
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, e.crc)
+	return e.write(b)
+}
@@ -0,0 +1,61 @@
+package pngchunk
+
+import (
+	"io"
+	"io/ioutil"
+)
+
+// Strip()で重要チャンク以外に残すチャンクの既定値
+// 画像の見た目(色や透過、縦横比)に影響するものとAPNGのアニメーションだけを残し、
+// テキスト(tEXt、zTXt、iTXt)、Exif(eXIf)、更新日時(tIME)などの撮影者や環境についての情報は捨てる
+var DefaultKeep = []Type{
+	"tRNS", "gAMA", "cHRM", "sRGB", "iCCP", "sBIT", "pHYs",
+	"acTL", "fcTL", "fdAT",
+}
+
+// rのPNGをwに書き写しながら、keepがfalseを返したチャンクを取り除く
+// 重要チャンク(IHDR、PLTE、IDAT、IENDなど)は取り除くと画像が読めなくなるので、keepに関係なく常に残す
+// チャンクは1つずつデータを流しながらコピーするので、ファイル全体やチャンク全体をメモリに載せることはない
+// 読み込んだチャンクのCRCと、書き出したデータから計算したCRCを比べて、一致しなければErrCRCを含むエラーを返す
+// 戻り値は取り除いたチャンク
+func Filter(w io.Writer, r io.Reader, keep func(Header) bool) ([]Header, error) {
+	decoder := NewDecoder(r)
+	encoder := NewEncoder(w)
+	var dropped []Header
+	for {
+		h, err := decoder.NextHeader()
+		if err == io.EOF {
+			return dropped, nil
+		}
+		if err != nil {
+			return dropped, err
+		}
+		if !h.Type.IsCritical() && !keep(h) {
+			dropped = append(dropped, h)
+			continue
+		}
+		if err := encoder.WriteChunkFrom(h.Type, h.Length, decoder); err != nil {
+			return dropped, err
+		}
+		// データを読み終えているので、ここでDecoderがファイルに記録されていたCRCを読んで確かめる
+		if _, err := io.Copy(ioutil.Discard, decoder); err != nil {
+			return dropped, err
+		}
+		if encoder.CRC() != decoder.CRC() {
+			return dropped, &ChunkError{Offset: encoder.Offset() - h.Size(), Type: h.Type, Err: ErrCRC}
+		}
+	}
+}
+
+// 重要チャンクと、keepに含まれる種類のチャンクだけを残す
+//
+//	dropped, err := pngchunk.Strip(w, r, pngchunk.DefaultKeep...)
+func Strip(w io.Writer, r io.Reader, keep ...Type) ([]Header, error) {
+	allowed := make(map[Type]bool)
+	for _, t := range keep {
+		allowed[t] = true
+	}
+	return Filter(w, r, func(h Header) bool {
+		return allowed[h.Type]
+	})
+}
@@ -0,0 +1,60 @@
+package pngchunk
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"testing"
+)
+
+func TestStrip(t *testing.T) {
+	// secret.pngはimg.pngにtEXtを1つ追加したもの
+	secret, err := ioutil.ReadFile("../secret.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buffer bytes.Buffer
+	dropped, err := Strip(&buffer, bytes.NewReader(secret), DefaultKeep...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dropped) != 1 || dropped[0].Type != TypeText {
+		t.Errorf("dropped = %v", dropped)
+	}
+	if !bytes.Equal(buffer.Bytes(), readImage(t)) {
+		t.Error("stripped secret.png differs from img.png")
+	}
+
+	// 許可したものは残る
+	buffer.Reset()
+	dropped, err = Strip(&buffer, bytes.NewReader(secret), TypeText)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dropped) != 0 || !bytes.Equal(buffer.Bytes(), secret) {
+		t.Errorf("allowlisted chunk was removed: %v", dropped)
+	}
+
+	// 重要チャンクはkeepがfalseを返しても残る
+	image := buildPNG(t, "IHDR", "tIME", "eXIf", "IDAT", "IEND")
+	buffer.Reset()
+	dropped, err = Filter(&buffer, bytes.NewReader(image), func(Header) bool { return false })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dropped) != 2 {
+		t.Errorf("dropped = %v", dropped)
+	}
+	if !bytes.Equal(buffer.Bytes(), buildPNG(t, "IHDR", "IDAT", "IEND")) {
+		t.Error("critical chunks were not preserved")
+	}
+}
+
+func TestStripCorrupt(t *testing.T) {
+	image := readImage(t)
+	image[len(image)-20] ^= 0xff
+	var buffer bytes.Buffer
+	if _, err := Strip(&buffer, bytes.NewReader(image)); !errors.Is(err, ErrCRC) {
+		t.Errorf("error = %v, want ErrCRC", err)
+	}
+}
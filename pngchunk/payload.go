@@ -0,0 +1,262 @@
+package pngchunk
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrPayload = errors.New("pngchunk: malformed chunk data")
+
+// カラータイプ(IHDR)
+type ColorType uint8
+
+const (
+	Grayscale      ColorType = 0
+	Truecolor      ColorType = 2
+	Indexed        ColorType = 3
+	GrayscaleAlpha ColorType = 4
+	TruecolorAlpha ColorType = 6
+)
+
+func (c ColorType) String() string {
+	switch c {
+	case Grayscale:
+		return "grayscale"
+	case Truecolor:
+		return "truecolor"
+	case Indexed:
+		return "indexed"
+	case GrayscaleAlpha:
+		return "grayscale+alpha"
+	case TruecolorAlpha:
+		return "truecolor+alpha"
+	}
+	return fmt.Sprintf("unknown(%d)", uint8(c))
+}
+
+func (c ColorType) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// IHDR: 画像の大きさと、ピクセルの形式
+type ImageHeader struct {
+	Width       uint32    `json:"width"`
+	Height      uint32    `json:"height"`
+	BitDepth    uint8     `json:"bit_depth"`
+	ColorType   ColorType `json:"color_type"`
+	Compression uint8     `json:"compression"`
+	Filter      uint8     `json:"filter"`
+	Interlace   uint8     `json:"interlace"`
+}
+
+func (h *ImageHeader) String() string {
+	s := fmt.Sprintf("%dx%d, %d-bit %s", h.Width, h.Height, h.BitDepth, h.ColorType)
+	if h.Interlace == 1 {
+		s += ", interlaced"
+	}
+	return s
+}
+
+type RGB struct {
+	R uint8 `json:"r"`
+	G uint8 `json:"g"`
+	B uint8 `json:"b"`
+}
+
+// PLTE: インデックスカラーのパレット(最大256色)
+type Palette []RGB
+
+func (p Palette) String() string {
+	s := fmt.Sprintf("%d entries", len(p))
+	for i, c := range p {
+		if i == 8 {
+			return s + " ..."
+		}
+		s += fmt.Sprintf(" #%02x%02x%02x", c.R, c.G, c.B)
+	}
+	return s
+}
+
+// gAMA: ガンマ値(ファイルには100000倍した整数で記録されている)
+type Gamma float64
+
+func (g Gamma) String() string {
+	return fmt.Sprintf("gamma %.5f", float64(g))
+}
+
+// pHYs: ピクセルの物理的な大きさ
+// Unitが1ならピクセル/メートル、0なら縦横比だけを表す
+type PhysicalDimensions struct {
+	X    uint32 `json:"x"`
+	Y    uint32 `json:"y"`
+	Unit uint8  `json:"unit"`
+}
+
+// 1インチ(0.0254メートル)あたりのピクセル数
+func (p *PhysicalDimensions) DPI() (x, y float64) {
+	if p.Unit != 1 {
+		return 0, 0
+	}
+	return float64(p.X) * 0.0254, float64(p.Y) * 0.0254
+}
+
+func (p *PhysicalDimensions) String() string {
+	if p.Unit != 1 {
+		return fmt.Sprintf("aspect ratio %d:%d", p.X, p.Y)
+	}
+	x, y := p.DPI()
+	return fmt.Sprintf("%dx%d pixels/meter (%.0fx%.0f dpi)", p.X, p.Y, x, y)
+}
+
+// iCCP: 埋め込まれたICCプロファイル
+// プロファイル本体は大きくなることがあるので、名前と展開後の大きさだけを持つ
+type ICCProfile struct {
+	Name           string `json:"name"`
+	CompressedSize int    `json:"compressed_size"`
+	Size           int    `json:"size"`
+}
+
+func (p *ICCProfile) String() string {
+	return fmt.Sprintf("profile %q (%d bytes, %d compressed)", p.Name, p.Size, p.CompressedSize)
+}
+
+// acTL: APNGのフレーム数と繰り返し回数(0なら無限)
+type AnimationControl struct {
+	Frames uint32 `json:"frames"`
+	Plays  uint32 `json:"plays"`
+}
+
+func (a *AnimationControl) String() string {
+	return fmt.Sprintf("%d frames, %d plays", a.Frames, a.Plays)
+}
+
+// fcTL: APNGの各フレームの位置と表示時間
+type FrameControl struct {
+	Sequence  uint32 `json:"sequence"`
+	Width     uint32 `json:"width"`
+	Height    uint32 `json:"height"`
+	XOffset   uint32 `json:"x_offset"`
+	YOffset   uint32 `json:"y_offset"`
+	DelayNum  uint16 `json:"delay_num"`
+	DelayDen  uint16 `json:"delay_den"`
+	DisposeOp uint8  `json:"dispose_op"`
+	BlendOp   uint8  `json:"blend_op"`
+}
+
+// フレームの表示時間(DelayNum/DelayDen秒、DelayDenが0なら1/100秒単位)
+func (f *FrameControl) Delay() time.Duration {
+	den := f.DelayDen
+	if den == 0 {
+		den = 100
+	}
+	return time.Duration(f.DelayNum) * time.Second / time.Duration(den)
+}
+
+func (f *FrameControl) String() string {
+	return fmt.Sprintf("#%d %dx%d+%d+%d, delay %v, dispose %d, blend %d",
+		f.Sequence, f.Width, f.Height, f.XOffset, f.YOffset, f.Delay(), f.DisposeOp, f.BlendOp)
+}
+
+// ParsePayload()が解釈する種類のチャンクならtrueを返す
+// falseのチャンクはデータを読まずに読み捨てて良い
+func HasPayload(t Type) bool {
+	switch t {
+	case "IHDR", "PLTE", "gAMA", "pHYs", "tIME", "iCCP", "acTL", "fcTL", TypeText, TypeCompressedText, TypeInternational:
+		return true
+	}
+	return false
+}
+
+// チャンクのデータを種類に応じた型に変換する
+//   - IHDR: *ImageHeader
+//   - PLTE: Palette
+//   - gAMA: Gamma
+//   - pHYs: *PhysicalDimensions
+//   - tIME: time.Time(UTC)
+//   - iCCP: *ICCProfile
+//   - acTL: *AnimationControl
+//   - fcTL: *FrameControl
+//   - tEXt、zTXt、iTXt: *Text
+//
+// 知らない種類のチャンクにはnilを返す
+func ParsePayload(c *Chunk) (interface{}, error) {
+	fail := func() (interface{}, error) {
+		return nil, &ChunkError{Offset: c.Offset, Type: c.Type, Err: ErrPayload}
+	}
+	b := c.Data
+	be := binary.BigEndian
+	switch c.Type {
+	case "IHDR":
+		if len(b) != 13 {
+			return fail()
+		}
+		return &ImageHeader{
+			Width:       be.Uint32(b[0:]),
+			Height:      be.Uint32(b[4:]),
+			BitDepth:    b[8],
+			ColorType:   ColorType(b[9]),
+			Compression: b[10],
+			Filter:      b[11],
+			Interlace:   b[12],
+		}, nil
+	case "PLTE":
+		if len(b) == 0 || len(b)%3 != 0 || len(b) > 256*3 {
+			return fail()
+		}
+		palette := make(Palette, len(b)/3)
+		for i := range palette {
+			palette[i] = RGB{b[i*3], b[i*3+1], b[i*3+2]}
+		}
+		return palette, nil
+	case "gAMA":
+		if len(b) != 4 {
+			return fail()
+		}
+		return Gamma(float64(be.Uint32(b)) / 100000), nil
+	case "pHYs":
+		if len(b) != 9 {
+			return fail()
+		}
+		return &PhysicalDimensions{X: be.Uint32(b[0:]), Y: be.Uint32(b[4:]), Unit: b[8]}, nil
+	case "tIME":
+		if len(b) != 7 {
+			return fail()
+		}
+		return time.Date(int(be.Uint16(b)), time.Month(b[2]), int(b[3]), int(b[4]), int(b[5]), int(b[6]), 0, time.UTC), nil
+	case "iCCP":
+		name, rest, ok := cutNull(b)
+		if !ok || checkKeyword(name) != nil || len(rest) < 1 || rest[0] != 0 {
+			return fail()
+		}
+		profile, err := inflate(rest[1:])
+		if err != nil {
+			return nil, &ChunkError{Offset: c.Offset, Type: c.Type, Err: err}
+		}
+		return &ICCProfile{Name: fromLatin1(name), CompressedSize: len(rest) - 1, Size: len(profile)}, nil
+	case "acTL":
+		if len(b) != 8 {
+			return fail()
+		}
+		return &AnimationControl{Frames: be.Uint32(b[0:]), Plays: be.Uint32(b[4:])}, nil
+	case "fcTL":
+		if len(b) != 26 {
+			return fail()
+		}
+		return &FrameControl{
+			Sequence:  be.Uint32(b[0:]),
+			Width:     be.Uint32(b[4:]),
+			Height:    be.Uint32(b[8:]),
+			XOffset:   be.Uint32(b[12:]),
+			YOffset:   be.Uint32(b[16:]),
+			DelayNum:  be.Uint16(b[20:]),
+			DelayDen:  be.Uint16(b[22:]),
+			DisposeOp: b[24],
+			BlendOp:   b[25],
+		}, nil
+	case TypeText, TypeCompressedText, TypeInternational:
+		return ParseText(c)
+	}
+	return nil, nil
+}
@@ -0,0 +1,57 @@
+package pngchunk
+
+import (
+	"bytes"
+	"compress/zlib"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParsePayload(t *testing.T) {
+	var profile bytes.Buffer
+	profile.WriteString("sRGB\x00\x00")
+	writer := zlib.NewWriter(&profile)
+	_, _ = writer.Write(make([]byte, 3144))
+	_ = writer.Close()
+
+	tests := []struct {
+		typ  Type
+		data string
+		want interface{}
+	}{
+		{"IHDR", "\x00\x00\x02\x00\x00\x00\x01\x00\x08\x06\x00\x00\x01", &ImageHeader{Width: 512, Height: 256, BitDepth: 8, ColorType: TruecolorAlpha, Interlace: 1}},
+		{"PLTE", "\xff\x00\x00\x00\xff\x00", Palette{{255, 0, 0}, {0, 255, 0}}},
+		{"gAMA", "\x00\x00\xb1\x8f", Gamma(0.45455)},
+		{"pHYs", "\x00\x00\x0b\x13\x00\x00\x0b\x13\x01", &PhysicalDimensions{X: 2835, Y: 2835, Unit: 1}},
+		{"tIME", "\x07\xe5\x06\x07\x0c\x22\x38", time.Date(2021, 6, 7, 12, 34, 56, 0, time.UTC)},
+		{"iCCP", profile.String(), &ICCProfile{Name: "sRGB", CompressedSize: profile.Len() - 6, Size: 3144}},
+		{"acTL", "\x00\x00\x00\x03\x00\x00\x00\x00", &AnimationControl{Frames: 3}},
+		{"fcTL", "\x00\x00\x00\x01\x00\x00\x00\x10\x00\x00\x00\x08\x00\x00\x00\x02\x00\x00\x00\x04\x00\x01\x00\x0a\x01\x00",
+			&FrameControl{Sequence: 1, Width: 16, Height: 8, XOffset: 2, YOffset: 4, DelayNum: 1, DelayDen: 10, DisposeOp: 1}},
+		{"tEXt", "Comment\x00hello", &Text{Type: TypeText, Keyword: "Comment", Text: "hello"}},
+		{"prVt", "anything", nil},
+	}
+	for _, test := range tests {
+		got, err := ParsePayload(New(test.typ, []byte(test.data)))
+		if err != nil {
+			t.Errorf("%s: %v", test.typ, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %#v, want %#v", test.typ, got, test.want)
+		}
+		if HasPayload(test.typ) != (test.want != nil) {
+			t.Errorf("%s: HasPayload() = %v", test.typ, HasPayload(test.typ))
+		}
+	}
+	if d := (&FrameControl{DelayNum: 1, DelayDen: 10}).Delay(); d != 100*time.Millisecond {
+		t.Errorf("Delay() = %v", d)
+	}
+
+	for _, typ := range []Type{"IHDR", "PLTE", "gAMA", "pHYs", "tIME", "iCCP", "acTL", "fcTL"} {
+		if _, err := ParsePayload(New(typ, []byte("\x01"))); err == nil {
+			t.Errorf("%s: malformed data accepted", typ)
+		}
+	}
+}
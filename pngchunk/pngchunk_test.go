@@ -0,0 +1,199 @@
+package pngchunk
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func readImage(t *testing.T) []byte {
+	t.Helper()
+	b, err := ioutil.ReadFile("../img.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// 小さなPNGのチャンクの並びを作る
+func buildPNG(t *testing.T, types ...Type) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	encoder := NewEncoder(&buffer)
+	for _, typ := range types {
+		var data []byte
+		if typ == "IHDR" {
+			data = make([]byte, 13)
+		}
+		if err := encoder.WriteChunk(typ, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buffer.Bytes()
+}
+
+func TestDecoderRoundTrip(t *testing.T) {
+	image := readImage(t)
+	decoder := NewDecoder(bytes.NewReader(image))
+	var buffer bytes.Buffer
+	encoder := NewEncoder(&buffer)
+	var types []Type
+	for {
+		chunk, err := decoder.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if chunk.Offset != encoder.Offset() && encoder.Offset() != 0 {
+			t.Errorf("chunk %s offset = %d, want %d", chunk.Type, chunk.Offset, encoder.Offset())
+		}
+		types = append(types, chunk.Type)
+		if err := encoder.Write(chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if types[0] != "IHDR" || types[len(types)-1] != "IEND" {
+		t.Errorf("types = %v", types)
+	}
+	if !bytes.Equal(buffer.Bytes(), image) {
+		t.Error("re-encoded image differs from the original")
+	}
+	if err := Validate(bytes.NewReader(image)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReader(t *testing.T) {
+	image := readImage(t)
+	reader, err := NewReader(bytes.NewReader(image), int64(len(image)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reader.TrailingData() != 0 {
+		t.Errorf("TrailingData() = %d", reader.TrailingData())
+	}
+	if idat := reader.Find("IDAT"); len(idat) == 0 {
+		t.Error("no IDAT chunk")
+	}
+	// Section()をつなげると元のファイルに戻る
+	var buffer bytes.Buffer
+	buffer.WriteString(Signature)
+	for i := 0; i < reader.Len(); i++ {
+		if _, err := io.Copy(&buffer, reader.Section(i)); err != nil {
+			t.Fatal(err)
+		}
+		chunk, err := reader.Chunk(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(reader.Data(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, chunk.Data) {
+			t.Errorf("Data(%d) differs from Chunk(%d).Data", i, i)
+		}
+	}
+	if !bytes.Equal(buffer.Bytes(), image) {
+		t.Error("concatenated sections differ from the original")
+	}
+}
+
+func TestCorruptCRC(t *testing.T) {
+	image := readImage(t)
+	reader, err := NewReader(bytes.NewReader(image), int64(len(image)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 最初のIDATのデータを1バイト書き換える
+	h := reader.Headers()[reader.Find("IDAT")[0]]
+	image[h.Offset+8] ^= 0xff
+
+	if _, err := reader.Chunk(reader.Find("IDAT")[0]); !errors.Is(err, ErrCRC) {
+		t.Errorf("Reader.Chunk() error = %v, want ErrCRC", err)
+	}
+	err = Validate(bytes.NewReader(image))
+	var chunkError *ChunkError
+	if !errors.As(err, &chunkError) || !errors.Is(err, ErrCRC) {
+		t.Fatalf("Validate() error = %v, want ErrCRC", err)
+	}
+	if chunkError.Offset != h.Offset || chunkError.Type != "IDAT" {
+		t.Errorf("error at %d %s, want %d IDAT", chunkError.Offset, chunkError.Type, h.Offset)
+	}
+
+	decoder := NewDecoder(bytes.NewReader(image))
+	decoder.IgnoreCRC = true
+	for {
+		if _, err := decoder.Next(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("IgnoreCRC: %v", err)
+		}
+	}
+}
+
+func TestNotPNG(t *testing.T) {
+	// xxx.pngは拡張子がpngのJPEGファイル
+	b, err := ioutil.ReadFile("../xxx.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Validate(bytes.NewReader(b)); err != ErrSignature {
+		t.Errorf("Validate() error = %v, want ErrSignature", err)
+	}
+	if _, err := NewReader(bytes.NewReader(b), int64(len(b))); err != ErrSignature {
+		t.Errorf("NewReader() error = %v, want ErrSignature", err)
+	}
+}
+
+func TestValidateOrder(t *testing.T) {
+	tests := []struct {
+		types []Type
+		want  error
+	}{
+		{[]Type{"IHDR", "PLTE", "IDAT", "IDAT", "tEXt", "IEND"}, nil},
+		{[]Type{"IDAT", "IHDR", "IEND"}, ErrOrder},
+		{[]Type{"IHDR", "IHDR", "IDAT", "IEND"}, ErrOrder},
+		{[]Type{"IHDR", "IDAT", "PLTE", "IEND"}, ErrOrder},
+		{[]Type{"IHDR", "IDAT", "tEXt", "IDAT", "IEND"}, ErrOrder},
+		{[]Type{"IHDR", "IEND"}, ErrOrder},
+		{[]Type{"IHDR", "IDAT"}, io.ErrUnexpectedEOF},
+		{[]Type{"IHDR", "IDAT", "abcd", "IEND"}, ErrType},
+	}
+	for _, test := range tests {
+		err := Validate(bytes.NewReader(buildPNG(t, test.types...)))
+		if !errors.Is(err, test.want) && !(test.want == nil && err == nil) {
+			t.Errorf("%v: error = %v, want %v", test.types, err, test.want)
+		}
+	}
+
+	// 途中で切れたファイル
+	image := readImage(t)
+	if err := Validate(bytes.NewReader(image[:len(image)-20])); err != io.ErrUnexpectedEOF {
+		t.Errorf("truncated: error = %v, want io.ErrUnexpectedEOF", err)
+	}
+}
+
+func TestType(t *testing.T) {
+	tests := []struct {
+		typ                                 Type
+		critical, public, safeToCopy, valid bool
+	}{
+		{"IHDR", true, true, false, true},
+		{"tEXt", false, true, true, true},
+		{"prVt", false, false, true, true},
+		{"IDaT", true, true, false, false},
+		{"ID1T", true, true, false, false},
+	}
+	for _, test := range tests {
+		if test.typ.IsCritical() != test.critical || test.typ.IsPublic() != test.public ||
+			test.typ.IsSafeToCopy() != test.safeToCopy || test.typ.Valid() != test.valid {
+			t.Errorf("%s: got %v %v %v %v", test.typ,
+				test.typ.IsCritical(), test.typ.IsPublic(), test.typ.IsSafeToCopy(), test.typ.Valid())
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package pngchunk
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// io.ReaderAtからPNGのチャンクを読むもの
+// 最初にチャンクの長さと種類だけを読んで位置を覚えておき、データは必要になったときに読む
+// read.goのreadChunksと同じように、各チャンクをio.SectionReaderとして取り出せる
+type Reader struct {
+	r       io.ReaderAt
+	size    int64
+	headers []Header
+}
+
+// sizeはファイルの大きさ(*os.FileならStat()のSize())
+// シグニチャとチャンクの並びを読み込み、途中でファイルが終わっていればエラーを返す
+func NewReader(r io.ReaderAt, size int64) (*Reader, error) {
+	signature := make([]byte, len(Signature))
+	if _, err := r.ReadAt(signature, 0); err != nil || string(signature) != Signature {
+		return nil, ErrSignature
+	}
+	reader := &Reader{r: r, size: size}
+	b := make([]byte, 8)
+	for offset := int64(len(Signature)); offset < size; {
+		if _, err := r.ReadAt(b, offset); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		h, err := parseHeader(b, offset)
+		if err != nil {
+			return nil, err
+		}
+		if offset+h.Size() > size {
+			return nil, &ChunkError{Offset: offset, Type: h.Type, Err: io.ErrUnexpectedEOF}
+		}
+		reader.headers = append(reader.headers, h)
+		offset += h.Size()
+		// IENDの後ろに付け足されたデータはチャンクとして扱わない
+		if h.Type == "IEND" {
+			break
+		}
+	}
+	return reader, nil
+}
+
+func (r *Reader) Headers() []Header {
+	return r.headers
+}
+
+func (r *Reader) Len() int {
+	return len(r.headers)
+}
+
+// 指定した種類のチャンクの番号
+func (r *Reader) Find(t Type) []int {
+	var indexes []int
+	for i, h := range r.headers {
+		if h.Type == t {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+// i番目のチャンク全体(長さ、種類、データ、CRC)
+// そのままio.Copy()すれば、別のファイルにチャンクを書き写せる
+func (r *Reader) Section(i int) *io.SectionReader {
+	h := r.headers[i]
+	return io.NewSectionReader(r.r, h.Offset, h.Size())
+}
+
+// i番目のチャンクのデータ部分だけ
+func (r *Reader) Data(i int) *io.SectionReader {
+	h := r.headers[i]
+	return io.NewSectionReader(r.r, h.Offset+8, int64(h.Length))
+}
+
+// i番目のチャンクをデータごと読み込む
+// CRCが一致しない場合は、読み込んだチャンクとErrCRCを含むエラーを両方返す
+func (r *Reader) Chunk(i int) (*Chunk, error) {
+	h := r.headers[i]
+	b := make([]byte, int64(h.Length)+4)
+	if _, err := r.r.ReadAt(b, h.Offset+8); err != nil {
+		return nil, err
+	}
+	c := &Chunk{
+		Header: h,
+		Data:   b[:h.Length],
+		CRC:    binary.BigEndian.Uint32(b[h.Length:]),
+	}
+	if !c.ValidCRC() {
+		return c, &ChunkError{Offset: h.Offset, Type: h.Type, Err: ErrCRC}
+	}
+	return c, nil
+}
+
+// IENDの後ろに余分なデータがあるか
+func (r *Reader) TrailingData() int64 {
+	if len(r.headers) == 0 {
+		return r.size - int64(len(Signature))
+	}
+	last := r.headers[len(r.headers)-1]
+	return r.size - (last.Offset + last.Size())
+}
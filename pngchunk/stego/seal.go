@@ -0,0 +1,151 @@
+package stego
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// scryptのパラメータ(log2(N)、r、p)
+type scryptParams [3]byte
+
+func (p scryptParams) key(passphrase, salt []byte) ([]byte, error) {
+	return scrypt.Key(passphrase, salt, 1<<uint(p[0]), int(p[1]), int(p[2]), keySize)
+}
+
+// payloadを圧縮、暗号化して、チャンクに分ける前のデータにする
+func seal(payload []byte, options *Options) ([]byte, error) {
+	var flags byte
+	body := payload
+	if options.Compress {
+		flags |= flagCompressed
+		var buffer bytes.Buffer
+		writer := gzip.NewWriter(&buffer)
+		if _, err := writer.Write(payload); err != nil {
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+		body = buffer.Bytes()
+	}
+	if len(options.Passphrase) == 0 {
+		header := []byte{version, flags}
+		checksum := make([]byte, 4)
+		binary.BigEndian.PutUint32(checksum, crc32.ChecksumIEEE(body))
+		return append(append(header, body...), checksum...), nil
+	}
+
+	flags |= flagEncrypted
+	logN := options.ScryptLogN
+	if logN == 0 {
+		logN = DefaultScryptLogN
+	}
+	if logN < 1 || logN > maxScryptLogN {
+		return nil, fmt.Errorf("stego: ScryptLogN must be between 1 and %d", maxScryptLogN)
+	}
+	params := scryptParams{byte(logN), 8, 1}
+	header := []byte{version, flags, params[0], params[1], params[2]}
+	random := make([]byte, saltSize+nonceSize)
+	if _, err := io.ReadFull(rand.Reader, random); err != nil {
+		return nil, err
+	}
+	header = append(header, random...)
+	aead, err := newAEAD(options.Passphrase, params, random[:saltSize])
+	if err != nil {
+		return nil, err
+	}
+	// ヘッダーも追加データとして認証するので、フラグなどを書き換えても気付ける
+	return aead.Seal(header, random[saltSize:], body, header), nil
+}
+
+// seal()の逆
+func open(data []byte, options *Options, maxSize int64) ([]byte, error) {
+	if len(data) < 2 || data[0] != version {
+		return nil, ErrCorrupt
+	}
+	flags := data[1]
+	if flags&^(flagCompressed|flagEncrypted) != 0 {
+		return nil, ErrCorrupt
+	}
+	var body []byte
+	if flags&flagEncrypted == 0 {
+		if len(data) < 6 {
+			return nil, ErrCorrupt
+		}
+		body = data[2 : len(data)-4]
+		if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(data[len(data)-4:]) {
+			return nil, ErrCorrupt
+		}
+	} else {
+		if len(options.Passphrase) == 0 {
+			return nil, ErrPassphraseRequired
+		}
+		headerSize := 5 + saltSize + nonceSize
+		if len(data) < headerSize {
+			return nil, ErrCorrupt
+		}
+		header := data[:headerSize]
+		var params scryptParams
+		copy(params[:], header[2:5])
+		if params[0] < 1 || params[0] > maxScryptLogN || params[1] != 8 || params[2] != 1 {
+			return nil, ErrCorrupt
+		}
+		maxLogN := options.MaxScryptLogN
+		if maxLogN == 0 {
+			maxLogN = DefaultScryptLogN
+		}
+		if int(params[0]) > maxLogN {
+			return nil, ErrScryptCost
+		}
+		salt := header[5 : 5+saltSize]
+		nonce := header[5+saltSize:]
+		aead, err := newAEAD(options.Passphrase, params, salt)
+		if err != nil {
+			return nil, err
+		}
+		body, err = aead.Open(nil, nonce, data[headerSize:], header)
+		if err != nil {
+			return nil, ErrAuthentication
+		}
+	}
+	if flags&flagCompressed == 0 {
+		if int64(len(body)) > maxSize {
+			return nil, ErrTooLarge
+		}
+		return body, nil
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	payload, err := ioutil.ReadAll(io.LimitReader(reader, maxSize+1))
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	if int64(len(payload)) > maxSize {
+		return nil, ErrTooLarge
+	}
+	return payload, nil
+}
+
+func newAEAD(passphrase []byte, params scryptParams, salt []byte) (cipher.AEAD, error) {
+	key, err := params.key(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
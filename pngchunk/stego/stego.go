@@ -0,0 +1,217 @@
+// stegoパッケージはPNGファイルの非公開の補助チャンクに任意のデータを埋め込む
+// read.goでsecret.pngにテキストを隠した例を、バイナリのデータ、圧縮、暗号化に対応させたもの
+//
+// 埋め込むデータは次の形式にしてから、ChunkSizeごとに分けて複数のチャンクに書き込む
+//
+//	バージョン(1バイト) + フラグ(1バイト) + [scryptのパラメータ(3バイト) + ソルト(16バイト) + ノンス(12バイト)] + 本体
+//
+// 本体はデータ(圧縮する場合はgzipで圧縮したもの)で、暗号化しない場合は末尾にCRC-32を付け、
+// 暗号化する場合はパスフレーズからscryptで作った鍵でAES-GCMで暗号化する
+// 各チャンクの先頭には番号と総数(それぞれ4バイト)を付けるので、チャンクが欠けたり並び替えられたりしても気付ける
+package stego
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+
+	"system-programming/pngchunk"
+)
+
+// データを書き込むチャンクの種類の既定値
+// 1文字目が小文字(補助チャンク)、2文字目が小文字(非公開)、3文字目が大文字(予約)、
+// 4文字目が小文字(画像を編集したエディタでもコピーしてよい)
+const DefaultType pngchunk.Type = "stEg"
+
+const (
+	DefaultChunkSize = 64 << 10
+	// 展開後のデータの大きさの既定の上限
+	DefaultMaxSize = 64 << 20
+	// scryptのコストN=2^15(2017年時点の推奨値)
+	DefaultScryptLogN = 15
+	// 設定できるコストの上限(N=2^20、r=8で1GiBのメモリを使う)
+	maxScryptLogN = 20
+)
+
+const (
+	version = 1
+
+	flagCompressed = 1 << 0
+	flagEncrypted  = 1 << 1
+
+	saltSize  = 16
+	nonceSize = 12
+	keySize   = 32
+	// チャンクの先頭の番号と総数
+	fragmentHeaderSize = 8
+)
+
+var (
+	ErrNoPayload          = errors.New("stego: no payload found")
+	ErrCorrupt            = errors.New("stego: payload is corrupt")
+	ErrPassphraseRequired = errors.New("stego: payload is encrypted; passphrase required")
+	// 暗号化されたデータの場合、パスフレーズの間違いと改ざんは区別できない
+	ErrAuthentication = errors.New("stego: wrong passphrase or payload has been tampered with")
+	ErrTooLarge       = errors.New("stego: payload too large")
+	ErrScryptCost     = errors.New("stego: scrypt cost exceeds MaxScryptLogN")
+)
+
+// ゼロ値のままでも使える
+type Options struct {
+	// データを書き込むチャンクの種類(非公開の補助チャンク)。空ならDefaultType
+	Type pngchunk.Type
+	// 1つのチャンクに書き込むデータの大きさ。0ならDefaultChunkSize
+	ChunkSize int
+	// gzipで圧縮するか
+	Compress bool
+	// 空でなければ、このパスフレーズから作った鍵で暗号化する
+	Passphrase []byte
+	// scryptのコスト(log2(N))。0ならDefaultScryptLogN
+	ScryptLogN int
+	// 取り出すときに受け付けるscryptのコストの上限。0ならDefaultScryptLogN(32MiBのメモリを使う)
+	// コストは認証する前にファイルから読むので、細工したファイルで時間とメモリを使わされないように制限する
+	// DefaultScryptLogNより大きいScryptLogNで埋め込んだものを取り出すときは、同じ値にする
+	MaxScryptLogN int
+	// 取り出すときのデータの大きさの上限。0ならDefaultMaxSize
+	MaxSize int64
+}
+
+func (o *Options) chunkType() (pngchunk.Type, error) {
+	t := DefaultType
+	if o != nil && o.Type != "" {
+		t = o.Type
+	}
+	// 重要チャンクや公開チャンクにすると、画像として読めなくなったり他のチャンクと混ざったりする
+	if !t.Valid() || t.IsCritical() || t.IsPublic() {
+		return "", pngchunk.ErrType
+	}
+	return t, nil
+}
+
+// rのPNGにpayloadを埋め込んだものをwに書き出す
+// 同じ種類のチャンクがすでにあれば取り除いてから、IENDの直前に書き込む
+func Embed(w io.Writer, r io.Reader, payload []byte, options *Options) error {
+	if options == nil {
+		options = &Options{}
+	}
+	t, err := options.chunkType()
+	if err != nil {
+		return err
+	}
+	chunkSize := options.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	if chunkSize > pngchunk.MaxLength-fragmentHeaderSize {
+		return pngchunk.ErrLength
+	}
+	data, err := seal(payload, options)
+	if err != nil {
+		return err
+	}
+
+	decoder := pngchunk.NewDecoder(r)
+	encoder := pngchunk.NewEncoder(w)
+	for {
+		h, err := decoder.NextHeader()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if h.Type == t {
+			continue
+		}
+		if h.Type == "IEND" {
+			if err := writeFragments(encoder, t, data, chunkSize); err != nil {
+				return err
+			}
+		}
+		if err := encoder.WriteChunkFrom(h.Type, h.Length, decoder); err != nil {
+			return err
+		}
+	}
+}
+
+func writeFragments(encoder *pngchunk.Encoder, t pngchunk.Type, data []byte, chunkSize int) error {
+	count := (len(data) + chunkSize - 1) / chunkSize
+	for i := 0; i < count; i++ {
+		end := (i + 1) * chunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		fragment := make([]byte, fragmentHeaderSize, fragmentHeaderSize+end-i*chunkSize)
+		binary.BigEndian.PutUint32(fragment, uint32(i))
+		binary.BigEndian.PutUint32(fragment[4:], uint32(count))
+		fragment = append(fragment, data[i*chunkSize:end]...)
+		if err := encoder.WriteChunk(t, fragment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rのPNGに埋め込まれたデータを取り出す
+// 暗号化されている場合はoptions.Passphraseが必要
+func Extract(r io.Reader, options *Options) ([]byte, error) {
+	if options == nil {
+		options = &Options{}
+	}
+	t, err := options.chunkType()
+	if err != nil {
+		return nil, err
+	}
+	maxSize := options.MaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+
+	// 圧縮しても大きくなるデータもあるので、少し余裕を持たせる
+	limit := maxSize + maxSize/64 + 1024
+	var data bytes.Buffer
+	total, next := -1, 0
+	decoder := pngchunk.NewDecoder(r)
+	for {
+		h, err := decoder.NextHeader()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if h.Type != t {
+			continue
+		}
+		if h.Length < fragmentHeaderSize {
+			return nil, ErrCorrupt
+		}
+		if int64(data.Len())+int64(h.Length) > limit {
+			return nil, ErrTooLarge
+		}
+		fragment, err := ioutil.ReadAll(decoder)
+		if err != nil {
+			return nil, err
+		}
+		index := int(binary.BigEndian.Uint32(fragment))
+		count := int(binary.BigEndian.Uint32(fragment[4:]))
+		if total < 0 {
+			total = count
+		}
+		// 番号が0から順に並んでいて、総数がどのチャンクでも同じであること
+		if count != total || index != next || next >= total {
+			return nil, ErrCorrupt
+		}
+		next++
+		data.Write(fragment[fragmentHeaderSize:])
+	}
+	if total < 0 {
+		return nil, ErrNoPayload
+	}
+	if next != total {
+		return nil, ErrCorrupt
+	}
+	return open(data.Bytes(), options, maxSize)
+}
@@ -0,0 +1,161 @@
+package stego
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+
+	"system-programming/pngchunk"
+)
+
+func readImage(t *testing.T) []byte {
+	t.Helper()
+	b, err := ioutil.ReadFile("../../img.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func embed(t *testing.T, image, payload []byte, options *Options) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	if err := Embed(&buffer, bytes.NewReader(image), payload, options); err != nil {
+		t.Fatal(err)
+	}
+	if err := pngchunk.Validate(bytes.NewReader(buffer.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+// 埋め込んだi番目のチャンクのデータを書き換え、CRCを計算し直す
+// PNGとしては正しいまま、中身だけが改ざんされたファイルになる
+func tamper(t *testing.T, image []byte, i int, f func(data []byte) []byte) []byte {
+	t.Helper()
+	decoder := pngchunk.NewDecoder(bytes.NewReader(image))
+	var buffer bytes.Buffer
+	encoder := pngchunk.NewEncoder(&buffer)
+	n := 0
+	for {
+		c, err := decoder.Next()
+		if err != nil {
+			break
+		}
+		if c.Type == DefaultType {
+			if n == i {
+				c.Data = f(c.Data)
+			}
+			n++
+			if c.Data == nil {
+				continue
+			}
+		}
+		if err := encoder.Write(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buffer.Bytes()
+}
+
+func TestEmbedExtract(t *testing.T) {
+	image := readImage(t)
+	random := make([]byte, 200000)
+	rand.New(rand.NewSource(1)).Read(random)
+	text := bytes.Repeat([]byte("ASCII PROGRAMMING++\n"), 10000)
+	tests := []struct {
+		name    string
+		payload []byte
+		options *Options
+	}{
+		{"default", []byte("ASCII PROGRAMMING++"), nil},
+		{"empty", []byte{}, nil},
+		{"split", random, &Options{ChunkSize: 4096}},
+		{"gzip", text, &Options{Compress: true}},
+		{"encrypted", random, &Options{ChunkSize: 50000, Passphrase: []byte("secret"), ScryptLogN: 10}},
+		{"gzip+encrypted", text, &Options{Compress: true, Passphrase: []byte("secret"), ScryptLogN: 10}},
+		{"type", []byte("private"), &Options{Type: "prVt"}},
+	}
+	for _, test := range tests {
+		embedded := embed(t, image, test.payload, test.options)
+		got, err := Extract(bytes.NewReader(embedded), test.options)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !bytes.Equal(got, test.payload) {
+			t.Errorf("%s: extracted payload differs", test.name)
+		}
+		// 埋め込み直すと前のデータは置き換えられる
+		again := embed(t, embedded, []byte("second"), test.options)
+		if got, err := Extract(bytes.NewReader(again), test.options); err != nil || string(got) != "second" {
+			t.Errorf("%s: re-embed: %q, %v", test.name, got, err)
+		}
+	}
+
+	if got := embed(t, image, text, &Options{Compress: true}); len(got) > len(image)+len(text)/10 {
+		t.Errorf("payload is not compressed: %d bytes", len(got)-len(image))
+	}
+	if err := Embed(ioutil.Discard, bytes.NewReader(image), nil, &Options{Type: "IDAT"}); err == nil {
+		t.Error("critical chunk type accepted")
+	}
+}
+
+func TestExtractErrors(t *testing.T) {
+	image := readImage(t)
+	if _, err := Extract(bytes.NewReader(image), nil); err != ErrNoPayload {
+		t.Errorf("no payload: error = %v", err)
+	}
+
+	payload := bytes.Repeat([]byte("payload"), 1000)
+	plain := embed(t, image, payload, &Options{ChunkSize: 1000})
+	encrypted := embed(t, image, payload, &Options{ChunkSize: 1000, Passphrase: []byte("secret"), ScryptLogN: 10})
+	flip := func(data []byte) []byte {
+		data[len(data)/2] ^= 1
+		return data
+	}
+	drop := func([]byte) []byte { return nil }
+	tests := []struct {
+		name    string
+		image   []byte
+		options *Options
+		want    error
+	}{
+		{"plain tampered", tamper(t, plain, 3, flip), nil, ErrCorrupt},
+		{"plain missing chunk", tamper(t, plain, 2, drop), nil, ErrCorrupt},
+		{"plain missing last chunk", tamper(t, plain, 6, drop), nil, ErrCorrupt},
+		{"encrypted without passphrase", encrypted, nil, ErrPassphraseRequired},
+		{"wrong passphrase", encrypted, &Options{Passphrase: []byte("wrong")}, ErrAuthentication},
+		{"encrypted tampered", tamper(t, encrypted, 3, flip), &Options{Passphrase: []byte("secret")}, ErrAuthentication},
+		{"header tampered", tamper(t, encrypted, 0, func(data []byte) []byte {
+			// 圧縮フラグを立てる
+			data[9] |= flagCompressed
+			return data
+		}), &Options{Passphrase: []byte("secret")}, ErrAuthentication},
+		{"too large", plain, &Options{MaxSize: 100}, ErrTooLarge},
+		{"scrypt cost above MaxScryptLogN", encrypted, &Options{Passphrase: []byte("secret"), MaxScryptLogN: 9}, ErrScryptCost},
+		{"scrypt cost tampered", tamper(t, encrypted, 0, func(data []byte) []byte {
+			// 認証する前にN=2^20の計算をさせようとする
+			data[10] = 20
+			return data
+		}), &Options{Passphrase: []byte("secret")}, ErrScryptCost},
+	}
+	for _, test := range tests {
+		got, err := Extract(bytes.NewReader(test.image), test.options)
+		if !errors.Is(err, test.want) {
+			t.Errorf("%s: error = %v, want %v", test.name, err, test.want)
+		}
+		if got != nil {
+			t.Errorf("%s: returned data on error", test.name)
+		}
+	}
+
+	// チャンクのCRCが壊れている場合はPNGのレベルでエラーになる
+	corrupt := append([]byte(nil), plain...)
+	corrupt[len(corrupt)-100] ^= 1
+	if _, err := Extract(bytes.NewReader(corrupt), nil); !errors.Is(err, pngchunk.ErrCRC) {
+		t.Errorf("CRC: error = %v", err)
+	}
+}
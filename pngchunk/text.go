@@ -0,0 +1,250 @@
+package pngchunk
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"unicode/utf8"
+)
+
+// テキストを格納するチャンクの種類
+//   - tEXt: キーワードとテキスト(どちらもLatin-1)
+//   - zTXt: tEXtのテキストをzlibで圧縮したもの
+//   - iTXt: UTF-8のテキストで、言語タグと翻訳されたキーワードを持ち、圧縮するかどうかを選べる
+const (
+	TypeText           Type = "tEXt"
+	TypeCompressedText Type = "zTXt"
+	TypeInternational  Type = "iTXt"
+)
+
+// 圧縮されたテキストを展開するときの上限
+// 小さなチャンクから巨大なデータに展開されるのを防ぐ
+const MaxTextSize = 16 << 20
+
+var (
+	ErrKeyword = errors.New("pngchunk: invalid text keyword")
+	ErrLatin1  = errors.New("pngchunk: text is not representable in Latin-1")
+	ErrText    = errors.New("pngchunk: malformed text chunk")
+)
+
+// テキストのチャンク1つ分
+// KeywordとTextはLatin-1のチャンクでもUTF-8の文字列に変換して持つ
+// LanguageとTranslatedKeywordはiTXtだけのもので、CompressedはiTXtで圧縮するかどうか(zTXtは常に圧縮)
+type Text struct {
+	Type              Type   `json:"type"`
+	Keyword           string `json:"keyword"`
+	Text              string `json:"text"`
+	Language          string `json:"language,omitempty"`
+	TranslatedKeyword string `json:"translated_keyword,omitempty"`
+	Compressed        bool   `json:"compressed,omitempty"`
+}
+
+// テキストからチャンクの種類を選んでTextを作る
+// Latin-1で表せればtEXt、表せなければiTXtになる
+func NewText(keyword, text string) *Text {
+	t := &Text{Type: TypeText, Keyword: keyword, Text: text}
+	if _, err := toLatin1(text); err != nil {
+		t.Type = TypeInternational
+	}
+	return t
+}
+
+// テキストのチャンクかどうか
+func IsText(t Type) bool {
+	return t == TypeText || t == TypeCompressedText || t == TypeInternational
+}
+
+func (t *Text) String() string {
+	if t.Language != "" {
+		return fmt.Sprintf("%s [%s] %s: %s", t.Type, t.Language, t.Keyword, t.Text)
+	}
+	return fmt.Sprintf("%s %s: %s", t.Type, t.Keyword, t.Text)
+}
+
+// テキストのチャンクのデータを読み込む
+func ParseText(c *Chunk) (*Text, error) {
+	fail := func(err error) (*Text, error) {
+		return nil, &ChunkError{Offset: c.Offset, Type: c.Type, Err: err}
+	}
+	keyword, rest, ok := cutNull(c.Data)
+	if !ok {
+		return fail(ErrText)
+	}
+	if err := checkKeyword(keyword); err != nil {
+		return fail(err)
+	}
+	t := &Text{Type: c.Type, Keyword: fromLatin1(keyword)}
+	switch c.Type {
+	case TypeText:
+		t.Text = fromLatin1(rest)
+	case TypeCompressedText:
+		// 圧縮方式(0: zlibのみ)のあとに圧縮されたデータが続く
+		if len(rest) < 1 || rest[0] != 0 {
+			return fail(ErrText)
+		}
+		text, err := inflate(rest[1:])
+		if err != nil {
+			return fail(err)
+		}
+		t.Text = fromLatin1(text)
+	case TypeInternational:
+		// 圧縮フラグ、圧縮方式、言語タグ、翻訳されたキーワード、テキストの順
+		if len(rest) < 2 || rest[0] > 1 || rest[1] != 0 {
+			return fail(ErrText)
+		}
+		t.Compressed = rest[0] == 1
+		language, rest, ok := cutNull(rest[2:])
+		if !ok {
+			return fail(ErrText)
+		}
+		translated, text, ok := cutNull(rest)
+		if !ok || !utf8.Valid(translated) {
+			return fail(ErrText)
+		}
+		if t.Compressed {
+			var err error
+			if text, err = inflate(text); err != nil {
+				return fail(err)
+			}
+		}
+		if !utf8.Valid(text) {
+			return fail(ErrText)
+		}
+		t.Language = string(language)
+		t.TranslatedKeyword = string(translated)
+		t.Text = string(text)
+	default:
+		return fail(ErrType)
+	}
+	return t, nil
+}
+
+// チャンクに変換する
+// tEXtとzTXtでLatin-1に変換できない文字があればErrLatin1を返す
+func (t *Text) Chunk() (*Chunk, error) {
+	fail := func(err error) (*Chunk, error) {
+		return nil, &ChunkError{Offset: -1, Type: t.Type, Err: err}
+	}
+	keyword, err := toLatin1(t.Keyword)
+	if err != nil {
+		return fail(ErrKeyword)
+	}
+	if err := checkKeyword(keyword); err != nil {
+		return fail(err)
+	}
+	var buffer bytes.Buffer
+	buffer.Write(keyword)
+	buffer.WriteByte(0)
+	switch t.Type {
+	case TypeText, TypeCompressedText:
+		text, err := toLatin1(t.Text)
+		if err != nil {
+			return fail(err)
+		}
+		if t.Type == TypeText {
+			buffer.Write(text)
+			break
+		}
+		buffer.WriteByte(0)
+		if err := deflate(&buffer, text); err != nil {
+			return nil, err
+		}
+	case TypeInternational:
+		if bytes.IndexByte([]byte(t.Language), 0) >= 0 || bytes.IndexByte([]byte(t.TranslatedKeyword), 0) >= 0 {
+			return fail(ErrText)
+		}
+		if t.Compressed {
+			buffer.WriteByte(1)
+		} else {
+			buffer.WriteByte(0)
+		}
+		buffer.WriteByte(0)
+		buffer.WriteString(t.Language)
+		buffer.WriteByte(0)
+		buffer.WriteString(t.TranslatedKeyword)
+		buffer.WriteByte(0)
+		if t.Compressed {
+			if err := deflate(&buffer, []byte(t.Text)); err != nil {
+				return nil, err
+			}
+		} else {
+			buffer.WriteString(t.Text)
+		}
+	default:
+		return fail(ErrType)
+	}
+	return New(t.Type, buffer.Bytes()), nil
+}
+
+// キーワードは1〜79バイトの表示可能なLatin-1の文字で、先頭と末尾の空白や連続した空白は使えない
+func checkKeyword(keyword []byte) error {
+	if len(keyword) < 1 || len(keyword) > 79 {
+		return ErrKeyword
+	}
+	if keyword[0] == ' ' || keyword[len(keyword)-1] == ' ' || bytes.Contains(keyword, []byte("  ")) {
+		return ErrKeyword
+	}
+	for _, c := range keyword {
+		if c < 32 || 126 < c && c < 161 {
+			return ErrKeyword
+		}
+	}
+	return nil
+}
+
+func cutNull(b []byte) (before, after []byte, ok bool) {
+	i := bytes.IndexByte(b, 0)
+	if i < 0 {
+		return nil, nil, false
+	}
+	return b[:i], b[i+1:], true
+}
+
+// Latin-1(ISO-8859-1)は1バイトがそのままUnicodeのU+0000〜U+00FFに対応する
+func fromLatin1(b []byte) string {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+func toLatin1(s string) ([]byte, error) {
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > 0xff {
+			return nil, ErrLatin1
+		}
+		b = append(b, byte(r))
+	}
+	return b, nil
+}
+
+func inflate(b []byte) ([]byte, error) {
+	reader, err := zlib.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	text, err := ioutil.ReadAll(io.LimitReader(reader, MaxTextSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(text) > MaxTextSize {
+		return nil, ErrLength
+	}
+	return text, nil
+}
+
+func deflate(w io.Writer, b []byte) error {
+	writer := zlib.NewWriter(w)
+	if _, err := writer.Write(b); err != nil {
+		return err
+	}
+	return writer.Close()
+}
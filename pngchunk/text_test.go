@@ -0,0 +1,141 @@
+package pngchunk
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"testing"
+)
+
+func TestTextChunkRoundTrip(t *testing.T) {
+	texts := []*Text{
+		{Type: TypeText, Keyword: "Comment", Text: "ASCII PROGRAMMING++"},
+		{Type: TypeText, Keyword: "Author", Text: "Zoë Müller"},
+		{Type: TypeCompressedText, Keyword: "Description", Text: "café " + string(bytes.Repeat([]byte("a"), 1000))},
+		{Type: TypeInternational, Keyword: "Title", Text: "システムプログラミング", Language: "ja", TranslatedKeyword: "タイトル"},
+		{Type: TypeInternational, Keyword: "Title", Text: "圧縮されたテキスト", Language: "ja-JP", Compressed: true},
+	}
+	for _, text := range texts {
+		c, err := text.Chunk()
+		if err != nil {
+			t.Fatalf("%v: %v", text, err)
+		}
+		parsed, err := ParseText(c)
+		if err != nil {
+			t.Fatalf("%v: %v", text, err)
+		}
+		if *parsed != *text {
+			t.Errorf("got %+v, want %+v", parsed, text)
+		}
+	}
+	if c, _ := texts[2].Chunk(); c.Length >= 1000 {
+		t.Errorf("zTXt is not compressed: %d bytes", c.Length)
+	}
+}
+
+func TestTextErrors(t *testing.T) {
+	tests := []struct {
+		text *Text
+		want error
+	}{
+		{&Text{Type: TypeText, Keyword: "", Text: "x"}, ErrKeyword},
+		{&Text{Type: TypeText, Keyword: " Title", Text: "x"}, ErrKeyword},
+		{&Text{Type: TypeText, Keyword: "Two  spaces", Text: "x"}, ErrKeyword},
+		{&Text{Type: TypeText, Keyword: string(bytes.Repeat([]byte("k"), 80)), Text: "x"}, ErrKeyword},
+		{&Text{Type: TypeText, Keyword: "タイトル", Text: "x"}, ErrKeyword},
+		{&Text{Type: TypeText, Keyword: "Title", Text: "日本語"}, ErrLatin1},
+		{&Text{Type: TypeCompressedText, Keyword: "Title", Text: "日本語"}, ErrLatin1},
+	}
+	for _, test := range tests {
+		if _, err := test.text.Chunk(); !errors.Is(err, test.want) {
+			t.Errorf("%+v: error = %v, want %v", test.text, err, test.want)
+		}
+	}
+
+	// キーワードの区切りのNULがない
+	if _, err := ParseText(New(TypeText, []byte("Comment"))); !errors.Is(err, ErrText) {
+		t.Errorf("error = %v, want ErrText", err)
+	}
+	// 圧縮方式が0以外
+	if _, err := ParseText(New(TypeCompressedText, []byte("Comment\x00\x01xx"))); !errors.Is(err, ErrText) {
+		t.Errorf("error = %v, want ErrText", err)
+	}
+
+	if NewText("Title", "ASCII").Type != TypeText || NewText("Title", "日本語").Type != TypeInternational {
+		t.Error("NewText() chose a wrong chunk type")
+	}
+}
+
+// リポジトリのPNGにテキストを追加して読み戻し、削除すると元のファイルに戻ることを確かめる
+func TestRewriteTexts(t *testing.T) {
+	for _, name := range []string{"../img.png", "../secret.png"} {
+		original, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		before, err := ReadTexts(bytes.NewReader(original))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		add := []*Text{
+			{Type: TypeText, Keyword: "Author", Text: "Gopher"},
+			{Type: TypeCompressedText, Keyword: "Description", Text: "zTXt test"},
+			{Type: TypeInternational, Keyword: "Title", Text: "テスト", Language: "ja", Compressed: true},
+		}
+		var added bytes.Buffer
+		if err := RewriteTexts(&added, bytes.NewReader(original), nil, add...); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if err := Validate(bytes.NewReader(added.Bytes())); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		after, err := ReadTexts(bytes.NewReader(added.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(after) != len(before)+len(add) {
+			t.Fatalf("%s: %d texts, want %d", name, len(after), len(before)+len(add))
+		}
+		for i, text := range add {
+			if got := after[len(before)+i]; *got != *text {
+				t.Errorf("%s: got %+v, want %+v", name, got, text)
+			}
+		}
+
+		// 置き換え
+		var replaced bytes.Buffer
+		err = RewriteTexts(&replaced, bytes.NewReader(added.Bytes()), func(text *Text) *Text {
+			if text.Keyword == "Author" {
+				text.Text = "Gopher and friends"
+			}
+			return text
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		texts, err := ReadTexts(bytes.NewReader(replaced.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if author := texts[len(before)]; author.Text != "Gopher and friends" {
+			t.Errorf("%s: Author = %q", name, author.Text)
+		}
+
+		// 追加したものを削除すると元に戻る
+		var removed bytes.Buffer
+		err = RewriteTexts(&removed, bytes.NewReader(replaced.Bytes()), func(text *Text) *Text {
+			for _, a := range add {
+				if text.Keyword == a.Keyword {
+					return nil
+				}
+			}
+			return text
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(removed.Bytes(), original) {
+			t.Errorf("%s: file differs after removing the added texts", name)
+		}
+	}
+}
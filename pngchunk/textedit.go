@@ -0,0 +1,96 @@
+package pngchunk
+
+import (
+	"io"
+)
+
+// PNGに含まれるテキストのチャンクを順番に全て読み込む
+func ReadTexts(r io.Reader) ([]*Text, error) {
+	var texts []*Text
+	decoder := NewDecoder(r)
+	for {
+		h, err := decoder.NextHeader()
+		if err == io.EOF {
+			return texts, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !IsText(h.Type) {
+			continue
+		}
+		c, err := decoder.readChunk(h)
+		if err != nil {
+			return nil, err
+		}
+		t, err := ParseText(c)
+		if err != nil {
+			return nil, err
+		}
+		texts = append(texts, t)
+	}
+}
+
+// rのPNGをwに書き写しながら、テキストのチャンクを書き換える
+// 既存のテキストのチャンクごとにeditを呼び、返されたTextで置き換える(nilを返すと削除)
+// editで変更しなかったチャンクは元のデータのまま書き写す
+// addは最初のIDATの直前に追加する。デコーダーが画像より先にテキストを読めるように、PNGの仕様でもIDATより前に置くことが推奨されている
+// テキスト以外のチャンクはデータを一度に読み込まずにコピーする
+func RewriteTexts(w io.Writer, r io.Reader, edit func(*Text) *Text, add ...*Text) error {
+	decoder := NewDecoder(r)
+	encoder := NewEncoder(w)
+	writeTexts := func(texts []*Text) error {
+		for _, t := range texts {
+			c, err := t.Chunk()
+			if err != nil {
+				return err
+			}
+			if err := encoder.Write(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	added := false
+	for {
+		h, err := decoder.NextHeader()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !added && (h.Type == "IDAT" || h.Type == "IEND") {
+			added = true
+			if err := writeTexts(add); err != nil {
+				return err
+			}
+		}
+		if !IsText(h.Type) || edit == nil {
+			if err := encoder.WriteChunkFrom(h.Type, h.Length, decoder); err != nil {
+				return err
+			}
+			continue
+		}
+		c, err := decoder.readChunk(h)
+		if err != nil {
+			return err
+		}
+		t, err := ParseText(c)
+		if err != nil {
+			return err
+		}
+		original := *t
+		edited := edit(t)
+		switch {
+		case edited == nil:
+		case edited == t && *t == original:
+			err = encoder.Write(c)
+		default:
+			err = writeTexts([]*Text{edited})
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package pngchunk
+
+import (
+	"fmt"
+	"io"
+)
+
+// PNGファイルとして正しい構造かを確かめる
+//   - シグニチャ
+//   - 全てのチャンクのCRC
+//   - チャンクの種類の予約ビット
+//   - IHDRが最初にあり、長さが13バイトであること
+//   - PLTEがIDATより前にあること
+//   - IDATが1つ以上あり、途中に他のチャンクを挟まずに連続していること
+//   - IENDが最後にあり、データが空であること(IENDがなければio.ErrUnexpectedEOF)
+//
+// データは読み捨てながら確かめるので、大きなファイルでもメモリを使わない
+// 最初に見つかった問題をErrSignature、ErrCRC、ErrOrderなどを含むエラーとして返す
+func Validate(r io.Reader) error {
+	d := NewDecoder(r)
+	var previous Type
+	seen := make(map[Type]bool)
+	for {
+		h, err := d.NextHeader()
+		if err == io.EOF {
+			// DecoderはIENDを読んだあとにだけio.EOFを返し、IENDがないまま終わったファイルはio.ErrUnexpectedEOFになる
+			break
+		}
+		if err != nil {
+			return err
+		}
+		orderError := func(format string, args ...interface{}) error {
+			return &ChunkError{Offset: h.Offset, Type: h.Type, Err: fmt.Errorf("%w: "+format, append([]interface{}{ErrOrder}, args...)...)}
+		}
+		if !h.Type.Valid() {
+			return &ChunkError{Offset: h.Offset, Type: h.Type, Err: ErrType}
+		}
+		switch {
+		case previous == "" && h.Type != "IHDR":
+			return orderError("first chunk must be IHDR")
+		case h.Type == "IHDR" && previous != "":
+			return orderError("multiple IHDR")
+		case h.Type == "IHDR" && h.Length != 13:
+			return orderError("IHDR must be 13 bytes")
+		case h.Type == "PLTE" && seen["IDAT"]:
+			return orderError("PLTE after IDAT")
+		case h.Type == "IDAT" && seen["IDAT"] && previous != "IDAT":
+			return orderError("IDAT chunks must be consecutive")
+		case h.Type == "IEND" && !seen["IDAT"]:
+			return orderError("no IDAT before IEND")
+		case h.Type == "IEND" && h.Length != 0:
+			return orderError("IEND must be empty")
+		}
+		seen[h.Type] = true
+		previous = h.Type
+	}
+	return nil
+}
@@ -6,13 +6,15 @@ import (
 	"encoding/binary"
 	"encoding/csv"
 	"fmt"
-	"hash/crc32"
 	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"os"
 	"strings"
+
+	"system-programming/csvcodec"
+	"system-programming/pngchunk"
 )
 
 func main() {
@@ -98,6 +100,7 @@ func main() {
 		return
 	}
 	fmt.Printf("data: %d\n", i)
+	// 複数のフィールドをまとめて読み書きする場合は、構造体のタグで形式を宣言できるbincodecパッケージを使う
 
 	png, err := os.Open("img.png")
 	if err != nil {
@@ -108,9 +111,11 @@ func main() {
 			panic(err)
 		}
 	}()
+	// チャンクの読み書きはpngchunkパッケージにまとめてある
+	// *os.Fileはio.ReaderAtを満たすので、各チャンクをio.SectionReaderとして取り出せる
 	chunks := readChunks(png)
-	for _, chunk := range chunks {
-		dumpChunk(chunk)
+	for i := 0; i < chunks.Len(); i++ {
+		dumpChunk(chunks.Section(i))
 	}
 
 	newFile, err := os.Create("secret.png")
@@ -122,23 +127,24 @@ func main() {
 			panic(err)
 		}
 	}()
-	chunks = readChunks(file)
-	// シグニチャ書き込み
-	if _, err := io.WriteString(newFile, "\x89PNG\r\n\x1a\n"); err != nil {
-		panic(err)
-	}
+	// シグニチャはEncoderが最初の書き込みの前に書き込む
+	encoder := pngchunk.NewEncoder(newFile)
 	// 先頭に必要なIHDRチャンクを書き込み
-	if _, err := io.Copy(newFile, chunks[0]); err != nil {
-		return
+	// 読み込んだチャンクをそのまま書き写すので、データを一度に読み込まずにコピーできる
+	copyChunk := func(i int) {
+		h := chunks.Headers()[i]
+		if err := encoder.WriteChunkFrom(h.Type, h.Length, chunks.Data(i)); err != nil {
+			panic(err)
+		}
 	}
+	copyChunk(0)
 	// テキストチャンクを追加
-	if _, err := io.Copy(newFile, textChunk("ASCII PROGRAMMING++")); err != nil {
-		return
+	// 逆にメタデータのチャンクを取り除くにはpngchunk.Strip()(cmd/pngstrip)を使う
+	if err := encoder.Write(textChunk("ASCII PROGRAMMING++")); err != nil {
+		panic(err)
 	}
-	for _, chunk := range chunks[1:] {
-		if _, err := io.Copy(newFile, chunk); err != nil {
-			return
-		}
+	for i := 1; i < chunks.Len(); i++ {
+		copyChunk(i)
 	}
 
 	var source = `
@@ -176,6 +182,7 @@ func main() {
 	// 任意のデータ区切りをフォーマット文字列に設定する
 	// fmt.Fscanf(reader, "%v, %v, %v, %v", &j, &f, &g, &s)
 
+	// 日本郵便の郵便番号データ(KEN_ALL.CSV)の形式。ファイル全体を読み込んで検索する場合はkenallパッケージを使う
 	var csvSource =
 	 	`1,13101,"100 ",100003,"tokyo","chiyoda","hitotsubashi","東京都","千代田区","一ツ橋",1,0,1,0,0,0
 		 2,13101,"100 ",100003,"tokyo","chiyoda","hitotsubashi","東京都","千代田区","一ツ橋",1,0,1,0,0,0
@@ -189,9 +196,35 @@ func main() {
 		if err == io.EOF {
 			break
 		}
+		// 引用符の対応が取れていない、列の数が違うなどの場合は*csv.ParseErrorが返る
+		if err != nil {
+			panic(err)
+		}
 		fmt.Println(line[2], line[7:])
 	}
 
+	// 列の位置をタグで指定した構造体に、1行ずつ型を変換しながら読み込む
+	type address struct {
+		ID   int    `csv:",index=0"`
+		Zip  string `csv:",index=2"`
+		City string `csv:",index=8"`
+	}
+	addressDecoder := csvcodec.NewDecoder(strings.NewReader(csvSource))
+	addressDecoder.NoHeader = true
+	// 2行目以降の先頭のインデントを取り除く
+	addressDecoder.TrimLeadingSpace = true
+	for {
+		var a address
+		err := addressDecoder.Decode(&a)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			panic(err)
+		}
+		fmt.Println(a.ID, a.Zip, a.City)
+	}
+
 	header := bytes.NewBufferString("----- HEADER -----\n")
 	content := bytes.NewBufferString("Example of io.MultiReader\n")
 	footer := bytes.NewBufferString("----- FOOTER -----\n")
@@ -213,60 +246,53 @@ func main() {
 	fmt.Println(buffer.String())
 }
 
+// チャンクの中身を解釈して表示するものはcmd/pngdumpにある
 func dumpChunk(chunk io.Reader) {
 	var length int32
 	if err := binary.Read(chunk, binary.BigEndian, &length); err != nil {
 		return
 	}
 	buffer := make([]byte, 4)
-	if _, err := chunk.Read(buffer); err != nil {
+	if _, err := io.ReadFull(chunk, buffer); err != nil {
 		return
 	}
 	fmt.Printf("chunk '%v', (%d bytes)\n", string(buffer), length)
-	if bytes.Equal(buffer, []byte("tExt")) {
+	// テキストのチャンク(tEXt、zTXt、iTXt)はキーワードとテキストがNULで区切られている
+	if t := pngchunk.Type(buffer); pngchunk.IsText(t) {
 		rawText := make([]byte, length)
-		if _, err := chunk.Read(rawText); err != nil {
+		if _, err := io.ReadFull(chunk, rawText); err != nil {
 			return
 		}
-		fmt.Println(string(rawText))
-	}
-}
-
-func readChunks(file *os.File) []io.Reader {
-	var chunks []io.Reader
-	if _, err := file.Seek(8, 0); err != nil {
-		return chunks
-	}
-	var offset int64 = 8
-	for {
-		var length int32
-		if err := binary.Read(file, binary.BigEndian, &length); err == io.EOF {
-			break
+		text, err := pngchunk.ParseText(pngchunk.New(t, rawText))
+		if err != nil {
+			return
 		}
-		chunks = append(chunks, io.NewSectionReader(file, offset, int64(length)+12))
-		// 次のチャンクの先頭に移動
-		// 現在位置は長さを読み終わった箇所なので、チャンク名(4バイト)+データ長+CRC(4バイト)先に移動
-		offset, _ = file.Seek(int64(length+8), 1)
+		fmt.Printf("%s: %s\n", text.Keyword, text.Text)
 	}
-	return chunks
 }
 
-// binary.Write()による長さの書き込み、次にチャンク名の書き込み、本体の書き込み、最後にCRCの計算と、binary.Write()による書き込み
-func textChunk(text string) io.Reader {
-	byteData := []byte(text)
-	var buffer bytes.Buffer
-	if err := binary.Write(&buffer, binary.BigEndian, int32(len(byteData))); err != nil {
+// io.ReaderAtとファイルの大きさがあれば、チャンクの位置を調べられる
+// RIFF(WAV)やMP4のボックスなど、同じ形の他の形式も読めるようにしたものはtlvパッケージにある
+func readChunks(file *os.File) *pngchunk.Reader {
+	info, err := file.Stat()
+	if err != nil {
 		panic(err)
 	}
-	buffer.WriteString("tExt")
-	buffer.Write(byteData)
-	// CRCを計算して追加
-	crc := crc32.NewIEEE()
-	if _, err := io.WriteString(crc, "tExt"); err != nil {
+	chunks, err := pngchunk.NewReader(file, info.Size())
+	if err != nil {
 		panic(err)
 	}
-	if err := binary.Write(&buffer, binary.BigEndian, crc.Sum32()); err != nil {
+	return chunks
+}
+
+// テキストではなく任意のデータを隠す(暗号化もできる)ものはpngchunk/stego(cmd/pngstego)にある
+// tEXtチャンクのデータはキーワード + NUL + テキスト
+// 種類の3文字目は予約されていて大文字でなければならないので、tExtではなくtEXt
+// CRCは種類とデータを合わせたものから計算する必要がある
+func textChunk(text string) *pngchunk.Chunk {
+	c, err := pngchunk.NewText("Comment", text).Chunk()
+	if err != nil {
 		panic(err)
 	}
-	return &buffer
+	return c
 }
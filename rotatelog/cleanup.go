@@ -0,0 +1,162 @@
+package rotatelog
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 古いファイルの圧縮と削除をgoroutineに依頼する
+// 書き込みを止めないように別のgoroutineで行い、処理中に何度依頼されても1回にまとめる
+func (w *Writer) startCleanup() {
+	if !w.Compress && w.MaxBackups == 0 && w.MaxAge == 0 {
+		return
+	}
+	if w.cleanup == nil {
+		w.cleanup = make(chan struct{}, 1)
+		w.cleanupDone = make(chan struct{})
+		go func() {
+			defer close(w.cleanupDone)
+			for range w.cleanup {
+				if err := w.cleanupBackups(); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+				}
+			}
+		}()
+	}
+	select {
+	case w.cleanup <- struct{}{}:
+	default:
+	}
+}
+
+// 切り替えたファイル
+type backup struct {
+	path string
+	time time.Time
+}
+
+// 切り替えたファイルを新しい順に返す
+func (w *Writer) backups() ([]backup, error) {
+	dir, prefix, ext := w.nameParts()
+	if dir == "" {
+		dir = "."
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	location := time.Local
+	if w.UTC {
+		location = time.UTC
+	}
+	var backups []backup
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		stamp := strings.TrimPrefix(name, prefix)
+		if strings.HasSuffix(stamp, ext+".gz") {
+			stamp = strings.TrimSuffix(stamp, ext+".gz")
+		} else if strings.HasSuffix(stamp, ext) {
+			stamp = strings.TrimSuffix(stamp, ext)
+		} else {
+			continue
+		}
+		// 日時として読めない名前は他のファイルなので触らない
+		t, err := time.ParseInLocation(timeFormat, stamp, location)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backup{path: filepath.Join(dir, name), time: t})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].time.After(backups[j].time)
+	})
+	return backups, nil
+}
+
+func (w *Writer) cleanupBackups() error {
+	backups, err := w.backups()
+	if err != nil {
+		return err
+	}
+	var remove, keep []backup
+	cutoff := w.clock().Add(-w.MaxAge)
+	for i, b := range backups {
+		if w.MaxBackups > 0 && i >= w.MaxBackups || w.MaxAge > 0 && b.time.Before(cutoff) {
+			remove = append(remove, b)
+		} else {
+			keep = append(keep, b)
+		}
+	}
+	for _, b := range remove {
+		if err := os.Remove(b.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if !w.Compress {
+		return nil
+	}
+	for _, b := range keep {
+		if strings.HasSuffix(b.path, ".gz") {
+			continue
+		}
+		if err := compressFile(b.path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pathをpath.gzに圧縮して元のファイルを消す
+// 途中で止まっても壊れたpath.gzが残らないように、一時ファイルに書いてからリネームする
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = src.Close()
+	}()
+	stat, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	dst, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(dst.Name())
+	}()
+	gz := gzip.NewWriter(dst)
+	gz.Name = filepath.Base(path)
+	gz.ModTime = stat.ModTime()
+	if _, err := io.Copy(gz, src); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	if err := dst.Chmod(stat.Mode()); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(dst.Name(), path+".gz"); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
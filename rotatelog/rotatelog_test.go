@@ -0,0 +1,248 @@
+package rotatelog
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// テストから進める時計
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+func newWriter(t *testing.T) (*Writer, *fakeClock, string) {
+	dir, err := ioutil.TempDir("", "rotatelog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = os.RemoveAll(dir)
+	})
+	w := New(filepath.Join(dir, "server.log"))
+	clock := &fakeClock{t: time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)}
+	w.now = clock.now
+	w.UTC = true
+	return w, clock, dir
+}
+
+func files(t *testing.T, dir string) []string {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 1秒ごとに1行書く
+func write(t *testing.T, w *Writer, clock *fakeClock, lines ...string) {
+	for _, line := range lines {
+		clock.advance(time.Second)
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMaxSize(t *testing.T) {
+	w, clock, dir := newWriter(t)
+	w.MaxSize = 10
+	write(t, w, clock, "first", "second", "third")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	got := files(t, dir)
+	want := []string{"server-2021-06-01T00-00-02.000.log", "server-2021-06-01T00-00-03.000.log", "server.log"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i, name := range want {
+		b, _ := ioutil.ReadFile(filepath.Join(dir, name))
+		if string(b) != []string{"first\n", "second\n", "third\n"}[i] {
+			t.Errorf("%s: got %q", name, b)
+		}
+	}
+}
+
+func TestInterval(t *testing.T) {
+	w, clock, dir := newWriter(t)
+	w.Interval = 2 * time.Second
+	// 0:00:01に開き、0:00:02と0:00:04の書き込みで切り替わる
+	write(t, w, clock, "a", "b", "c", "d")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	got := files(t, dir)
+	want := []string{"server-2021-06-01T00-00-02.000.log", "server-2021-06-01T00-00-04.000.log", "server.log"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i, name := range want {
+		b, _ := ioutil.ReadFile(filepath.Join(dir, name))
+		if string(b) != []string{"a\n", "b\nc\n", "d\n"}[i] {
+			t.Errorf("%s: got %q", name, b)
+		}
+	}
+}
+
+func TestRetention(t *testing.T) {
+	w, clock, dir := newWriter(t)
+	w.MaxBackups = 2
+	w.Compress = true
+	for i := 0; i < 5; i++ {
+		write(t, w, clock, fmt.Sprint(i))
+		if err := w.Rotate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 関係のないファイルは消さない
+	if err := ioutil.WriteFile(filepath.Join(dir, "server-old.log"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	got := files(t, dir)
+	want := []string{"server-2021-06-01T00-00-04.000.log.gz", "server-2021-06-01T00-00-05.000.log.gz", "server-old.log", "server.log"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	file, err := os.Open(filepath.Join(dir, want[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(gz)
+	if err != nil || string(b) != "4\n" {
+		t.Fatalf("got %q, %v", b, err)
+	}
+}
+
+func TestMaxAge(t *testing.T) {
+	w, clock, dir := newWriter(t)
+	w.MaxAge = 2 * time.Second
+	for i := 0; i < 4; i++ {
+		write(t, w, clock, fmt.Sprint(i))
+		if err := w.Rotate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// 最後の掃除は0:00:04の時点で、0:00:02より前のファイルは消える
+	got := files(t, dir)
+	want := []string{"server-2021-06-01T00-00-02.000.log", "server-2021-06-01T00-00-03.000.log", "server-2021-06-01T00-00-04.000.log", "server.log"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestConcurrentWrites(t *testing.T) {
+	w, _, dir := newWriter(t)
+	w.MaxSize = 1000
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if _, err := fmt.Fprintf(w, "goroutine %d line %02d\n", i, j); err != nil {
+					t.Error(err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	lines := 0
+	for _, name := range files(t, dir) {
+		b, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(b) > 1000 {
+			t.Errorf("%s: %d bytes", name, len(b))
+		}
+		for _, line := range strings.SplitAfter(string(b), "\n") {
+			if line != "" && !strings.HasSuffix(line, "\n") {
+				t.Errorf("%s: broken line %q", name, line)
+			}
+		}
+		lines += strings.Count(string(b), "\n")
+	}
+	if lines != 1000 {
+		t.Fatalf("got %d lines, want 1000", lines)
+	}
+}
+
+func TestReopenOnSignal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("SIGHUP is not supported")
+	}
+	w, clock, dir := newWriter(t)
+	w.ReopenOnSignal(syscall.SIGHUP)
+	write(t, w, clock, "before")
+	// logrotateと同じように外からファイルを移動してからSIGHUPを送る
+	if err := os.Rename(filepath.Join(dir, "server.log"), filepath.Join(dir, "server.log.1")); err != nil {
+		t.Fatal(err)
+	}
+	process, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := process.Signal(syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100 && !exists(filepath.Join(dir, "server.log")); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	write(t, w, clock, "after")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"server.log.1": "before\n", "server.log": "after\n"} {
+		b, _ := ioutil.ReadFile(filepath.Join(dir, name))
+		if string(b) != want {
+			t.Errorf("%s: got %q, want %q", name, b, want)
+		}
+	}
+	if _, err := w.Write([]byte("closed")); err != ErrClosed {
+		t.Errorf("got %v, want ErrClosed", err)
+	}
+}
@@ -0,0 +1,255 @@
+// rotatelogパッケージは大きさや時間でログファイルを切り替える(ローテーションする)io.WriteCloserを提供する
+// write.goではos.Createしたファイルにio.MultiWriterで書き続けていたが、長く動くサーバーではファイルが大きくなり続ける
+// file.goのos.Renameで古いファイルを日時付きの名前に移し、新しいファイルを作り直す
+//
+//	w := rotatelog.New("server.log")
+//	w.MaxSize = 100 * 1024 * 1024
+//	w.MaxBackups = 7
+//	w.Compress = true
+//	w.ReopenOnSignal(syscall.SIGHUP)
+//	defer w.Close()
+//	log.SetOutput(io.MultiWriter(w, os.Stdout))
+package rotatelog
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 切り替えたファイルの名前に付ける日時の書式
+// Windowsでも使えるように:を含めない。同じ秒に何度も切り替えても重ならないようにミリ秒まで付ける
+const timeFormat = "2006-01-02T15-04-05.000"
+
+var ErrClosed = errors.New("rotatelog: writer is closed")
+
+// 大きさや時間でファイルを切り替えるio.WriteCloser
+// 複数のgoroutineから同時に書き込んでもよい
+// 各フィールドは最初のWrite()の前に設定する
+type Writer struct {
+	// 書き込むファイルのパス。切り替えたファイルは同じディレクトリに「server-2021-06-01T15-04-05.000.log」のような名前で残る
+	Path string
+	// ファイルがこの大きさを超える前に切り替える(0なら大きさでは切り替えない)
+	// 1回の書き込みがこれより大きい場合は、切り替えたあとにそのまま書く
+	MaxSize int64
+	// この間隔ごとに切り替える(0なら時間では切り替えない)
+	// 区切りはtime.Truncate()と同じくゼロ時刻(UTC)が基準なので、24時間ならUTCの0時に切り替わる
+	Interval time.Duration
+	// 残しておく古いファイルの数(0なら全て残す)
+	MaxBackups int
+	// 古いファイルを残しておく期間(0なら期限なし)
+	MaxAge time.Duration
+	// 古いファイルをgzipで圧縮する
+	Compress bool
+	// ファイル名の日時をUTCにする(既定はローカル時刻)
+	UTC bool
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+	// 時間で切り替える次の時刻
+	next   time.Time
+	closed bool
+	// 古いファイルの圧縮と削除をするgoroutineへの通知
+	cleanup     chan struct{}
+	cleanupDone chan struct{}
+	signals     chan os.Signal
+	signalsDone chan struct{}
+	// テストで時刻を差し替える
+	now func() time.Time
+}
+
+func New(path string) *Writer {
+	return &Writer{Path: path, now: time.Now}
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, ErrClosed
+	}
+	if w.file == nil {
+		if err := w.open(); err != nil {
+			return 0, err
+		}
+	}
+	sizeExceeded := w.MaxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.MaxSize
+	timeExceeded := w.Interval > 0 && !w.clock().Before(w.next)
+	if sizeExceeded || timeExceeded {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// すぐに切り替える
+func (w *Writer) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return ErrClosed
+	}
+	if w.file == nil {
+		if err := w.open(); err != nil {
+			return err
+		}
+	}
+	return w.rotate()
+}
+
+// ファイルを開き直す
+// logrotateなどの外部のツールがファイルを移動したあとに呼ぶと、元のパスに新しいファイルを作って書き込む
+func (w *Writer) Reopen() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return ErrClosed
+	}
+	if w.file != nil {
+		if err := w.file.Close(); err != nil {
+			return err
+		}
+		w.file = nil
+	}
+	return w.open()
+}
+
+// シグナル(通常はSIGHUP)を受け取るたびにReopen()する
+// logrotateのpostrotateでkill -HUPする設定と組み合わせる
+func (w *Writer) ReopenOnSignal(signals ...os.Signal) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.signals != nil || w.closed {
+		return
+	}
+	w.signals = make(chan os.Signal, 1)
+	w.signalsDone = make(chan struct{})
+	signal.Notify(w.signals, signals...)
+	go func() {
+		defer close(w.signalsDone)
+		for range w.signals {
+			if err := w.Reopen(); err != nil {
+				// 書き込み先がないのでエラーは標準エラー出力に出す
+				fmt.Fprintln(os.Stderr, err)
+			}
+		}
+	}()
+}
+
+// ファイルを閉じ、シグナルの受け取りと、古いファイルの圧縮や削除が終わるのを待つ
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	var err error
+	if w.file != nil {
+		err = w.file.Close()
+		w.file = nil
+	}
+	signals, signalsDone := w.signals, w.signalsDone
+	cleanup, cleanupDone := w.cleanup, w.cleanupDone
+	w.mu.Unlock()
+
+	// Reopen()がロックを取るので、ロックを外してから待つ
+	if signals != nil {
+		signal.Stop(signals)
+		close(signals)
+		<-signalsDone
+	}
+	if cleanup != nil {
+		close(cleanup)
+		<-cleanupDone
+	}
+	return err
+}
+
+func (w *Writer) clock() time.Time {
+	if w.now == nil {
+		return time.Now()
+	}
+	return w.now()
+}
+
+// 追記モードでファイルを開く。既存のファイルがあればその大きさと更新日時から続ける
+func (w *Writer) open() error {
+	if err := os.MkdirAll(filepath.Dir(w.Path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(w.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	w.file = file
+	w.size = stat.Size()
+	start := w.clock()
+	if w.size > 0 {
+		// 前回の区切りのうちに書かれたファイルなら、次の書き込みで切り替える
+		start = stat.ModTime()
+	}
+	if w.Interval > 0 {
+		w.next = start.Truncate(w.Interval).Add(w.Interval)
+	}
+	return nil
+}
+
+// 今のファイルを日時付きの名前に移して、新しいファイルを開く
+func (w *Writer) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	w.file = nil
+	if w.size > 0 {
+		// 同じミリ秒に切り替えた古いファイルを上書きしないように、ずらした名前にする
+		t := w.clock()
+		name := w.backupName(t)
+		for exists(name) || exists(name+".gz") {
+			t = t.Add(time.Millisecond)
+			name = w.backupName(t)
+		}
+		if err := os.Rename(w.Path, name); err != nil {
+			return err
+		}
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+	w.startCleanup()
+	return nil
+}
+
+// server.log -> server-2021-06-01T15-04-05.000.log
+func (w *Writer) backupName(t time.Time) string {
+	if w.UTC {
+		t = t.UTC()
+	}
+	dir, prefix, ext := w.nameParts()
+	return filepath.Join(dir, prefix+t.Format(timeFormat)+ext)
+}
+
+func (w *Writer) nameParts() (dir, prefix, ext string) {
+	dir, base := filepath.Split(w.Path)
+	ext = filepath.Ext(base)
+	return dir, strings.TrimSuffix(base, ext) + "-", ext
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
@@ -621,11 +621,12 @@ func processSessionWithChunk(conn net.Conn) {
 			panic(err)
 		}
 		fmt.Println(string(dump))
+		// 日本語のテキストなのでcharsetを明示する。クライアントはcharset.NewResponseReader()で文字コードを判断できる
 		if _, err := fmt.Fprintf(
 			conn,
 			strings.Join([]string{
 				"HTTP/1.1 200 OK",
-				"Content-Type: text/plain",
+				"Content-Type: text/plain; charset=utf-8",
 				"Transfer-Encoding: chunked",
 				"",
 				"",
@@ -0,0 +1,55 @@
+package tlv
+
+import "encoding/binary"
+
+// PNG: シグニチャのあとに、長さ(ビッグエンディアン) + 種類 + データ + CRC
+var PNG = &Format{
+	Name:      "PNG",
+	Signature: []byte("\x89PNG\r\n\x1a\n"),
+	ByteOrder: binary.BigEndian,
+	SizeFirst: true,
+	CRC:       true,
+}
+
+// RIFF(WAV、AVI、WebP): 種類 + 長さ(リトルエンディアン) + データ + 奇数長なら1バイトのパディング
+// ファイル全体がRIFFチャンク1つで、その中にフォーム型(WAVE、AVI )と子のチャンクが続く
+var RIFF = &Format{
+	Name:      "RIFF",
+	ByteOrder: binary.LittleEndian,
+	Align:     2,
+	Containers: map[string]int{
+		"RIFF": 4,
+		"LIST": 4,
+	},
+	FormType: true,
+}
+
+// IFF(AIFFなど): RIFFの元になった形式で、長さがビッグエンディアン
+var IFF = &Format{
+	Name:      "IFF",
+	ByteOrder: binary.BigEndian,
+	Align:     2,
+	Containers: map[string]int{
+		"FORM": 4,
+		"LIST": 4,
+		"CAT ": 4,
+	},
+	FormType: true,
+}
+
+// ISO-BMFF(MP4、MOV、HEIF): 長さ(ヘッダーを含む、ビッグエンディアン) + 種類 + データ
+// 長さが1なら64ビットの長さが続き、0ならファイルの終わりまで
+var BMFF = &Format{
+	Name:               "ISO-BMFF",
+	ByteOrder:          binary.BigEndian,
+	SizeFirst:          true,
+	SizeIncludesHeader: true,
+	ExtendedSize:       true,
+	UserType:           "uuid",
+	Containers: map[string]int{
+		"moov": 0, "trak": 0, "edts": 0, "mdia": 0, "minf": 0, "dinf": 0, "stbl": 0,
+		"mvex": 0, "moof": 0, "traf": 0, "mfra": 0, "udta": 0, "ilst": 0,
+		// metaはFullBoxなので、子のボックスの前に4バイトのバージョンとフラグがある
+		"meta": 4,
+	},
+}
@@ -0,0 +1,304 @@
+// tlvパッケージは「長さ + 種類 + データ」(TLV)のチャンクが並んだバイナリ形式を読む
+// read.goのreadChunksはPNG専用だったが、RIFF(WAV、AVI)、IFF(AIFF)、ISO-BMFF(MP4)のボックスも
+// エンディアン、ヘッダーの並び、パディング、CRCの有無が違うだけで同じ形をしているので、Formatとしてまとめて扱う
+package tlv
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+var (
+	ErrSignature    = errors.New("tlv: signature mismatch")
+	ErrSize         = errors.New("tlv: invalid chunk size")
+	ErrCRC          = errors.New("tlv: CRC mismatch")
+	ErrNotContainer = errors.New("tlv: chunk is not a container")
+)
+
+// 形式ごとのチャンクの構造
+type Format struct {
+	Name string
+	// ファイルの先頭にあるシグニチャ(PNGの8バイトなど)
+	Signature []byte
+	ByteOrder binary.ByteOrder
+	// trueなら長さ(4バイト)、種類(4バイト)の順。falseなら種類、長さの順
+	SizeFirst bool
+	// 長さにヘッダー自身の大きさを含むか(ISO-BMFF)
+	SizeIncludesHeader bool
+	// 長さが1なら後ろに64ビットの長さが続き、0ならファイル(親のボックス)の終わりまで(ISO-BMFF)
+	ExtendedSize bool
+	// 種類がこの値なら、後ろに16バイトの独自の種類(UUID)が続く(ISO-BMFFのuuid)
+	UserType string
+	// チャンクの終わりをこのバイト数の倍数に揃える(RIFFとIFFは2)
+	// パディングは長さに含まれない
+	Align int
+	// データの後ろに、種類とデータに対するCRC-32(IEEE)がある(PNG)
+	CRC bool
+	// 中にチャンクを含むコンテナの種類と、子のチャンクの前にあるヘッダーの大きさ
+	// RIFFやLISTは4バイトのフォーム型(WAVE、INFOなど)、ISO-BMFFのmetaは4バイトのバージョンとフラグ
+	Containers map[string]int
+	// コンテナの中のヘッダーをFormTypeとして取り出すか(RIFF、IFF)
+	FormType bool
+}
+
+// チャンク1つの位置と大きさ
+type Chunk struct {
+	Type string
+	// Typeがuuidの場合の16バイトの独自の種類
+	UserType []byte
+	// フォーム型(RIFFのWAVE、LISTのINFOなど)
+	FormType string
+	// ヘッダーの先頭の位置
+	Offset int64
+	// ヘッダー(長さ、種類、拡張された長さ、UUID)の大きさ
+	HeaderSize int64
+	// データの大きさ(ヘッダー、パディング、CRCを含まない)
+	Size int64
+	// データの後ろに記録されていたCRC
+	CRC uint32
+	// 親のチャンク(トップレベルではnil)
+	Parent *Chunk
+}
+
+// データの先頭の位置
+func (c *Chunk) DataOffset() int64 {
+	return c.Offset + c.HeaderSize
+}
+
+// トップレベルからの種類をつなげたパス(moov/trak/mdiaなど)
+func (c *Chunk) Path() string {
+	if c.Parent == nil {
+		return c.Type
+	}
+	return c.Parent.Path() + "/" + c.Type
+}
+
+func (c *Chunk) String() string {
+	if c.FormType != "" {
+		return fmt.Sprintf("chunk '%s' (%s), (%d bytes)", c.Type, c.FormType, c.Size)
+	}
+	return fmt.Sprintf("chunk '%s', (%d bytes)", c.Type, c.Size)
+}
+
+// チャンクを読むときのエラーに位置と種類を付け加えたもの
+type ChunkError struct {
+	Offset int64
+	Type   string
+	Err    error
+}
+
+func (e *ChunkError) Error() string {
+	if e.Type == "" {
+		return fmt.Sprintf("%v at offset %d", e.Err, e.Offset)
+	}
+	return fmt.Sprintf("%v in chunk '%s' at offset %d", e.Err, e.Type, e.Offset)
+}
+
+func (e *ChunkError) Unwrap() error {
+	return e.Err
+}
+
+// io.ReaderAtのファイル全体や、コンテナのデータ部分に並んだチャンクを順に読む
+// 子のチャンクはChildren()で同じように読める
+type Walker struct {
+	format *Format
+	r      io.ReaderAt
+	parent *Chunk
+	offset int64
+	end    int64
+	// Next()の最初の呼び出しでシグニチャを確かめる
+	checkSignature bool
+}
+
+// sizeはファイルの大きさ(*os.FileならStat()のSize())
+func NewWalker(format *Format, r io.ReaderAt, size int64) *Walker {
+	return &Walker{format: format, r: r, end: size, checkSignature: len(format.Signature) > 0}
+}
+
+// 次のチャンクの位置と大きさを読み込む
+// データは読まないので、大きなチャンクも読み飛ばすだけになる。終わりに達するとio.EOFを返す
+func (w *Walker) Next() (*Chunk, error) {
+	f := w.format
+	if w.checkSignature {
+		w.checkSignature = false
+		signature := make([]byte, len(f.Signature))
+		if _, err := w.r.ReadAt(signature, w.offset); err != nil || string(signature) != string(f.Signature) {
+			return nil, ErrSignature
+		}
+		w.offset += int64(len(signature))
+	}
+	if w.offset >= w.end {
+		return nil, io.EOF
+	}
+	c := &Chunk{Offset: w.offset, HeaderSize: 8, Parent: w.parent}
+	fail := func(err error) (*Chunk, error) {
+		// 壊れたチャンクの後ろは読めないので、以降はエラーを返し続ける代わりに終わりにする
+		w.offset = w.end
+		return nil, &ChunkError{Offset: c.Offset, Type: c.Type, Err: err}
+	}
+	header := make([]byte, 8)
+	if err := w.readAt(header, c.Offset); err != nil {
+		return fail(err)
+	}
+	var size uint64
+	if f.SizeFirst {
+		size = uint64(f.ByteOrder.Uint32(header))
+		c.Type = string(header[4:])
+	} else {
+		c.Type = string(header[:4])
+		size = uint64(f.ByteOrder.Uint32(header[4:]))
+	}
+	toEnd := false
+	if f.ExtendedSize {
+		switch size {
+		case 0:
+			toEnd = true
+		case 1:
+			extended := make([]byte, 8)
+			if err := w.readAt(extended, c.Offset+8); err != nil {
+				return fail(err)
+			}
+			size = f.ByteOrder.Uint64(extended)
+			c.HeaderSize += 8
+		}
+	}
+	if f.UserType != "" && c.Type == f.UserType {
+		c.UserType = make([]byte, 16)
+		if err := w.readAt(c.UserType, c.Offset+c.HeaderSize); err != nil {
+			return fail(err)
+		}
+		c.HeaderSize += 16
+	}
+	if toEnd {
+		c.Size = w.end - c.DataOffset()
+	} else {
+		if f.SizeIncludesHeader {
+			if size < uint64(c.HeaderSize) {
+				return fail(ErrSize)
+			}
+			size -= uint64(c.HeaderSize)
+		}
+		if size > uint64(w.end-c.DataOffset()) {
+			return fail(io.ErrUnexpectedEOF)
+		}
+		c.Size = int64(size)
+	}
+
+	next := c.DataOffset() + c.Size
+	if f.CRC {
+		b := make([]byte, 4)
+		if err := w.readAt(b, next); err != nil {
+			return fail(err)
+		}
+		c.CRC = binary.BigEndian.Uint32(b)
+		next += 4
+	}
+	if f.Align > 1 && next%int64(f.Align) != 0 {
+		next += int64(f.Align) - next%int64(f.Align)
+		// 最後のチャンクのパディングが省略されているファイルもよくあるので許す
+		if next > w.end {
+			next = w.end
+		}
+	}
+	if f.FormType {
+		if n, ok := f.Containers[c.Type]; ok && n == 4 && c.Size >= 4 {
+			form := make([]byte, 4)
+			if err := w.readAt(form, c.DataOffset()); err != nil {
+				return fail(err)
+			}
+			c.FormType = string(form)
+		}
+	}
+	w.offset = next
+	return c, nil
+}
+
+func (w *Walker) readAt(b []byte, offset int64) error {
+	if offset+int64(len(b)) > w.end {
+		return io.ErrUnexpectedEOF
+	}
+	_, err := w.r.ReadAt(b, offset)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// チャンクのデータ部分
+func (w *Walker) Data(c *Chunk) *io.SectionReader {
+	return io.NewSectionReader(w.r, c.DataOffset(), c.Size)
+}
+
+// コンテナのチャンクの中のチャンクを読むWalker
+func (w *Walker) Children(c *Chunk) (*Walker, error) {
+	n, ok := w.format.Containers[c.Type]
+	if !ok {
+		return nil, &ChunkError{Offset: c.Offset, Type: c.Type, Err: ErrNotContainer}
+	}
+	if c.Size < int64(n) {
+		return nil, &ChunkError{Offset: c.Offset, Type: c.Type, Err: ErrSize}
+	}
+	return &Walker{
+		format: w.format,
+		r:      w.r,
+		parent: c,
+		offset: c.DataOffset() + int64(n),
+		end:    c.DataOffset() + c.Size,
+	}, nil
+}
+
+// 記録されていたCRCがデータと一致するかを確かめる
+// CRCのない形式では何もしない
+func (w *Walker) Verify(c *Chunk) error {
+	if !w.format.CRC {
+		return nil
+	}
+	crc := crc32.NewIEEE()
+	_, _ = io.WriteString(crc, c.Type)
+	if _, err := io.Copy(crc, w.Data(c)); err != nil {
+		return err
+	}
+	if crc.Sum32() != c.CRC {
+		return &ChunkError{Offset: c.Offset, Type: c.Type, Err: ErrCRC}
+	}
+	return nil
+}
+
+// 全てのチャンクを深さ優先でたどり、fnを呼ぶ
+// コンテナは自分自身のあとに中のチャンクをたどる。fnがSkipを返すと、そのコンテナの中には入らない
+func Walk(format *Format, r io.ReaderAt, size int64, fn func(w *Walker, c *Chunk) error) error {
+	return walk(NewWalker(format, r, size), fn)
+}
+
+// Walk()のfnが返すと、コンテナの中をたどらない
+var Skip = errors.New("tlv: skip this container")
+
+func walk(w *Walker, fn func(w *Walker, c *Chunk) error) error {
+	for {
+		c, err := w.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(w, c); err == Skip {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if _, ok := w.format.Containers[c.Type]; !ok {
+			continue
+		}
+		children, err := w.Children(c)
+		if err != nil {
+			return err
+		}
+		if err := walk(children, fn); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package tlv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func riffChunk(typ string, data []byte) []byte {
+	b := []byte(typ)
+	b = append(b, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(b[4:], uint32(len(data)))
+	b = append(b, data...)
+	if len(data)%2 == 1 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+func box(typ string, data ...[]byte) []byte {
+	body := bytes.Join(data, nil)
+	b := make([]byte, 8, 8+len(body))
+	binary.BigEndian.PutUint32(b, uint32(8+len(body)))
+	copy(b[4:], typ)
+	return append(b, body...)
+}
+
+// Walk()でたどったチャンクのパスとフォーム型、大きさを並べる
+func walkAll(t *testing.T, format *Format, b []byte) []string {
+	t.Helper()
+	var got []string
+	err := Walk(format, bytes.NewReader(b), int64(len(b)), func(w *Walker, c *Chunk) error {
+		s := c.Path()
+		if c.FormType != "" {
+			s += "(" + c.FormType + ")"
+		}
+		got = append(got, fmt.Sprintf("%s:%d", s, c.Size))
+		return w.Verify(c)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func TestRIFF(t *testing.T) {
+	// 奇数長のチャンク(パディングあり)とLISTを含むWAVファイル
+	inner := bytes.Join([][]byte{
+		[]byte("WAVE"),
+		riffChunk("fmt ", make([]byte, 16)),
+		riffChunk("LIST", bytes.Join([][]byte{
+			[]byte("INFO"),
+			riffChunk("INAM", []byte("title")),
+			riffChunk("IART", []byte("gopher\x00")),
+		}, nil)),
+		riffChunk("data", make([]byte, 9)),
+	}, nil)
+	wav := riffChunk("RIFF", inner)
+	got := strings.Join(walkAll(t, RIFF, wav), " ")
+	want := "RIFF(WAVE):88 RIFF/fmt :16 RIFF/LIST(INFO):34 RIFF/LIST/INAM:5 RIFF/LIST/IART:7 RIFF/data:9"
+	if got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+
+	// 最後のチャンクのパディングが省略されていても読める
+	wav = riffChunk("RIFF", inner[:len(inner)-1])
+	got = strings.Join(walkAll(t, RIFF, wav[:len(wav)-1]), " ")
+	if want := "RIFF(WAVE):87 RIFF/fmt :16 RIFF/LIST(INFO):34 RIFF/LIST/INAM:5 RIFF/LIST/IART:7 RIFF/data:9"; got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestIFF(t *testing.T) {
+	chunk := func(typ string, data []byte) []byte {
+		b := []byte(typ)
+		b = append(b, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(b[4:], uint32(len(data)))
+		b = append(b, data...)
+		if len(data)%2 == 1 {
+			b = append(b, 0)
+		}
+		return b
+	}
+	aiff := chunk("FORM", bytes.Join([][]byte{
+		[]byte("AIFF"),
+		chunk("COMM", make([]byte, 18)),
+		chunk("NAME", []byte("abc")),
+		chunk("SSND", make([]byte, 12)),
+	}, nil))
+	got := strings.Join(walkAll(t, IFF, aiff), " ")
+	if want := "FORM(AIFF):62 FORM/COMM:18 FORM/NAME:3 FORM/SSND:12"; got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestBMFF(t *testing.T) {
+	// 64ビットの長さを持つmdat
+	large := make([]byte, 16, 16+5)
+	binary.BigEndian.PutUint32(large, 1)
+	copy(large[4:], "mdat")
+	binary.BigEndian.PutUint64(large[8:], 16+5)
+	large = append(large, 1, 2, 3, 4, 5)
+
+	uuid := box("uuid", []byte("0123456789abcdef"), []byte("xyz"))
+	// 長さ0はファイルの終わりまで
+	last := append([]byte{0, 0, 0, 0}, []byte("free1234567")...)
+
+	mp4 := bytes.Join([][]byte{
+		box("ftyp", []byte("isom\x00\x00\x02\x00")),
+		box("moov",
+			box("mvhd", make([]byte, 100)),
+			box("trak", box("tkhd", make([]byte, 84)), box("mdia", box("mdhd", make([]byte, 24)))),
+			box("udta", box("meta", make([]byte, 4), box("hdlr", make([]byte, 25)), box("ilst"))),
+		),
+		large,
+		uuid,
+		last,
+	}, nil)
+	got := strings.Join(walkAll(t, BMFF, mp4), " ")
+	want := "ftyp:8 moov:309 moov/mvhd:100 moov/trak:132 moov/trak/tkhd:84 moov/trak/mdia:32 moov/trak/mdia/mdhd:24 " +
+		"moov/udta:53 moov/udta/meta:45 moov/udta/meta/hdlr:25 moov/udta/meta/ilst:0 mdat:5 uuid:3 free:7"
+	if got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+
+	w := NewWalker(BMFF, bytes.NewReader(mp4), int64(len(mp4)))
+	for {
+		c, err := w.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Type == "uuid" {
+			if string(c.UserType) != "0123456789abcdef" || c.HeaderSize != 24 {
+				t.Errorf("uuid box: %q, header %d", c.UserType, c.HeaderSize)
+			}
+			data, _ := ioutil.ReadAll(w.Data(c))
+			if string(data) != "xyz" {
+				t.Errorf("uuid data = %q", data)
+			}
+			if _, err := w.Children(c); !errors.Is(err, ErrNotContainer) {
+				t.Errorf("Children(uuid) error = %v", err)
+			}
+			break
+		}
+	}
+
+	// 親の範囲を超える長さ
+	broken := box("moov", box("trak"))
+	binary.BigEndian.PutUint32(broken[8:], 100)
+	err := Walk(BMFF, bytes.NewReader(broken), int64(len(broken)), func(*Walker, *Chunk) error { return nil })
+	var chunkError *ChunkError
+	if !errors.As(err, &chunkError) || chunkError.Type != "trak" || !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("error = %v", err)
+	}
+}
+
+func TestPNG(t *testing.T) {
+	b, err := ioutil.ReadFile("../img.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	err = Walk(PNG, bytes.NewReader(b), int64(len(b)), func(w *Walker, c *Chunk) error {
+		types = append(types, c.Type)
+		return w.Verify(c)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(types) != 27 || types[0] != "IHDR" || types[26] != "IEND" {
+		t.Errorf("types = %v", types)
+	}
+
+	b[100] ^= 1
+	err = Walk(PNG, bytes.NewReader(b), int64(len(b)), func(w *Walker, c *Chunk) error {
+		return w.Verify(c)
+	})
+	if !errors.Is(err, ErrCRC) {
+		t.Errorf("error = %v, want ErrCRC", err)
+	}
+
+	if _, err := NewWalker(PNG, strings.NewReader("GIF89a.."), 8).Next(); err != ErrSignature {
+		t.Errorf("error = %v, want ErrSignature", err)
+	}
+}
@@ -8,6 +8,7 @@ import (
 
 // UDPはコネクションレスでプロトコルとして、データの検知をすることも、通信速度の制限もすることもなく、パッケトの到着順序も管理しないで一方的にデータを送りつけるのに使われる
 // 複数のコンピュータに同時にメッセージを送ることが可能なマルチキャスト、ブロードキャストをサポートしている
+// ブロードキャストの送受信はudpcastパッケージのDialBroadcast()とListenBroadcast()で、マルチキャストと同じtickメッセージを使って試せる(go run ./cmd/tick -broadcast)
 
 const interval = 10 * time.Second
 
@@ -25,6 +26,8 @@ func main() {
 				panic(err)
 			}
 		}()
+		// 1つのゴルーチンで1つずつ読み込んでいるので、大量のデータグラムを受け取るとシステムコールの回数が多くなり、受信バッファがあふれて捨てられる
+		// recvmmsg/sendmmsgでまとめて読み書きし、SO_REUSEPORTで複数のソケットに分散するにはudpbatchパッケージを使う
 		buffer := make([]byte, 1500)
 		for {
 			// 通信内容を読み込むと同時に接続してきた相手のアドレス情報を受け取れる
@@ -40,6 +43,8 @@ func main() {
 	*/
 
 	// クライアント側の実装
+	// データグラムが失われるとconn.Read()は永久にブロックしてしまう
+	// タイムアウトと再送、サーバー側での重複の排除、1500バイトを超えるメッセージの分割が必要な場合はdgramrpcパッケージを使う
 	/*
 		conn, err := net.Dial("udp4", "localhost:8888")
 		if err != nil {
@@ -83,6 +88,7 @@ func main() {
 		start := time.Now()
 		wait := start.Truncate(interval).Add(interval).Sub(start)
 		time.Sleep(wait)
+		// now.String()では受信側で時計のずれや抜けを調べられないので、udpcast.ServeTicks()はシーケンス番号と時刻をバイナリで送る
 		ticker := time.Tick(interval)
 		for now := range ticker {
 			if _, err := conn.Write([]byte(now.String())); err != nil {
@@ -96,6 +102,8 @@ func main() {
 	// UDPのマルチキャストはクライアントがソケットをオープンして待ち受け、そこにサーバーがデータを送信する
 	// TCPではサーバーが起動してクライアントを待ち受けていてリクエストが来たらレスポンスを返す
 	// (多対多通信)クライアント側で複数のネットワーク接続がある時に特定のLAN環境のマルチキャストを受信するにはnet.InterfaceByName("en0")のように書いて、イーサネットのインターフェース情報を取得し、net.ListenMultiCastUDP()関数の第二引数に渡す
+	// グループのアドレスやポート、インターフェース、TTL、ループバックを設定で指定したり、複数のグループやソース固定マルチキャスト(SSM)、IPv6のグループを使うにはudpcastパッケージを使う(go run ./cmd/tick)
+	// 同じマルチキャストの仕組みで、224.0.0.251:5353を使うmDNS/DNS-SDのサービスディスカバリも実装できる(udpcast/mdnsパッケージ、go run ./cmd/mdns)
 	fmt.Println("Listen tick server at 224.0.0.1:9999")
 	address, err := net.ResolveUDPAddr("udp", "224.0.0.1:9999")
 	if err != nil {
@@ -0,0 +1,174 @@
+package udpbatch
+
+import (
+	"net"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// recvmmsg/sendmmsgに渡すstruct mmsghdr
+// msg_lenにはそのメッセージで読み書きしたバイト数が入る
+// Cと同じくGoの構造体の大きさもポインタの境界に切り上げられるので、末尾の詰め物は書かなくても
+// 64ビットでは64バイト、32ビットでは32バイトになり、カーネルが想定する配列の間隔と一致する
+type mmsghdr struct {
+	hdr unix.Msghdr
+	len uint32
+}
+
+// システムコールに渡すヘッダーなどの作業用の領域
+// 書き込みは複数のワーカーから同時に呼ばれるので、呼び出しごとにプールから取り出す
+type scratch struct {
+	hdrs  []mmsghdr
+	iovs  []unix.Iovec
+	names []unix.RawSockaddrInet6
+}
+
+var scratchPool = sync.Pool{New: func() interface{} { return new(scratch) }}
+
+func (s *scratch) prepare(n int) {
+	if cap(s.hdrs) < n {
+		s.hdrs = make([]mmsghdr, n)
+		s.iovs = make([]unix.Iovec, n)
+		s.names = make([]unix.RawSockaddrInet6, n)
+	}
+	s.hdrs, s.iovs, s.names = s.hdrs[:n], s.iovs[:n], s.names[:n]
+	// 前回の呼び出しの値(特に制御メッセージ)が残らないように全て初期化する
+	for i := range s.hdrs {
+		s.hdrs[i] = mmsghdr{}
+		s.names[i] = unix.RawSockaddrInet6{}
+	}
+}
+
+type rawBatchConn struct {
+	raw syscall.RawConn
+}
+
+func newBatchConn(conn *net.UDPConn) (batchConn, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	return &rawBatchConn{raw: raw}, nil
+}
+
+func (c *rawBatchConn) ReadBatch(ms []message) (int, error) {
+	s := scratchPool.Get().(*scratch)
+	defer scratchPool.Put(s)
+	s.prepare(len(ms))
+	for i := range ms {
+		buffer := ms[i].Buffer[:cap(ms[i].Buffer)]
+		s.iovs[i].Base = &buffer[0]
+		s.iovs[i].SetLen(len(buffer))
+		h := &s.hdrs[i].hdr
+		h.Iov = &s.iovs[i]
+		h.SetIovlen(1)
+		h.Name = (*byte)(unsafe.Pointer(&s.names[i]))
+		h.Namelen = uint32(unsafe.Sizeof(s.names[i]))
+		if oob := ms[i].OOB[:cap(ms[i].OOB)]; len(oob) > 0 {
+			h.Control = &oob[0]
+			h.SetControllen(len(oob))
+		}
+	}
+	var n int
+	var errno syscall.Errno
+	// ソケットはノンブロッキングなので、データが無ければEAGAINが返る
+	// falseを返すとランタイムのネットワークポーラーで読み込めるようになるまで待ってから再度呼ばれる
+	err := c.raw.Read(func(fd uintptr) bool {
+		r, _, e := syscall.Syscall6(unix.SYS_RECVMMSG, fd, uintptr(unsafe.Pointer(&s.hdrs[0])), uintptr(len(s.hdrs)), 0, 0, 0)
+		n, errno = int(r), e
+		return errno != unix.EAGAIN
+	})
+	if err != nil {
+		return 0, err
+	}
+	if errno != 0 {
+		return 0, &net.OpError{Op: "recvmmsg", Net: "udp", Err: errno}
+	}
+	for i := 0; i < n; i++ {
+		h := &s.hdrs[i]
+		ms[i].Buffer = ms[i].Buffer[:h.len]
+		ms[i].OOB = ms[i].OOB[:h.hdr.Controllen]
+		ms[i].Addr = parseSockaddr(&s.names[i])
+	}
+	return n, nil
+}
+
+func (c *rawBatchConn) WriteBatch(ms []message) (int, error) {
+	s := scratchPool.Get().(*scratch)
+	defer scratchPool.Put(s)
+	s.prepare(len(ms))
+	for i := range ms {
+		if len(ms[i].Buffer) > 0 {
+			s.iovs[i].Base = &ms[i].Buffer[0]
+			s.iovs[i].SetLen(len(ms[i].Buffer))
+		}
+		h := &s.hdrs[i].hdr
+		h.Iov = &s.iovs[i]
+		h.SetIovlen(1)
+		h.Name = (*byte)(unsafe.Pointer(&s.names[i]))
+		h.Namelen = marshalSockaddr(ms[i].Addr, &s.names[i])
+	}
+	var n int
+	var errno syscall.Errno
+	err := c.raw.Write(func(fd uintptr) bool {
+		r, _, e := syscall.Syscall6(unix.SYS_SENDMMSG, fd, uintptr(unsafe.Pointer(&s.hdrs[0])), uintptr(len(s.hdrs)), 0, 0, 0)
+		n, errno = int(r), e
+		return errno != unix.EAGAIN
+	})
+	if err != nil {
+		return 0, err
+	}
+	if errno != 0 {
+		return 0, &net.OpError{Op: "sendmmsg", Net: "udp", Err: errno}
+	}
+	return n, nil
+}
+
+// sockaddr_in6はsockaddr_inより大きいので、どちらの受け取りにも使える
+func parseSockaddr(name *unix.RawSockaddrInet6) *net.UDPAddr {
+	switch name.Family {
+	case unix.AF_INET:
+		sa := (*unix.RawSockaddrInet4)(unsafe.Pointer(name))
+		ip := make(net.IP, net.IPv4len)
+		copy(ip, sa.Addr[:])
+		return &net.UDPAddr{IP: ip, Port: int(ntohs(sa.Port))}
+	case unix.AF_INET6:
+		ip := make(net.IP, net.IPv6len)
+		copy(ip, name.Addr[:])
+		return &net.UDPAddr{IP: ip, Port: int(ntohs(name.Port))}
+	}
+	return nil
+}
+
+func marshalSockaddr(addr *net.UDPAddr, name *unix.RawSockaddrInet6) uint32 {
+	if ip4 := addr.IP.To4(); ip4 != nil {
+		sa := (*unix.RawSockaddrInet4)(unsafe.Pointer(name))
+		sa.Family = unix.AF_INET
+		sa.Port = htons(uint16(addr.Port))
+		copy(sa.Addr[:], ip4)
+		return unix.SizeofSockaddrInet4
+	}
+	name.Family = unix.AF_INET6
+	name.Port = htons(uint16(addr.Port))
+	copy(name.Addr[:], addr.IP.To16())
+	if addr.Zone != "" {
+		if iface, err := net.InterfaceByName(addr.Zone); err == nil {
+			name.Scope_id = uint32(iface.Index)
+		}
+	}
+	return unix.SizeofSockaddrInet6
+}
+
+// ポート番号はネットワークバイトオーダー(ビッグエンディアン)で格納されている
+func ntohs(port uint16) uint16 {
+	b := (*[2]byte)(unsafe.Pointer(&port))
+	return uint16(b[0])<<8 | uint16(b[1])
+}
+
+// バイトの入れ替えは対称なので、ntohsと同じ処理でネットワークバイトオーダーにできる
+func htons(port uint16) uint16 {
+	return ntohs(port)
+}
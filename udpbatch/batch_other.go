@@ -0,0 +1,36 @@
+//go:build !linux
+// +build !linux
+
+package udpbatch
+
+import (
+	"net"
+)
+
+// recvmmsg/sendmmsgが無いOSでは1つずつ読み書きする
+type singleConn struct {
+	conn *net.UDPConn
+}
+
+func newBatchConn(conn *net.UDPConn) (batchConn, error) {
+	return &singleConn{conn: conn}, nil
+}
+
+func (c *singleConn) ReadBatch(ms []message) (int, error) {
+	buffer := ms[0].Buffer[:cap(ms[0].Buffer)]
+	n, addr, err := c.conn.ReadFromUDP(buffer)
+	if err != nil {
+		return 0, err
+	}
+	ms[0].Buffer = buffer[:n]
+	ms[0].OOB = ms[0].OOB[:0]
+	ms[0].Addr = addr
+	return 1, nil
+}
+
+func (c *singleConn) WriteBatch(ms []message) (int, error) {
+	if _, err := c.conn.WriteToUDP(ms[0].Buffer, ms[0].Addr); err != nil {
+		return 0, err
+	}
+	return 1, nil
+}
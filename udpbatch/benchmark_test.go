@@ -0,0 +1,100 @@
+package udpbatch
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// udp.goのサーバーと同じ、1つのゴルーチンで1つずつ読み書きするループ
+func serveSingleLoop(conn net.PacketConn, handler Handler) {
+	buffer := make([]byte, DefaultMaxPacketSize)
+	for {
+		length, remoteAddress, err := conn.ReadFrom(buffer)
+		if err != nil {
+			return
+		}
+		if reply := handler(buffer[:length], remoteAddress); reply != nil {
+			if _, err := conn.WriteTo(reply, remoteAddress); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// window個ずつ送っては応答を待つクライアント
+// クライアント側がボトルネックにならないように、クライアントもsendmmsg/recvmmsgを使う
+func runLoad(b *testing.B, addr net.Addr) {
+	const window = 32
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer conn.Close()
+	c, err := newBatchConn(conn)
+	if err != nil {
+		b.Fatal(err)
+	}
+	payload := make([]byte, 64)
+	requests := make([]message, window)
+	responses := make([]message, window)
+	for i := range requests {
+		requests[i] = message{Buffer: payload, Addr: addr.(*net.UDPAddr)}
+		responses[i] = message{Buffer: make([]byte, DefaultMaxPacketSize)}
+	}
+	var lost int
+	b.SetBytes(int64(len(payload)))
+	b.ResetTimer()
+	for sent := 0; sent < b.N; sent += window {
+		n := window
+		if b.N-sent < n {
+			n = b.N - sent
+		}
+		for written := 0; written < n; {
+			w, err := c.WriteBatch(requests[written:n])
+			if err != nil {
+				b.Fatal(err)
+			}
+			written += w
+		}
+		if err := conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond)); err != nil {
+			b.Fatal(err)
+		}
+		for received := 0; received < n; {
+			r, err := c.ReadBatch(responses[:n-received])
+			if err != nil {
+				lost += n - received
+				break
+			}
+			received += r
+		}
+	}
+	b.StopTimer()
+	b.ReportMetric(float64(lost)/float64(b.N), "loss/op")
+}
+
+func BenchmarkSingleLoop(b *testing.B) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer conn.Close()
+	go serveSingleLoop(conn, echo)
+	runLoad(b, conn.LocalAddr())
+}
+
+func BenchmarkBatched(b *testing.B) {
+	server, addr := startServer(b, 1, echo)
+	defer server.Close()
+	runLoad(b, addr)
+	stats := server.Stats()
+	if stats.Reads > 0 {
+		b.ReportMetric(float64(stats.Received)/float64(stats.Reads), "packets/read")
+	}
+}
+
+func BenchmarkBatchedReusePort(b *testing.B) {
+	server, addr := startServer(b, 4, echo)
+	defer server.Close()
+	runLoad(b, addr)
+}
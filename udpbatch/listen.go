@@ -0,0 +1,47 @@
+package udpbatch
+
+import (
+	"context"
+	"net"
+	"strconv"
+)
+
+// SO_REUSEPORTを設定した同じアドレスのソケットをn個作る
+// Linuxではカーネルが送信元のアドレスとポートのハッシュでデータグラムをソケットに振り分けるので、同じ送信元からのデータグラムの順序は保たれる
+// networkが"udp"の場合は、addressのホストがIPv6のアドレスでなければ"udp4"として扱う
+// (デュアルスタックのソケットではsendmmsgでIPv4の宛先に送れないため)
+func Listen(network, address string, n int) ([]net.PacketConn, error) {
+	if network == "udp" {
+		network = "udp4"
+		if host, _, err := net.SplitHostPort(address); err == nil {
+			if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+				network = "udp6"
+			}
+		}
+	}
+	if n > 1 && !reusePortSupported {
+		return nil, errReusePortUnsupported
+	}
+	lc := net.ListenConfig{Control: control}
+	var conns []net.PacketConn
+	for i := 0; i < n; i++ {
+		conn, err := lc.ListenPacket(context.Background(), network, address)
+		if err != nil {
+			for _, c := range conns {
+				_ = c.Close()
+			}
+			return nil, err
+		}
+		if i == 0 {
+			// ポート番号に0を指定した場合は、2つ目以降も1つ目と同じポートにする
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				_ = conn.Close()
+				return nil, err
+			}
+			address = net.JoinHostPort(host, strconv.Itoa(conn.LocalAddr().(*net.UDPAddr).Port))
+		}
+		conns = append(conns, conn)
+	}
+	return conns, nil
+}
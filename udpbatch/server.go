@@ -0,0 +1,299 @@
+// udpbatchパッケージは、テレメトリの受信のように大量の小さなデータグラムを扱うための高スループットなUDPサーバー
+// udp.goのサーバーは1つのゴルーチンで1500バイトのバッファに1つずつ読み込むが、ここでは次のことを行う
+//   - Linuxではrecvmmsg/sendmmsgで1回のシステムコールで複数のデータグラムをまとめて読み書きする
+//   - SO_REUSEPORTで同じポートに複数のソケットを作り、カーネルに送信元ごとに振り分けてもらってCPUコアに分散する
+//   - 読み込み用のバッファをsync.Poolで使い回し、データグラムごとのメモリ確保を避ける
+//   - SO_RXQ_OVFLで、受信バッファがあふれてカーネルが捨てたデータグラムの数を報告する
+package udpbatch
+
+import (
+	"errors"
+	"net"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// 受信したデータグラムを処理して、応答を返す
+// 応答が不要ならnilを返す。packetは呼び出しから戻ると再利用されるので、保持する場合はコピーする
+type Handler func(packet []byte, addr net.Addr) []byte
+
+const (
+	DefaultBatchSize     = 64
+	DefaultMaxPacketSize = 1500
+)
+
+var ErrServerClosed = errors.New("udpbatch: server closed")
+
+// 1つのデータグラム
+// 読み込みではBufferとOOBの容量いっぱいまで読み込み、長さを読み込んだ分に合わせる
+type message struct {
+	Buffer []byte
+	OOB    []byte
+	Addr   *net.UDPAddr
+}
+
+// Linuxではrecvmmsg/sendmmsgで、それ以外のOSでは1つずつ読み書きする
+// (golang.org/x/net/ipv4のReadBatch/WriteBatchは内部で使い回すヘッダーに前回の制御メッセージが残ることがあり、
+// SO_RXQ_OVFLの制御メッセージを受け取ったあとのsendmmsgがEINVALになるので使っていない)
+type batchConn interface {
+	ReadBatch(ms []message) (int, error)
+	WriteBatch(ms []message) (int, error)
+}
+
+type Server struct {
+	Handler Handler
+	// SO_REUSEPORTで作るソケットの数。0の場合はruntime.NumCPU()(SO_REUSEPORTが使えないOSでは1)
+	Sockets int
+	// ハンドラーを呼び出すゴルーチンの数。0の場合はruntime.NumCPU()
+	Workers int
+	// 1回のシステムコールで読み書きするデータグラムの最大数。0の場合はDefaultBatchSize
+	BatchSize int
+	// 0の場合はDefaultMaxPacketSize。これより大きいデータグラムは切り詰められる
+	MaxPacketSize int
+
+	mu      sync.Mutex
+	conns   []net.PacketConn
+	closed  bool
+	pool    sync.Pool
+	batches chan *batch
+	wg      sync.WaitGroup
+
+	received uint64
+	sent     uint64
+	reads    uint64
+	// ソケットごとの、カーネルが捨てたデータグラムの累計(SO_RXQ_OVFL)
+	drops []uint64
+}
+
+// サーバーの統計
+type Stats struct {
+	Received uint64
+	Sent     uint64
+	// 受信のシステムコールの回数。Received/Readsが平均のバッチサイズになる
+	Reads uint64
+	// 受信バッファがあふれてカーネルが捨てたデータグラムの数(Linuxのみ)
+	Dropped uint64
+}
+
+// 1回のReadBatchで読み込むデータグラムと、その応答
+type batch struct {
+	conn     batchConn
+	socket   int
+	messages []message
+	n        int
+	replies  []message
+}
+
+func (s *Server) sockets() int {
+	if s.Sockets > 0 {
+		return s.Sockets
+	}
+	if !reusePortSupported {
+		return 1
+	}
+	return runtime.NumCPU()
+}
+
+func (s *Server) workers() int {
+	if s.Workers > 0 {
+		return s.Workers
+	}
+	return runtime.NumCPU()
+}
+
+func (s *Server) batchSize() int {
+	if s.BatchSize > 0 {
+		return s.BatchSize
+	}
+	return DefaultBatchSize
+}
+
+func (s *Server) maxPacketSize() int {
+	if s.MaxPacketSize > 0 {
+		return s.MaxPacketSize
+	}
+	return DefaultMaxPacketSize
+}
+
+// バッファはバッチごとまとめて確保し、処理が終わるとプールに戻す
+func (s *Server) newBatch() *batch {
+	size := s.batchSize()
+	b := &batch{messages: make([]message, size), replies: make([]message, 0, size)}
+	for i := range b.messages {
+		b.messages[i].Buffer = make([]byte, s.maxPacketSize())
+		b.messages[i].OOB = make([]byte, oobSize)
+	}
+	return b
+}
+
+// network("udp", "udp4", "udp6")のaddressで待ち受けて、Close()されるまで処理を続ける
+// Close()されるとErrServerClosedを返す
+func (s *Server) ListenAndServe(network, address string) error {
+	conns, err := Listen(network, address, s.sockets())
+	if err != nil {
+		return err
+	}
+	return s.Serve(conns)
+}
+
+// Listen()で作ったソケットで処理を続ける
+func (s *Server) Serve(conns []net.PacketConn) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		for _, conn := range conns {
+			_ = conn.Close()
+		}
+		return ErrServerClosed
+	}
+	s.conns = conns
+	s.drops = make([]uint64, len(conns))
+	s.pool.New = func() interface{} { return s.newBatch() }
+	s.batches = make(chan *batch, s.workers())
+	s.mu.Unlock()
+
+	var workers sync.WaitGroup
+	for i := 0; i < s.workers(); i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for b := range s.batches {
+				s.handle(b)
+			}
+		}()
+	}
+	// 最初に失敗したソケットのエラーを覚えてから他のソケットを閉じるので、
+	// 閉じられたことによる他のソケットのエラーで上書きされない
+	var (
+		once     sync.Once
+		firstErr error
+	)
+	for i, conn := range conns {
+		s.wg.Add(1)
+		go func(i int, conn net.PacketConn) {
+			defer s.wg.Done()
+			err := s.read(i, conn)
+			once.Do(func() { firstErr = err })
+			_ = s.closeConns()
+		}(i, conn)
+	}
+	s.wg.Wait()
+	close(s.batches)
+	workers.Wait()
+
+	s.mu.Lock()
+	closed := s.closed
+	s.mu.Unlock()
+	if closed {
+		return ErrServerClosed
+	}
+	// いずれかのソケットでエラーが起きた場合は、他のソケットも閉じて最初のエラーを返す
+	return firstErr
+}
+
+func (s *Server) read(socket int, conn net.PacketConn) error {
+	udpConn, ok := conn.(*net.UDPConn)
+	if !ok {
+		return errors.New("udpbatch: not a UDP socket")
+	}
+	c, err := newBatchConn(udpConn)
+	if err != nil {
+		return err
+	}
+	for {
+		b := s.pool.Get().(*batch)
+		b.conn, b.socket = c, socket
+		n, err := c.ReadBatch(b.messages)
+		if err != nil {
+			s.pool.Put(b)
+			return err
+		}
+		atomic.AddUint64(&s.reads, 1)
+		atomic.AddUint64(&s.received, uint64(n))
+		b.n = n
+		// 最後のデータグラムのカウンタが最新の累計
+		if dropped, ok := parseDropCounter(b.messages[n-1].OOB); ok {
+			atomic.StoreUint64(&s.drops[socket], uint64(dropped))
+		}
+		s.batches <- b
+	}
+}
+
+func (s *Server) handle(b *batch) {
+	defer func() {
+		// 応答を保持し続けないように消してからプールに返す
+		// 読み込み用のバッファの長さは次のReadBatchで容量いっぱいに戻る
+		for i := range b.replies {
+			b.replies[i] = message{}
+		}
+		b.replies = b.replies[:0]
+		s.pool.Put(b)
+	}()
+	for _, m := range b.messages[:b.n] {
+		if s.Handler == nil {
+			continue
+		}
+		reply := s.Handler(m.Buffer, m.Addr)
+		if reply != nil {
+			b.replies = append(b.replies, message{Buffer: reply, Addr: m.Addr})
+		}
+	}
+	// sendmmsgは全部を送り切らずに戻ることがあるので、残りを送り直す
+	for replies := b.replies; len(replies) > 0; {
+		n, err := b.conn.WriteBatch(replies)
+		if err != nil {
+			return
+		}
+		atomic.AddUint64(&s.sent, uint64(n))
+		replies = replies[n:]
+	}
+}
+
+func (s *Server) Stats() Stats {
+	stats := Stats{
+		Received: atomic.LoadUint64(&s.received),
+		Sent:     atomic.LoadUint64(&s.sent),
+		Reads:    atomic.LoadUint64(&s.reads),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.drops {
+		stats.Dropped += atomic.LoadUint64(&s.drops[i])
+	}
+	return stats
+}
+
+// 待ち受けているアドレス。Serve()の前はnil
+func (s *Server) Addr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.conns) == 0 {
+		return nil
+	}
+	return s.conns[0].LocalAddr()
+}
+
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.mu.Unlock()
+	return s.closeConns()
+}
+
+// 1つのソケットの読み込みが失敗したら、他のソケットの読み込みも止める
+func (s *Server) closeConns() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var err error
+	for _, conn := range s.conns {
+		if closeErr := conn.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
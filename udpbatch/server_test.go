@@ -0,0 +1,161 @@
+package udpbatch
+
+import (
+	"bytes"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func startServer(t testing.TB, sockets int, handler Handler) (*Server, net.Addr) {
+	t.Helper()
+	conns, err := Listen("udp", "127.0.0.1:0", sockets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &Server{Handler: handler, Workers: 2}
+	go func() {
+		_ = server.Serve(conns)
+	}()
+	return server, conns[0].LocalAddr()
+}
+
+func echo(packet []byte, addr net.Addr) []byte {
+	reply := make([]byte, len(packet))
+	copy(reply, packet)
+	return reply
+}
+
+func TestServer(t *testing.T) {
+	server, addr := startServer(t, 4, echo)
+	defer server.Close()
+
+	// 送信元のポートが違う複数のクライアントからのデータグラムが、どのソケットに振り分けられても応答が返る
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			conn, err := net.Dial("udp", addr.String())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer conn.Close()
+			buffer := make([]byte, DefaultMaxPacketSize)
+			for j := 0; j < 10; j++ {
+				message := []byte{byte(i), byte(j)}
+				if _, err := conn.Write(message); err != nil {
+					t.Error(err)
+					return
+				}
+				if err := conn.SetReadDeadline(time.Now().Add(2 * time.Second)); err != nil {
+					t.Error(err)
+					return
+				}
+				length, err := conn.Read(buffer)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if !bytes.Equal(buffer[:length], message) {
+					t.Errorf("got %v, want %v", buffer[:length], message)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	stats := server.Stats()
+	if stats.Received != 80 || stats.Sent != 80 || stats.Reads == 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestServerClose(t *testing.T) {
+	conns, err := Listen("udp4", "127.0.0.1:0", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &Server{Handler: echo}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Serve(conns)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if err := server.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-errs:
+		if err != ErrServerClosed {
+			t.Errorf("got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Serve did not return")
+	}
+}
+
+// net.UDPConnではないソケット
+type wrappedConn struct {
+	net.PacketConn
+}
+
+// 1つのソケットが失敗したら、他のソケットを閉じたことによるエラーではなく、そのエラーを返す
+func TestServeFirstError(t *testing.T) {
+	conns, err := Listen("udp", "127.0.0.1:0", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &Server{Handler: echo, Workers: 2}
+	err = server.Serve([]net.PacketConn{conns[0], wrappedConn{other}})
+	if err == nil || err.Error() != "udpbatch: not a UDP socket" {
+		t.Fatalf("Serve() = %v", err)
+	}
+}
+
+// 応答を返さずに受信だけするサーバーに、受信バッファがあふれるまで送る
+// SO_RXQ_OVFLが使える環境では、カーネルが捨てた数がStats().Droppedに出る
+func TestDropCounter(t *testing.T) {
+	if !reusePortSupported {
+		t.Skip("SO_RXQ_OVFL is not supported")
+	}
+	block := make(chan struct{})
+	var once sync.Once
+	server, addr := startServer(t, 1, func(packet []byte, addr net.Addr) []byte {
+		// ハンドラーを止めておくと、ワーカーと読み込みのチャネルが詰まって受信バッファがあふれる
+		<-block
+		return nil
+	})
+	defer server.Close()
+	defer once.Do(func() { close(block) })
+
+	conn, err := net.Dial("udp", addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	payload := make([]byte, 1000)
+	for i := 0; i < 10000; i++ {
+		if _, err := conn.Write(payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	once.Do(func() { close(block) })
+	// ドロップ数はその後に受信したデータグラムの制御メッセージで届く
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := conn.Write(payload); err != nil {
+			t.Fatal(err)
+		}
+		if server.Stats().Dropped > 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("no drops reported: %+v", server.Stats())
+}
@@ -0,0 +1,43 @@
+package udpbatch
+
+import (
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const reusePortSupported = true
+
+var errReusePortUnsupported error
+
+// SO_RXQ_OVFLの制御メッセージ(uint32)が入る大きさ
+var oobSize = unix.CmsgSpace(4)
+
+// SO_REUSEPORTで同じポートを複数のソケットで共有し、SO_RXQ_OVFLで受信時にドロップ数を制御メッセージで受け取る
+func control(network, address string, c syscall.RawConn) error {
+	var err error
+	if controlErr := c.Control(func(fd uintptr) {
+		if err = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1); err != nil {
+			return
+		}
+		err = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_RXQ_OVFL, 1)
+	}); controlErr != nil {
+		return controlErr
+	}
+	return err
+}
+
+// 制御メッセージから、ソケットの作成以降に受信バッファがあふれて捨てられたデータグラムの累計を取り出す
+func parseDropCounter(oob []byte) (uint32, bool) {
+	messages, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return 0, false
+	}
+	for _, message := range messages {
+		if message.Header.Level == unix.SOL_SOCKET && message.Header.Type == unix.SO_RXQ_OVFL && len(message.Data) >= 4 {
+			return *(*uint32)(unsafe.Pointer(&message.Data[0])), true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,24 @@
+//go:build !linux
+// +build !linux
+
+package udpbatch
+
+import (
+	"errors"
+	"syscall"
+)
+
+// SO_REUSEPORTの振り分けの挙動はOSによって違う(BSD系では最後にbindしたソケットにしか届かない)ので、Linux以外では1つのソケットだけを使う
+const reusePortSupported = false
+
+var errReusePortUnsupported = errors.New("udpbatch: multiple sockets are supported only on Linux")
+
+const oobSize = 0
+
+func control(network, address string, c syscall.RawConn) error {
+	return nil
+}
+
+func parseDropCounter(oob []byte) (uint32, bool) {
+	return 0, false
+}
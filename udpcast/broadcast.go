@@ -0,0 +1,147 @@
+package udpcast
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+)
+
+// ブロードキャストの送受信の設定
+// マルチキャストと違ってグループへの参加は不要で、同じサブネットの全てのホストに届く
+// IPv6にはブロードキャストが無いので、IPv4だけに対応する
+type BroadcastConfig struct {
+	Port int
+	// 送信先を計算するインターフェースの名前。空の場合はブロードキャストに対応した全てのインターフェース
+	Interface string
+	// trueならサブネットごとのアドレスではなく、リミテッドブロードキャスト(255.255.255.255)に送る
+	// ルーターを越えないのは同じだが、どのインターフェースから送られるかはOSのルーティングで決まる
+	Limited bool
+	// 空でなければ、インターフェースから計算する代わりにこれらのアドレスに送る
+	Addrs []net.IP
+}
+
+// ブロードキャストで送信するソケット
+type BroadcastConn struct {
+	*net.UDPConn
+	addrs []*net.UDPAddr
+}
+
+// サブネット指向ブロードキャストアドレス(ホスト部のビットを全て1にしたもの、192.168.1.0/24なら192.168.1.255)
+func directedBroadcast(ipNet *net.IPNet) net.IP {
+	ip := ipNet.IP.To4()
+	if ip == nil || len(ipNet.Mask) != net.IPv4len {
+		return nil
+	}
+	broadcast := make(net.IP, net.IPv4len)
+	for i := range ip {
+		broadcast[i] = ip[i] | ^ipNet.Mask[i]
+	}
+	return broadcast
+}
+
+// インターフェースに設定されたIPv4のアドレスから、サブネット指向ブロードキャストアドレスを求める
+// nameが空の場合は、起動していてブロードキャストに対応した全てのインターフェースを対象にする
+func BroadcastAddrs(name string) ([]net.IP, error) {
+	var interfaces []net.Interface
+	if name != "" {
+		iface, err := net.InterfaceByName(name)
+		if err != nil {
+			return nil, err
+		}
+		interfaces = append(interfaces, *iface)
+	} else {
+		var err error
+		if interfaces, err = net.Interfaces(); err != nil {
+			return nil, err
+		}
+	}
+	var broadcasts []net.IP
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagBroadcast == 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			// /31と/32にはブロードキャストアドレスが無い
+			if ones, bits := ipNet.Mask.Size(); bits != 32 || ones >= 31 {
+				continue
+			}
+			if broadcast := directedBroadcast(ipNet); broadcast != nil {
+				broadcasts = append(broadcasts, broadcast)
+			}
+		}
+	}
+	return broadcasts, nil
+}
+
+// ブロードキャストで送信するソケットを作る
+func DialBroadcast(config BroadcastConfig) (*BroadcastConn, error) {
+	ips := config.Addrs
+	if len(ips) == 0 {
+		if config.Limited {
+			ips = []net.IP{net.IPv4bcast}
+		} else {
+			var err error
+			if ips, err = BroadcastAddrs(config.Interface); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(ips) == 0 {
+		return nil, errors.New("udpcast: no broadcast address")
+	}
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return nil, err
+	}
+	// ブロードキャストアドレスに送信するにはSO_BROADCASTが必要
+	// (GoのUDPソケットは最初から設定しているが、他の言語から移植するときのために明示しておく)
+	raw, err := conn.SyscallConn()
+	if err == nil {
+		err = setBroadcast(raw)
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	c := &BroadcastConn{UDPConn: conn}
+	for _, ip := range ips {
+		c.addrs = append(c.addrs, &net.UDPAddr{IP: ip, Port: config.Port})
+	}
+	return c, nil
+}
+
+// 送信先のアドレス
+func (c *BroadcastConn) Addrs() []*net.UDPAddr {
+	return c.addrs
+}
+
+// 全ての送信先に送信する
+func (c *BroadcastConn) Send(b []byte) error {
+	for _, addr := range c.addrs {
+		if _, err := c.WriteToUDP(b, addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ブロードキャストを受信するソケットを作る
+// ブロードキャストは宛先のアドレスが自分のアドレスではないので、特定のアドレスではなく全てのアドレス(0.0.0.0)で待ち受ける
+// 同じホストで複数の受信側が動けるようにSO_REUSEADDRとSO_REUSEPORTを設定する
+func ListenBroadcast(config BroadcastConfig) (*net.UDPConn, error) {
+	lc := net.ListenConfig{Control: reusePort}
+	conn, err := lc.ListenPacket(context.Background(), "udp4", net.JoinHostPort("0.0.0.0", strconv.Itoa(config.Port)))
+	if err != nil {
+		return nil, err
+	}
+	return conn.(*net.UDPConn), nil
+}
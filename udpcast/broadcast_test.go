@@ -0,0 +1,64 @@
+package udpcast
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestDirectedBroadcast(t *testing.T) {
+	tests := []struct {
+		cidr string
+		want string
+	}{
+		{"192.168.1.10/24", "192.168.1.255"},
+		{"10.1.2.3/8", "10.255.255.255"},
+		{"172.16.5.4/20", "172.16.15.255"},
+	}
+	for _, test := range tests {
+		ip, ipNet, err := net.ParseCIDR(test.cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ipNet.IP = ip
+		if got := directedBroadcast(ipNet); got.String() != test.want {
+			t.Errorf("%s: got %v, want %s", test.cidr, got, test.want)
+		}
+	}
+}
+
+// Linuxのループバックには127.255.255.255へのブロードキャストの経路があるので、それを使って送受信を試す
+func TestBroadcastTicks(t *testing.T) {
+	config := BroadcastConfig{Port: 19995, Addrs: []net.IP{net.IPv4(127, 255, 255, 255)}}
+	listener, err := ListenBroadcast(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	sender, err := DialBroadcast(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sender.Close()
+
+	message := TickMessage{Session: 1, Sequence: 7, Wall: time.Now()}
+	b, err := message.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sender.Send(b); err != nil {
+		t.Skipf("broadcast is not available: %v", err)
+	}
+	if err := listener.SetReadDeadline(time.Now().Add(2 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	// マルチキャストと同じtickメッセージなので、同じReadTicksで受け取れる
+	var received Tick
+	_ = ReadTicks(listener, func(tick Tick) {
+		received = tick
+		_ = listener.SetReadDeadline(time.Now())
+	})
+	if received.Session != 1 || received.Sequence != 7 {
+		t.Errorf("got %+v", received)
+	}
+}
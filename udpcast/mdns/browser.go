@@ -0,0 +1,393 @@
+package mdns
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"system-programming/udpcast"
+)
+
+type EventType int
+
+const (
+	Added EventType = iota
+	Updated
+	Removed
+)
+
+func (t EventType) String() string {
+	switch t {
+	case Added:
+		return "added"
+	case Updated:
+		return "updated"
+	case Removed:
+		return "removed"
+	}
+	return "unknown"
+}
+
+// 発見したサービスのインスタンス
+type Entry struct {
+	Instance string
+	Service  string
+	Domain   string
+	Host     string
+	Port     uint16
+	IPs      []net.IP
+	Text     []string
+	// PTRレコードのTTLが切れる時刻。それまでに更新されなければRemovedになる
+	Expires time.Time
+}
+
+func (e Entry) InstanceName() string {
+	return e.Instance + "." + e.Service + "." + e.Domain
+}
+
+type Event struct {
+	Type  EventType
+	Entry Entry
+}
+
+// 1つのインスタンスについて受信したレコード
+// PTR、SRV、TXT、アドレスは別々のパケットで届くことがあるので、揃ったところでAddedを通知する
+type instance struct {
+	// 受信したままの大文字と小文字を保ったインスタンスの名前
+	name       string
+	ptrExpires time.Time
+	ptrTTL     time.Duration
+	refreshed  bool
+	host       string
+	port       uint16
+	hasSRV     bool
+	text       []string
+	reported   *Entry
+}
+
+// ネットワーク上のサービスを探して、出現と期限切れを追跡するもの
+type Browser struct {
+	conn        *udpcast.GroupConn
+	serviceName string
+	service     string
+	domain      string
+	mu          sync.Mutex
+	instances   map[string]*instance
+	// ホスト名(小文字)ごとのアドレス
+	hosts map[string]map[string]address
+}
+
+type address struct {
+	received time.Time
+	expires  time.Time
+}
+
+// service("_http._tcp"など)のインスタンスを探すBrowserを作る
+// domainが空の場合は"local."
+func NewBrowser(config udpcast.GroupConfig, service, domain string) (*Browser, error) {
+	s := Service{Service: service, Domain: domain}
+	conn, err := udpcast.ListenGroup(config)
+	if err != nil {
+		return nil, err
+	}
+	return &Browser{
+		conn:        conn,
+		serviceName: s.ServiceName(),
+		service:     strings.TrimSuffix(absolute(service), "."),
+		domain:      s.domain(),
+		instances:   make(map[string]*instance),
+		hosts:       make(map[string]map[string]address),
+	}, nil
+}
+
+// 問い合わせを送りながら応答を待ち、インスタンスの追加、変更、削除をhandlerに通知する
+// 問い合わせの間隔はRFC 6762 5.2節に従って1秒から倍々に延ばし、最大で1時間にする
+// ctxがキャンセルされるとnilを返す
+func (b *Browser) Browse(ctx context.Context, handler func(Event)) error {
+	packets := make(chan []byte)
+	errs := make(chan error, 1)
+	done := make(chan struct{})
+	readerDone := make(chan struct{})
+	go func() {
+		defer close(readerDone)
+		buffer := make([]byte, maxMessageSize)
+		for {
+			length, _, err := b.conn.ReadFrom(buffer)
+			if err != nil {
+				errs <- err
+				return
+			}
+			packet := make([]byte, length)
+			copy(packet, buffer[:length])
+			select {
+			case packets <- packet:
+			case <-done:
+				return
+			}
+		}
+	}()
+	defer func() {
+		close(done)
+		// 読み込み中のゴルーチンを止め、次のBrowse()で読めるように期限を戻す
+		_ = b.conn.SetReadDeadline(time.Now())
+		<-readerDone
+		_ = b.conn.SetReadDeadline(time.Time{})
+	}()
+
+	interval := time.Second
+	query := time.NewTimer(0)
+	defer query.Stop()
+	expire := time.NewTicker(time.Second)
+	defer expire.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-errs:
+			return err
+		case <-query.C:
+			if err := b.query(); err != nil {
+				return err
+			}
+			query.Reset(interval)
+			if interval *= 2; interval > time.Hour {
+				interval = time.Hour
+			}
+		case packet := <-packets:
+			var message dnsmessage.Message
+			if err := message.Unpack(packet); err != nil || !message.Response {
+				continue
+			}
+			for _, event := range b.update(&message, time.Now()) {
+				handler(event)
+			}
+		case now := <-expire.C:
+			events, refresh := b.expire(now)
+			for _, event := range events {
+				handler(event)
+			}
+			if refresh {
+				if err := b.query(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// サービスのPTRレコードを問い合わせる
+// すでに知っているインスタンスは回答欄に入れて、Responderが同じ応答を繰り返さないようにする
+func (b *Browser) query() error {
+	message := dnsmessage.Message{
+		Questions: []dnsmessage.Question{{
+			Name:  dnsmessage.MustNewName(b.serviceName),
+			Type:  dnsmessage.TypePTR,
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+	now := time.Now()
+	b.mu.Lock()
+	for name, i := range b.instances {
+		if remaining := i.ptrExpires.Sub(now); remaining > 0 {
+			message.Answers = append(message.Answers, dnsmessage.Resource{
+				Header: dnsmessage.ResourceHeader{
+					Name:  dnsmessage.MustNewName(b.serviceName),
+					Class: dnsmessage.ClassINET,
+					TTL:   uint32(remaining / time.Second),
+				},
+				Body: &dnsmessage.PTRResource{PTR: dnsmessage.MustNewName(name)},
+			})
+		}
+	}
+	b.mu.Unlock()
+	packet, err := message.Pack()
+	if err != nil {
+		return err
+	}
+	return b.conn.Send(packet)
+}
+
+func (b *Browser) lookup(name string) *instance {
+	key := strings.ToLower(name)
+	i, ok := b.instances[key]
+	if !ok {
+		i = &instance{name: name}
+		b.instances[key] = i
+	}
+	return i
+}
+
+func (b *Browser) isInstance(name dnsmessage.Name) bool {
+	s := strings.ToLower(name.String())
+	return strings.HasSuffix(s, "."+strings.ToLower(b.serviceName))
+}
+
+// 受信した応答のレコードを反映して、変化のあったインスタンスのイベントを返す
+func (b *Browser) update(message *dnsmessage.Message, now time.Time) []Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var resources []dnsmessage.Resource
+	resources = append(resources, message.Answers...)
+	resources = append(resources, message.Additionals...)
+	for _, resource := range resources {
+		ttl := time.Duration(resource.Header.TTL) * time.Second
+		switch body := resource.Body.(type) {
+		case *dnsmessage.PTRResource:
+			if !sameName(resource.Header.Name, b.serviceName) || !b.isInstance(body.PTR) {
+				continue
+			}
+			i := b.lookup(body.PTR.String())
+			// TTLが0のレコードはgoodbyeなので、次のexpireで削除される
+			i.ptrExpires = now.Add(ttl)
+			i.ptrTTL = ttl
+			i.refreshed = false
+		case *dnsmessage.SRVResource:
+			if !b.isInstance(resource.Header.Name) {
+				continue
+			}
+			i := b.lookup(resource.Header.Name.String())
+			i.host, i.port, i.hasSRV = body.Target.String(), body.Port, true
+		case *dnsmessage.TXTResource:
+			if !b.isInstance(resource.Header.Name) {
+				continue
+			}
+			b.lookup(resource.Header.Name.String()).text = body.TXT
+		case *dnsmessage.AResource:
+			b.addAddress(resource.Header, net.IP(body.A[:]), now, now.Add(ttl))
+		case *dnsmessage.AAAAResource:
+			b.addAddress(resource.Header, net.IP(body.AAAA[:]), now, now.Add(ttl))
+		}
+	}
+	return b.changes(now)
+}
+
+func (b *Browser) addAddress(header dnsmessage.ResourceHeader, ip net.IP, now, expires time.Time) {
+	host := strings.ToLower(header.Name.String())
+	addrs, ok := b.hosts[host]
+	if !ok {
+		addrs = make(map[string]address)
+		b.hosts[host] = addrs
+	}
+	// cache-flushが立っていれば、そのホストについて以前のパケットで受け取ったアドレスは古いものとして捨てる
+	// (RFC 6762 10.2節では1秒の猶予を置くが、ここではすぐに捨てる)
+	if header.Class&classCacheFlush != 0 {
+		for ip, addr := range addrs {
+			if addr.received.Before(now) {
+				delete(addrs, ip)
+			}
+		}
+	}
+	addrs[ip.String()] = address{received: now, expires: expires}
+}
+
+func (b *Browser) entry(i *instance, now time.Time) *Entry {
+	if !i.hasSRV || !i.ptrExpires.After(now) {
+		return nil
+	}
+	e := &Entry{
+		Instance: i.name[:len(i.name)-len(b.serviceName)-1],
+		Service:  b.service,
+		Domain:   b.domain,
+		Host:     i.host,
+		Port:     i.port,
+		Text:     i.text,
+		Expires:  i.ptrExpires,
+	}
+	var ips []string
+	for ip, addr := range b.hosts[strings.ToLower(i.host)] {
+		if addr.expires.After(now) {
+			ips = append(ips, ip)
+		}
+	}
+	sort.Strings(ips)
+	for _, ip := range ips {
+		e.IPs = append(e.IPs, net.ParseIP(ip))
+	}
+	return e
+}
+
+// 前回の通知から変化したインスタンスのイベント
+func (b *Browser) changes(now time.Time) []Event {
+	var events []Event
+	names := make([]string, 0, len(b.instances))
+	for name := range b.instances {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		i := b.instances[name]
+		current := b.entry(i, now)
+		switch {
+		case current != nil && i.reported == nil:
+			events = append(events, Event{Type: Added, Entry: *current})
+		case current != nil && !sameEntry(current, i.reported):
+			events = append(events, Event{Type: Updated, Entry: *current})
+		case current == nil && i.reported != nil:
+			events = append(events, Event{Type: Removed, Entry: *i.reported})
+		}
+		i.reported = current
+		if current == nil && !i.ptrExpires.After(now) {
+			delete(b.instances, name)
+		}
+	}
+	return events
+}
+
+// 期限の延長だけでは通知しない
+func sameEntry(a, b *Entry) bool {
+	x, y := *a, *b
+	x.Expires, y.Expires = time.Time{}, time.Time{}
+	return reflect.DeepEqual(x, y)
+}
+
+// 期限切れのインスタンスを削除し、TTLの80%を過ぎたものがあれば再問い合わせが必要かを返す(RFC 6762 5.2節)
+func (b *Browser) expire(now time.Time) ([]Event, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	refresh := false
+	for _, i := range b.instances {
+		if i.ptrTTL > 0 && !i.refreshed && now.After(i.ptrExpires.Add(-i.ptrTTL/5)) {
+			i.refreshed = true
+			refresh = true
+		}
+	}
+	for host, addrs := range b.hosts {
+		for ip, addr := range addrs {
+			if !addr.expires.After(now) {
+				delete(addrs, ip)
+			}
+		}
+		if len(addrs) == 0 {
+			delete(b.hosts, host)
+		}
+	}
+	return b.changes(now), refresh
+}
+
+// 現在発見されているインスタンスの一覧
+func (b *Browser) Entries() []Entry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var entries []Entry
+	names := make([]string, 0, len(b.instances))
+	for name := range b.instances {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if reported := b.instances[name].reported; reported != nil {
+			entries = append(entries, *reported)
+		}
+	}
+	return entries
+}
+
+func (b *Browser) Close() error {
+	return b.conn.Close()
+}
@@ -0,0 +1,206 @@
+// mdnsパッケージはudpcastパッケージのマルチキャストの上で、マルチキャストDNS(RFC 6762)とDNSベースのサービスディスカバリ(RFC 6763)を実装したもの
+// Responderが名前付きのサービス(ホスト名、ポート、TXTレコード)を告知して問い合わせに応答し、Browserがサービスを一覧して出現と期限切れを追跡する
+// 224.0.0.251:5353でmDNSのワイヤーフォーマットを使うので、macOSのBonjourやLinuxのAvahiとも相互に発見できる
+package mdns
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"system-programming/udpcast"
+)
+
+const (
+	Port = 5353
+	// ホスト名(A, AAAA)以外のレコードのTTLはRFC 6762では75分が推奨されているが、ここでは停止したサービスに早く気づけるように短くしている
+	DefaultTTL = 120 * time.Second
+	// 全てのサービスの種類を列挙するための名前(RFC 6763 9章)
+	ServicesName = "_services._dns-sd._udp.local."
+
+	// mDNSではクラスの最上位ビットを別の意味で使う
+	// 質問ではユニキャストでの応答を求めること(QU)、応答では古いキャッシュを捨てること(cache-flush)を表す
+	classUnicastResponse = 1 << 15
+	classCacheFlush      = 1 << 15
+	// mDNSのメッセージはジャンボフレームを考慮して最大9000バイト(RFC 6762 17章)
+	maxMessageSize = 9000
+)
+
+var (
+	IPv4Group = net.IPv4(224, 0, 0, 251)
+	IPv6Group = net.ParseIP("ff02::fb")
+)
+
+// mDNSの標準の設定
+// TTLはRFC 6762の11章に合わせて255にし、同じホストのResponderとBrowserが通信できるようにループバックも有効にする
+// テストなどで既存のmDNSのデーモンとぶつけたくなければPortを変える
+func DefaultConfig() udpcast.GroupConfig {
+	return udpcast.GroupConfig{
+		Groups:   []net.IP{IPv4Group},
+		Port:     Port,
+		TTL:      255,
+		Loopback: true,
+	}
+}
+
+// 告知するサービス
+// 例えば"My Printer._ipp._tcp.local."というインスタンスは、Instance: "My Printer", Service: "_ipp._tcp"になる
+type Service struct {
+	// インスタンス名。空白や日本語も使えるが、DNSのラベルの区切りになる"."は使えない
+	Instance string
+	// "_http._tcp"のような、サービスの種類とトランスポート
+	Service string
+	// 空の場合は"local."
+	Domain string
+	// サービスを提供するホスト名。空の場合は"<os.Hostname()>.local."
+	Host string
+	Port uint16
+	// ホスト名に対応するアドレス。空の場合はループバック以外のインターフェースのアドレスを使う
+	IPs []net.IP
+	// "key=value"の形式の属性
+	Text []string
+	// 0の場合はDefaultTTL
+	TTL time.Duration
+}
+
+func (s *Service) domain() string {
+	if s.Domain == "" {
+		return "local."
+	}
+	return absolute(s.Domain)
+}
+
+// "_http._tcp.local."のような、ブラウズに使う名前
+func (s *Service) ServiceName() string {
+	return absolute(s.Service) + s.domain()
+}
+
+// "My Printer._ipp._tcp.local."のような、インスタンスを指す名前
+func (s *Service) InstanceName() string {
+	return s.Instance + "." + s.ServiceName()
+}
+
+// Registerの前に空のフィールドを埋めて、名前として使えるかを確かめる
+func (s *Service) normalize() error {
+	if s.Instance == "" || s.Service == "" {
+		return errors.New("mdns: instance and service names are required")
+	}
+	if strings.Contains(s.Instance, ".") {
+		return fmt.Errorf("mdns: instance name %q must not contain dots", s.Instance)
+	}
+	if s.Host == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return err
+		}
+		s.Host = strings.SplitN(hostname, ".", 2)[0] + "." + s.domain()
+	}
+	s.Host = absolute(s.Host)
+	if len(s.IPs) == 0 {
+		ips, err := localIPs()
+		if err != nil {
+			return err
+		}
+		s.IPs = ips
+	}
+	if s.TTL <= 0 {
+		s.TTL = DefaultTTL
+	}
+	for _, name := range []string{s.InstanceName(), s.Host} {
+		if _, err := dnsmessage.NewName(name); err != nil {
+			return fmt.Errorf("mdns: invalid name %q: %v", name, err)
+		}
+	}
+	return nil
+}
+
+func absolute(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+func localIPs() ([]net.IP, error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+	var ips []net.IP
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() {
+			ips = append(ips, ipNet.IP)
+		}
+	}
+	return ips, nil
+}
+
+// サービスを表すリソースレコード
+// 問い合わせに応じて必要なものだけを選んで応答に入れる
+type records struct {
+	ptr  dnsmessage.Resource
+	srv  dnsmessage.Resource
+	txt  dnsmessage.Resource
+	addr []dnsmessage.Resource
+	// DNS-SDのサービスの種類の列挙用
+	enumeration dnsmessage.Resource
+}
+
+// ttlが0のレコードはgoodbyeパケットになり、受け取った側のキャッシュから消える
+func (s *Service) records(ttl time.Duration) records {
+	seconds := uint32(ttl / time.Second)
+	header := func(name string, t dnsmessage.Type, flush bool) dnsmessage.ResourceHeader {
+		class := dnsmessage.ClassINET
+		// 共有されるPTR以外は、このホストだけが持つレコードなのでcache-flushを立てる
+		if flush {
+			class |= classCacheFlush
+		}
+		// Typeは送信時に自動で設定されるが、応答するレコードを選ぶのに使うので先に入れておく
+		return dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Type: t, Class: class, TTL: seconds}
+	}
+	text := s.Text
+	if len(text) == 0 {
+		// 空のTXTレコードも長さ0の文字列を1つ持つ必要がある
+		text = []string{""}
+	}
+	r := records{
+		ptr: dnsmessage.Resource{
+			Header: header(s.ServiceName(), dnsmessage.TypePTR, false),
+			Body:   &dnsmessage.PTRResource{PTR: dnsmessage.MustNewName(s.InstanceName())},
+		},
+		srv: dnsmessage.Resource{
+			Header: header(s.InstanceName(), dnsmessage.TypeSRV, true),
+			Body:   &dnsmessage.SRVResource{Port: s.Port, Target: dnsmessage.MustNewName(s.Host)},
+		},
+		txt: dnsmessage.Resource{
+			Header: header(s.InstanceName(), dnsmessage.TypeTXT, true),
+			Body:   &dnsmessage.TXTResource{TXT: text},
+		},
+		enumeration: dnsmessage.Resource{
+			Header: header(ServicesName, dnsmessage.TypePTR, false),
+			Body:   &dnsmessage.PTRResource{PTR: dnsmessage.MustNewName(s.ServiceName())},
+		},
+	}
+	for _, ip := range s.IPs {
+		if ip4 := ip.To4(); ip4 != nil {
+			body := &dnsmessage.AResource{}
+			copy(body.A[:], ip4)
+			r.addr = append(r.addr, dnsmessage.Resource{Header: header(s.Host, dnsmessage.TypeA, true), Body: body})
+		} else {
+			body := &dnsmessage.AAAAResource{}
+			copy(body.AAAA[:], ip.To16())
+			r.addr = append(r.addr, dnsmessage.Resource{Header: header(s.Host, dnsmessage.TypeAAAA, true), Body: body})
+		}
+	}
+	return r
+}
+
+// DNSの名前は大文字と小文字を区別しない
+func sameName(a dnsmessage.Name, b string) bool {
+	return strings.EqualFold(a.String(), b)
+}
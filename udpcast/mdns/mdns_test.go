@@ -0,0 +1,317 @@
+package mdns
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"system-programming/udpcast"
+)
+
+// 既存のmDNSのデーモンと混ざらないように、ループバックの別のポートを使う
+func testConfig(t *testing.T, port int) udpcast.GroupConfig {
+	t.Helper()
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := DefaultConfig()
+	config.Port = port
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagLoopback != 0 && iface.Flags&net.FlagUp != 0 {
+			config.Interface = iface.Name
+			return config
+		}
+	}
+	t.Skip("no loopback interface")
+	return config
+}
+
+func startResponder(t *testing.T, config udpcast.GroupConfig, service Service) *Responder {
+	t.Helper()
+	responder, err := NewResponder(config)
+	if err != nil {
+		t.Skipf("multicast is not available: %v", err)
+	}
+	go func() {
+		_ = responder.Serve()
+	}()
+	if err := responder.Register(service); err != nil {
+		t.Fatal(err)
+	}
+	return responder
+}
+
+func waitEvent(t *testing.T, events <-chan Event, want EventType) Event {
+	t.Helper()
+	for {
+		select {
+		case event := <-events:
+			if event.Type == want {
+				return event
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %v", want)
+		}
+	}
+}
+
+func TestBrowse(t *testing.T) {
+	config := testConfig(t, 15353)
+	service := Service{
+		Instance: "Test Server",
+		Service:  "_test._tcp",
+		Host:     "test-host.local.",
+		Port:     8080,
+		IPs:      []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		Text:     []string{"path=/", "version=1"},
+	}
+	responder := startResponder(t, config, service)
+	defer responder.Close()
+
+	browser, err := NewBrowser(config, "_test._tcp", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer browser.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := make(chan Event, 16)
+	go func() {
+		_ = browser.Browse(ctx, func(event Event) {
+			events <- event
+		})
+	}()
+
+	added := waitEvent(t, events, Added).Entry
+	if added.Instance != "Test Server" || added.Host != "test-host.local." || added.Port != 8080 {
+		t.Errorf("unexpected entry: %+v", added)
+	}
+	if len(added.IPs) != 2 || len(added.Text) != 2 || added.Text[0] != "path=/" {
+		t.Errorf("unexpected addresses or text: %v %v", added.IPs, added.Text)
+	}
+	if added.InstanceName() != "Test Server._test._tcp.local." {
+		t.Errorf("unexpected instance name: %s", added.InstanceName())
+	}
+	if entries := browser.Entries(); len(entries) != 1 {
+		t.Errorf("got %d entries", len(entries))
+	}
+
+	// goodbyeを受け取ると削除される
+	if err := responder.Unregister("Test Server", "_test._tcp"); err != nil {
+		t.Fatal(err)
+	}
+	if removed := waitEvent(t, events, Removed).Entry; removed.Instance != "Test Server" {
+		t.Errorf("unexpected removed entry: %+v", removed)
+	}
+}
+
+// 通常のDNSのリゾルバのように5353番以外のポートから問い合わせると、ユニキャストでIDをそのまま返す
+func TestLegacyUnicastQuery(t *testing.T) {
+	config := testConfig(t, 15354)
+	responder := startResponder(t, config, Service{
+		Instance: "legacy",
+		Service:  "_test._udp",
+		Host:     "legacy-host.local.",
+		Port:     53,
+		IPs:      []net.IP{net.IPv4(127, 0, 0, 1)},
+	})
+	defer responder.Close()
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	query := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: 4321},
+		Questions: []dnsmessage.Question{{
+			Name:  dnsmessage.MustNewName("legacy-host.local."),
+			Type:  dnsmessage.TypeA,
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+	packet, err := query.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	group := &net.UDPAddr{IP: IPv4Group, Port: config.Port}
+	buffer := make([]byte, maxMessageSize)
+	// 起動直後の告知と入れ違いにならないように、応答が来るまで何回か送る
+	for retry := 0; retry < 5; retry++ {
+		if _, err := conn.WriteToUDP(packet, group); err != nil {
+			t.Skipf("cannot send to the group: %v", err)
+		}
+		if err := conn.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+			t.Fatal(err)
+		}
+		length, _, err := conn.ReadFrom(buffer)
+		if err != nil {
+			continue
+		}
+		var response dnsmessage.Message
+		if err := response.Unpack(buffer[:length]); err != nil {
+			t.Fatal(err)
+		}
+		if response.ID != 4321 || len(response.Questions) != 1 || len(response.Answers) != 1 {
+			t.Fatalf("unexpected response: %+v", response)
+		}
+		answer := response.Answers[0]
+		if answer.Header.Class != dnsmessage.ClassINET {
+			t.Errorf("cache-flush bit must be cleared: %v", answer.Header.Class)
+		}
+		if a := answer.Body.(*dnsmessage.AResource).A; a != [4]byte{127, 0, 0, 1} {
+			t.Errorf("got %v", a)
+		}
+		return
+	}
+	t.Fatal("no response")
+}
+
+func TestKnownAnswerSuppression(t *testing.T) {
+	service := Service{Instance: "known", Service: "_test._tcp", Host: "h.local.", IPs: []net.IP{net.IPv4(127, 0, 0, 1)}}
+	if err := service.normalize(); err != nil {
+		t.Fatal(err)
+	}
+	question := dnsmessage.Question{Name: dnsmessage.MustNewName(service.ServiceName()), Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET}
+	answers, additionals := service.answer(question)
+	if len(answers) != 1 || len(additionals) != 3 {
+		t.Fatalf("got %d answers and %d additionals", len(answers), len(additionals))
+	}
+	fresh := service.records(service.TTL).ptr
+	if len(suppressKnown(answers, []dnsmessage.Resource{fresh})) != 0 {
+		t.Error("known answer should be suppressed")
+	}
+	// TTLが半分を切っていれば改めて応答する
+	stale := service.records(service.TTL / 3).ptr
+	if len(suppressKnown(answers, []dnsmessage.Resource{stale})) != 1 {
+		t.Error("stale known answer should not be suppressed")
+	}
+}
+
+// 一度止めたBrowserでもう一度Browse()できる
+func TestBrowseAgain(t *testing.T) {
+	config := testConfig(t, 15355)
+	responder := startResponder(t, config, Service{Instance: "again", Service: "_again._tcp", Host: "again.local.", Port: 80})
+	defer responder.Close()
+
+	browser, err := NewBrowser(config, "_again._tcp", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer browser.Close()
+	browse := func(want EventType) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		found := false
+		err := browser.Browse(ctx, func(event Event) {
+			if event.Type == want && event.Entry.Instance == "again" {
+				found = true
+				cancel()
+			}
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !found {
+			t.Fatalf("%v was not received", want)
+		}
+	}
+	browse(Added)
+	// 2回目のBrowse()でもgoodbyeを受信できる
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		_ = responder.Unregister("again", "_again._tcp")
+	}()
+	browse(Removed)
+}
+
+// 登録から1秒以内に取り除いたサービスを、goodbyeのあとで告知し直さない
+func TestUnregisterBeforeReannounce(t *testing.T) {
+	config := testConfig(t, 15356)
+	conn, err := udpcast.ListenGroup(config)
+	if err != nil {
+		t.Skipf("multicast is not available: %v", err)
+	}
+	defer conn.Close()
+	responder := startResponder(t, config, Service{Instance: "short", Service: "_short._tcp", Host: "short.local.", Port: 80})
+	defer responder.Close()
+	if err := responder.Unregister("short", "_short._tcp"); err != nil {
+		t.Fatal(err)
+	}
+
+	buffer := make([]byte, maxMessageSize)
+	deadline := time.Now().Add(1500 * time.Millisecond)
+	if err := conn.SetReadDeadline(deadline); err != nil {
+		t.Fatal(err)
+	}
+	goodbye := false
+	for {
+		length, _, err := conn.ReadFrom(buffer)
+		if err != nil {
+			break
+		}
+		var message dnsmessage.Message
+		if err := message.Unpack(buffer[:length]); err != nil || !message.Response {
+			continue
+		}
+		for _, answer := range message.Answers {
+			if _, ok := answer.Body.(*dnsmessage.PTRResource); !ok || !sameName(answer.Header.Name, "_short._tcp.local.") {
+				continue
+			}
+			if answer.Header.TTL == 0 {
+				goodbye = true
+			} else if goodbye {
+				t.Fatal("service was announced again after goodbye")
+			}
+		}
+	}
+	if !goodbye {
+		t.Skip("goodbye was not received")
+	}
+}
+
+func TestServeReadError(t *testing.T) {
+	config := testConfig(t, 15357)
+	responder, err := NewResponder(config)
+	if err != nil {
+		t.Skipf("multicast is not available: %v", err)
+	}
+	var mu sync.Mutex
+	var failures int
+	responder.OnError = func(err error) {
+		mu.Lock()
+		failures++
+		mu.Unlock()
+	}
+	// Close()を通さずに閉じると、受信は失敗し続ける
+	_ = responder.conn.Close()
+	served := make(chan error, 1)
+	go func() {
+		served <- responder.Serve()
+	}()
+	time.Sleep(200 * time.Millisecond)
+	mu.Lock()
+	n := failures
+	mu.Unlock()
+	// 待つ間隔は5ms, 10ms, 20ms, ...と倍になるので、200msの間には数回しか読み直さない
+	if n == 0 || n > 10 {
+		t.Errorf("read %d times in 200ms", n)
+	}
+
+	_ = responder.Close()
+	// 2回目のClose()でpanicしない
+	_ = responder.Close()
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("Serve() = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve() did not return")
+	}
+}
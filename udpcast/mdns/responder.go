@@ -0,0 +1,274 @@
+package mdns
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"system-programming/udpcast"
+)
+
+// サービスを告知し、問い合わせに応答するもの
+// 名前の衝突の検出(probing)は実装していないので、インスタンス名はネットワーク内で一意になるように選ぶ
+type Responder struct {
+	conn     *udpcast.GroupConn
+	port     int
+	mu       sync.Mutex
+	services []*Service
+	closed   chan struct{}
+	wg       sync.WaitGroup
+	// 2回目以降のClose()は何もせずに最初の結果を返す
+	closeOnce sync.Once
+	closeErr  error
+	// 応答の送信の失敗などを記録したい場合に設定する
+	// 1つのパケットの失敗ではServe()は止まらない
+	OnError func(err error)
+}
+
+func NewResponder(config udpcast.GroupConfig) (*Responder, error) {
+	conn, err := udpcast.ListenGroup(config)
+	if err != nil {
+		return nil, err
+	}
+	return &Responder{conn: conn, port: config.Port, closed: make(chan struct{})}, nil
+}
+
+// サービスを追加して告知する
+// 告知は取りこぼされることがあるので、RFC 6762の8.3節に従って1秒空けてもう一度送る
+func (r *Responder) Register(service Service) error {
+	if err := service.normalize(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.services = append(r.services, &service)
+	r.mu.Unlock()
+	if err := r.announce(&service, service.TTL); err != nil {
+		return err
+	}
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		timer := time.NewTimer(time.Second)
+		defer timer.Stop()
+		select {
+		case <-r.closed:
+		case <-timer.C:
+			// 1秒の間にUnregister()されていれば、goodbyeのあとに告知し直さないようにする
+			// Unregister()のgoodbyeがこの告知より後になるように、ロックを持ったまま送る
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			if r.registered(&service) {
+				r.report(r.announce(&service, service.TTL))
+			}
+		}
+	}()
+	return nil
+}
+
+func (r *Responder) registered(service *Service) bool {
+	for _, s := range r.services {
+		if s == service {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Responder) report(err error) {
+	if err != nil && r.OnError != nil {
+		r.OnError(err)
+	}
+}
+
+// サービスを取り除き、TTLが0のレコード(goodbye)を送ってキャッシュから消してもらう
+func (r *Responder) Unregister(instance, service string) error {
+	r.mu.Lock()
+	var removed *Service
+	for i, s := range r.services {
+		if s.Instance == instance && s.Service == service {
+			removed = s
+			r.services = append(r.services[:i], r.services[i+1:]...)
+			break
+		}
+	}
+	r.mu.Unlock()
+	if removed == nil {
+		return nil
+	}
+	return r.announce(removed, 0)
+}
+
+func (r *Responder) announce(service *Service, ttl time.Duration) error {
+	records := service.records(ttl)
+	message := dnsmessage.Message{
+		Header:      dnsmessage.Header{Response: true, Authoritative: true},
+		Answers:     []dnsmessage.Resource{records.ptr, records.srv, records.txt},
+		Additionals: records.addr,
+	}
+	if ttl > 0 {
+		message.Answers = append(message.Answers, records.enumeration)
+	}
+	packet, err := message.Pack()
+	if err != nil {
+		return err
+	}
+	return r.conn.Send(packet)
+}
+
+// 問い合わせを受信して応答し続ける
+// 受信や応答の失敗はOnErrorに渡して続け、Close()されるとnilを返す
+// 受信の失敗が続く場合は、net/httpのServerと同じように間隔を倍にしながら(最大1秒)待ってから読み直す
+func (r *Responder) Serve() error {
+	buffer := make([]byte, maxMessageSize)
+	var delay time.Duration
+	for {
+		length, remoteAddress, err := r.conn.ReadFrom(buffer)
+		if err != nil {
+			select {
+			case <-r.closed:
+				return nil
+			default:
+			}
+			r.report(err)
+			if delay == 0 {
+				delay = 5 * time.Millisecond
+			} else if delay *= 2; delay > time.Second {
+				delay = time.Second
+			}
+			timer := time.NewTimer(delay)
+			select {
+			case <-r.closed:
+				timer.Stop()
+				return nil
+			case <-timer.C:
+			}
+			continue
+		}
+		delay = 0
+		var query dnsmessage.Message
+		// mDNSのポートには他のホストの応答も届くので、解釈できないものや問い合わせでないものは無視する
+		if err := query.Unpack(buffer[:length]); err != nil || query.Response || query.OpCode != 0 {
+			continue
+		}
+		// 1つの相手への送信に失敗しても、他の問い合わせには応答し続ける
+		r.report(r.respond(&query, remoteAddress.(*net.UDPAddr)))
+	}
+}
+
+func (r *Responder) respond(query *dnsmessage.Message, from *net.UDPAddr) error {
+	response := dnsmessage.Message{Header: dnsmessage.Header{Response: true, Authoritative: true}}
+	unicast := false
+	r.mu.Lock()
+	for _, question := range query.Questions {
+		if question.Class&classUnicastResponse != 0 {
+			unicast = true
+		}
+		for _, service := range r.services {
+			answers, additionals := service.answer(question)
+			response.Answers = append(response.Answers, suppressKnown(answers, query.Answers)...)
+			response.Additionals = append(response.Additionals, additionals...)
+		}
+	}
+	r.mu.Unlock()
+	if len(response.Answers) == 0 {
+		return nil
+	}
+
+	// 5353番以外のポートからの問い合わせは通常のDNSのリゾルバ(legacy unicast)からのものなので、
+	// IDと質問をそのまま返し、cache-flushのビットを落としてユニキャストで応答する(RFC 6762 6.7節)
+	legacy := from.Port != r.port
+	if legacy {
+		response.ID = query.ID
+		response.Questions = query.Questions
+		for _, section := range [][]dnsmessage.Resource{response.Answers, response.Additionals} {
+			for i := range section {
+				section[i].Header.Class &^= classCacheFlush
+			}
+		}
+	}
+	packet, err := response.Pack()
+	if err != nil {
+		return err
+	}
+	if legacy || unicast {
+		_, err = r.conn.WriteTo(packet, from)
+		return err
+	}
+	return r.conn.Send(packet)
+}
+
+// 質問に対する回答と、問い合わせた側が続けて必要になる追加のレコード
+func (s *Service) answer(question dnsmessage.Question) (answers, additionals []dnsmessage.Resource) {
+	records := s.records(s.TTL)
+	matches := func(t dnsmessage.Type) bool {
+		return question.Type == t || question.Type == dnsmessage.TypeALL
+	}
+	switch {
+	case sameName(question.Name, ServicesName) && matches(dnsmessage.TypePTR):
+		answers = append(answers, records.enumeration)
+	case sameName(question.Name, s.ServiceName()) && matches(dnsmessage.TypePTR):
+		// ブラウズに対しては、インスタンスの解決に必要なSRV、TXT、アドレスも一緒に返す(RFC 6763 12.1節)
+		answers = append(answers, records.ptr)
+		additionals = append(additionals, records.srv, records.txt)
+		additionals = append(additionals, records.addr...)
+	case sameName(question.Name, s.InstanceName()):
+		if matches(dnsmessage.TypeSRV) {
+			answers = append(answers, records.srv)
+		}
+		if matches(dnsmessage.TypeTXT) {
+			answers = append(answers, records.txt)
+		}
+		if len(answers) > 0 {
+			additionals = append(additionals, records.addr...)
+		}
+	case sameName(question.Name, s.Host):
+		for _, addr := range records.addr {
+			if matches(addr.Header.Type) {
+				answers = append(answers, addr)
+			}
+		}
+	}
+	return answers, additionals
+}
+
+// 問い合わせた側がすでに知っていて、TTLが半分以上残っているPTRレコードは応答しない(Known-Answer Suppression, RFC 6762 7.1節)
+func suppressKnown(answers, known []dnsmessage.Resource) []dnsmessage.Resource {
+	var result []dnsmessage.Resource
+	for _, answer := range answers {
+		suppressed := false
+		if ptr, ok := answer.Body.(*dnsmessage.PTRResource); ok {
+			for _, k := range known {
+				if knownPTR, ok := k.Body.(*dnsmessage.PTRResource); ok &&
+					sameName(k.Header.Name, answer.Header.Name.String()) &&
+					sameName(knownPTR.PTR, ptr.PTR.String()) &&
+					k.Header.TTL >= answer.Header.TTL/2 {
+					suppressed = true
+					break
+				}
+			}
+		}
+		if !suppressed {
+			result = append(result, answer)
+		}
+	}
+	return result
+}
+
+// 登録されている全てのサービスのgoodbyeを送ってから閉じる
+func (r *Responder) Close() error {
+	r.closeOnce.Do(func() {
+		r.mu.Lock()
+		services := r.services
+		r.services = nil
+		r.mu.Unlock()
+		for _, service := range services {
+			_ = r.announce(service, 0)
+		}
+		close(r.closed)
+		r.closeErr = r.conn.Close()
+		r.wg.Wait()
+	})
+	return r.closeErr
+}
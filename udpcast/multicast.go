@@ -0,0 +1,223 @@
+// udpcastパッケージはUDPのマルチキャストとブロードキャストで、1つの送信元から複数の受信側へデータを配信する仕組みをまとめたもの
+// udp.goの例ではグループのアドレス(224.0.0.1:9999)やインターフェースが決め打ちになっているが、ここでは設定で指定できる
+package udpcast
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// マルチキャストの送受信の設定
+type GroupConfig struct {
+	// 参加する(送信する)マルチキャストグループのアドレス
+	// IPv4では224.0.0.0/4、IPv6ではff00::/8の範囲。IPv4とIPv6を混ぜることはできない
+	Groups []net.IP
+	Port   int
+	// 使うネットワークインターフェースの名前("en0"や"eth0"、ループバックの"lo"など)。空の場合はOSのルーティングに任せる
+	// IPv6のリンクローカルのグループ(ff02::/16)に送信する場合は必須
+	Interface string
+	// 送信するパケットのTTL(IPv6ではホップリミット)。0の場合は1になり、同じサブネットにしか届かない
+	TTL int
+	// 自分が送信したパケットを同じホストの受信側でも受け取るか
+	Loopback bool
+	// 空でなければソース固定マルチキャスト(SSM)になり、ここに挙げた送信元からのパケットだけを受信する
+	// SSMのグループは通常IPv4では232.0.0.0/8、IPv6ではff3x::/32の範囲を使う
+	Sources []net.IP
+}
+
+// グループに参加したUDPのソケット
+// ReadFrom()で受信でき、Send()で設定した全てのグループに送信できる
+type GroupConn struct {
+	*net.UDPConn
+	config GroupConfig
+	iface  *net.Interface
+	v4     *ipv4.PacketConn
+	v6     *ipv6.PacketConn
+}
+
+func (c *GroupConfig) isIPv6() (bool, error) {
+	if len(c.Groups) == 0 {
+		return false, errors.New("udpcast: no multicast group")
+	}
+	v6 := c.Groups[0].To4() == nil
+	for _, group := range c.Groups {
+		if !group.IsMulticast() {
+			return false, fmt.Errorf("udpcast: %v is not a multicast address", group)
+		}
+		if (group.To4() == nil) != v6 {
+			return false, errors.New("udpcast: cannot mix IPv4 and IPv6 groups")
+		}
+	}
+	return v6, nil
+}
+
+func (c *GroupConfig) networks() (string, string, error) {
+	v6, err := c.isIPv6()
+	if err != nil {
+		return "", "", err
+	}
+	if v6 {
+		return "udp6", "::", nil
+	}
+	return "udp4", "0.0.0.0", nil
+}
+
+// 設定したグループに参加して受信するソケットを作る
+// 全てのアドレスで待ち受けた上でグループに参加するので、複数のグループのパケットを1つのソケットで受信できる
+func ListenGroup(config GroupConfig) (*GroupConn, error) {
+	network, wildcard, err := config.networks()
+	if err != nil {
+		return nil, err
+	}
+	lc := net.ListenConfig{Control: reusePort}
+	conn, err := lc.ListenPacket(context.Background(), network, net.JoinHostPort(wildcard, strconv.Itoa(config.Port)))
+	if err != nil {
+		return nil, err
+	}
+	c, err := newGroupConn(conn.(*net.UDPConn), config)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	for _, group := range config.Groups {
+		if len(config.Sources) == 0 {
+			err = c.JoinGroup(group)
+		} else {
+			for _, source := range config.Sources {
+				if err = c.JoinSourceSpecificGroup(group, source); err != nil {
+					break
+				}
+			}
+		}
+		if err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// 設定したグループに送信するソケットを作る
+// 送信元のポートはOSが選ぶ
+func DialGroup(config GroupConfig) (*GroupConn, error) {
+	network, wildcard, err := config.networks()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenPacket(network, net.JoinHostPort(wildcard, "0"))
+	if err != nil {
+		return nil, err
+	}
+	c, err := newGroupConn(conn.(*net.UDPConn), config)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func newGroupConn(conn *net.UDPConn, config GroupConfig) (*GroupConn, error) {
+	c := &GroupConn{UDPConn: conn, config: config}
+	if config.Interface != "" {
+		iface, err := net.InterfaceByName(config.Interface)
+		if err != nil {
+			return nil, err
+		}
+		c.iface = iface
+	}
+	ttl := config.TTL
+	if ttl <= 0 {
+		ttl = 1
+	}
+	if v6, _ := config.isIPv6(); v6 {
+		c.v6 = ipv6.NewPacketConn(conn)
+		if err := c.v6.SetMulticastHopLimit(ttl); err != nil {
+			return nil, err
+		}
+		if err := c.v6.SetMulticastLoopback(config.Loopback); err != nil {
+			return nil, err
+		}
+		if c.iface != nil {
+			if err := c.v6.SetMulticastInterface(c.iface); err != nil {
+				return nil, err
+			}
+		}
+		return c, nil
+	}
+	c.v4 = ipv4.NewPacketConn(conn)
+	if err := c.v4.SetMulticastTTL(ttl); err != nil {
+		return nil, err
+	}
+	if err := c.v4.SetMulticastLoopback(config.Loopback); err != nil {
+		return nil, err
+	}
+	if c.iface != nil {
+		if err := c.v4.SetMulticastInterface(c.iface); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// 実行中に参加するグループを増やす
+func (c *GroupConn) JoinGroup(group net.IP) error {
+	addr := &net.UDPAddr{IP: group}
+	if c.v6 != nil {
+		return c.v6.JoinGroup(c.iface, addr)
+	}
+	return c.v4.JoinGroup(c.iface, addr)
+}
+
+func (c *GroupConn) LeaveGroup(group net.IP) error {
+	addr := &net.UDPAddr{IP: group}
+	if c.v6 != nil {
+		return c.v6.LeaveGroup(c.iface, addr)
+	}
+	return c.v4.LeaveGroup(c.iface, addr)
+}
+
+// 指定した送信元からのパケットだけを受信する(SSM)
+func (c *GroupConn) JoinSourceSpecificGroup(group, source net.IP) error {
+	groupAddr, sourceAddr := &net.UDPAddr{IP: group}, &net.UDPAddr{IP: source}
+	if c.v6 != nil {
+		return c.v6.JoinSourceSpecificGroup(c.iface, groupAddr, sourceAddr)
+	}
+	return c.v4.JoinSourceSpecificGroup(c.iface, groupAddr, sourceAddr)
+}
+
+func (c *GroupConn) LeaveSourceSpecificGroup(group, source net.IP) error {
+	groupAddr, sourceAddr := &net.UDPAddr{IP: group}, &net.UDPAddr{IP: source}
+	if c.v6 != nil {
+		return c.v6.LeaveSourceSpecificGroup(c.iface, groupAddr, sourceAddr)
+	}
+	return c.v4.LeaveSourceSpecificGroup(c.iface, groupAddr, sourceAddr)
+}
+
+// 送信先のアドレス
+// IPv6のリンクローカルのアドレスはどのインターフェースから送るかをゾーンで指定する必要がある
+func (c *GroupConn) GroupAddrs() []*net.UDPAddr {
+	addrs := make([]*net.UDPAddr, len(c.config.Groups))
+	for i, group := range c.config.Groups {
+		addrs[i] = &net.UDPAddr{IP: group, Port: c.config.Port}
+		if c.iface != nil && group.To4() == nil {
+			addrs[i].Zone = c.iface.Name
+		}
+	}
+	return addrs
+}
+
+// 設定した全てのグループに送信する
+func (c *GroupConn) Send(b []byte) error {
+	for _, addr := range c.GroupAddrs() {
+		if _, err := c.WriteToUDP(b, addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package udpcast
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// ループバックのインターフェースでマルチキャストを試す
+func loopbackInterface(t *testing.T) string {
+	t.Helper()
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagLoopback != 0 && iface.Flags&net.FlagUp != 0 {
+			return iface.Name
+		}
+	}
+	t.Skip("no loopback interface")
+	return ""
+}
+
+// Linuxのループバックにはff00::/8の経路がないので、IPv6ではマルチキャストに対応したインターフェースも候補にする
+func ipv6Interfaces(t *testing.T) []string {
+	t.Helper()
+	names := []string{loopbackInterface(t)}
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagMulticast != 0 && iface.Flags&net.FlagUp != 0 && iface.Flags&net.FlagLoopback == 0 {
+			names = append(names, iface.Name)
+		}
+	}
+	return names
+}
+
+func listenOrSkip(t *testing.T, config GroupConfig) *GroupConn {
+	t.Helper()
+	conn, err := ListenGroup(config)
+	if err != nil {
+		t.Skipf("multicast is not available: %v", err)
+	}
+	return conn
+}
+
+func receive(t *testing.T, conn *GroupConn) (string, net.Addr) {
+	t.Helper()
+	if err := conn.SetReadDeadline(time.Now().Add(2 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	buffer := make([]byte, 1500)
+	length, remoteAddress, err := conn.ReadFrom(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(buffer[:length]), remoteAddress
+}
+
+func TestMulticastGroups(t *testing.T) {
+	iface := loopbackInterface(t)
+	config := GroupConfig{
+		Groups:    []net.IP{net.ParseIP("224.0.0.251"), net.ParseIP("239.1.2.3")},
+		Port:      19999,
+		Interface: iface,
+		Loopback:  true,
+	}
+	listener := listenOrSkip(t, config)
+	defer listener.Close()
+
+	// グループごとに別々に送って、両方とも1つのソケットで受信できることを確かめる
+	for _, group := range config.Groups {
+		senderConfig := config
+		senderConfig.Groups = []net.IP{group}
+		sender, err := DialGroup(senderConfig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := sender.Send([]byte(group.String())); err != nil {
+			t.Fatal(err)
+		}
+		if message, _ := receive(t, listener); message != group.String() {
+			t.Errorf("got %q, want %q", message, group)
+		}
+		_ = sender.Close()
+	}
+}
+
+func TestSourceSpecificMulticast(t *testing.T) {
+	iface := loopbackInterface(t)
+	config := GroupConfig{
+		Groups:    []net.IP{net.ParseIP("232.1.2.3")},
+		Port:      19998,
+		Interface: iface,
+		Loopback:  true,
+	}
+	sender, err := DialGroup(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sender.Close()
+
+	// 送信元のアドレスはルーティング次第なので、先に通常の参加で受信して調べておく
+	probe := listenOrSkip(t, config)
+	if err := sender.Send([]byte("probe")); err != nil {
+		t.Fatal(err)
+	}
+	_, from := receive(t, probe)
+	_ = probe.Close()
+	source := from.(*net.UDPAddr).IP
+
+	ssmConfig := config
+	ssmConfig.Sources = []net.IP{source}
+	listener := listenOrSkip(t, ssmConfig)
+	defer listener.Close()
+	// 他の送信元からのパケットは届かない
+	other := ssmConfig
+	other.Sources = []net.IP{net.ParseIP("192.0.2.254")}
+	filtered := listenOrSkip(t, other)
+	defer filtered.Close()
+
+	if err := sender.Send([]byte("ssm")); err != nil {
+		t.Fatal(err)
+	}
+	if message, _ := receive(t, listener); message != "ssm" {
+		t.Errorf("got %q", message)
+	}
+	if err := filtered.SetReadDeadline(time.Now().Add(100 * time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := filtered.ReadFrom(make([]byte, 1500)); err == nil {
+		t.Error("received a packet from an unexpected source")
+	}
+}
+
+func TestMulticastIPv6(t *testing.T) {
+	for _, iface := range ipv6Interfaces(t) {
+		config := GroupConfig{
+			Groups:    []net.IP{net.ParseIP("ff02::1:3")},
+			Port:      19997,
+			Interface: iface,
+			Loopback:  true,
+		}
+		listener, err := ListenGroup(config)
+		if err != nil {
+			continue
+		}
+		sender, err := DialGroup(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = sender.Send([]byte("ipv6"))
+		if err == nil {
+			if message, _ := receive(t, listener); message != "ipv6" {
+				t.Errorf("got %q", message)
+			}
+		}
+		_ = sender.Close()
+		_ = listener.Close()
+		if err == nil {
+			return
+		}
+	}
+	t.Skip("IPv6 multicast is not available")
+}
+
+func TestGroupConfigValidation(t *testing.T) {
+	if _, err := ListenGroup(GroupConfig{Groups: []net.IP{net.ParseIP("192.0.2.1")}}); err == nil {
+		t.Error("unicast address should be rejected")
+	}
+	if _, err := ListenGroup(GroupConfig{Groups: []net.IP{net.ParseIP("224.0.0.1"), net.ParseIP("ff02::1")}}); err == nil {
+		t.Error("mixed address families should be rejected")
+	}
+}
@@ -0,0 +1,35 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package udpcast
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// 同じホストで複数の受信側が同じポートを待ち受けられるように、SO_REUSEADDRとSO_REUSEPORTを設定する
+// net.ListenMulticastUDP()も内部で同じことをしている
+func reusePort(network, address string, c syscall.RawConn) error {
+	var err error
+	if controlErr := c.Control(func(fd uintptr) {
+		if err = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEADDR, 1); err != nil {
+			return
+		}
+		err = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+	}); controlErr != nil {
+		return controlErr
+	}
+	return err
+}
+
+func setBroadcast(c syscall.RawConn) error {
+	var err error
+	if controlErr := c.Control(func(fd uintptr) {
+		err = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_BROADCAST, 1)
+	}); controlErr != nil {
+		return controlErr
+	}
+	return err
+}
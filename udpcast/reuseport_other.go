@@ -0,0 +1,16 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package udpcast
+
+import (
+	"syscall"
+)
+
+func reusePort(network, address string, c syscall.RawConn) error {
+	return nil
+}
+
+func setBroadcast(c syscall.RawConn) error {
+	return nil
+}
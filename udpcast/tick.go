@@ -0,0 +1,126 @@
+package udpcast
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net"
+	"time"
+)
+
+const DefaultInterval = 10 * time.Second
+
+// tickメッセージのフォーマット(ビッグエンディアン)
+// udp.goの例のようにnow.String()を送るだけでは、受信側で時刻を比べたり抜けを検出したりできないので、固定長のバイナリにする
+//
+//	0-3:   マジックナンバー "TICK"
+//	4-7:   セッションID(送信側の起動ごとにランダム)
+//	8-15:  シーケンス番号(0から1ずつ増える)
+//	16-23: 送信側の起動からの経過時間(モノトニック時計、ナノ秒)
+//	24-31: 送信側のUnix時刻(壁時計、ナノ秒)
+const TickMessageSize = 32
+
+var tickMagic = [4]byte{'T', 'I', 'C', 'K'}
+
+var ErrInvalidTick = errors.New("udpcast: invalid tick message")
+
+type TickMessage struct {
+	Session  uint32
+	Sequence uint64
+	// 壁時計はNTPなどで進んだり戻ったりするが、モノトニック時計は一定の速さで進むので間隔の計算に使える
+	Monotonic time.Duration
+	Wall      time.Time
+}
+
+func (m TickMessage) MarshalBinary() ([]byte, error) {
+	b := make([]byte, TickMessageSize)
+	copy(b, tickMagic[:])
+	binary.BigEndian.PutUint32(b[4:], m.Session)
+	binary.BigEndian.PutUint64(b[8:], m.Sequence)
+	binary.BigEndian.PutUint64(b[16:], uint64(m.Monotonic))
+	binary.BigEndian.PutUint64(b[24:], uint64(m.Wall.UnixNano()))
+	return b, nil
+}
+
+func (m *TickMessage) UnmarshalBinary(b []byte) error {
+	if len(b) != TickMessageSize || string(b[:4]) != string(tickMagic[:]) {
+		return ErrInvalidTick
+	}
+	m.Session = binary.BigEndian.Uint32(b[4:])
+	m.Sequence = binary.BigEndian.Uint64(b[8:])
+	m.Monotonic = time.Duration(binary.BigEndian.Uint64(b[16:]))
+	m.Wall = time.Unix(0, int64(binary.BigEndian.Uint64(b[24:])))
+	return nil
+}
+
+// 1つのパケットを宛先全てに送るもの
+// マルチキャストの*GroupConnとブロードキャストの*BroadcastConnが実装している
+type Sender interface {
+	Send(b []byte) error
+}
+
+// intervalの区切りの時刻(10秒間隔なら00秒、10秒、...)に合わせて、tickメッセージをsenderに送り続ける
+// ctxがキャンセルされるとnilを返す
+func ServeTicks(ctx context.Context, sender Sender, interval time.Duration) error {
+	var session [4]byte
+	if _, err := rand.Read(session[:]); err != nil {
+		return err
+	}
+	message := TickMessage{Session: binary.BigEndian.Uint32(session[:])}
+	start := time.Now()
+	wait := start.Truncate(interval).Add(interval).Sub(start)
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return nil
+	case <-timer.C:
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		// time.Now()はモノトニック時計の値も持っているので、Sub()はモノトニック時計で計算される
+		now := time.Now()
+		message.Monotonic = now.Sub(start)
+		message.Wall = now
+		b, err := message.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		if err := sender.Send(b); err != nil {
+			return err
+		}
+		message.Sequence++
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// 受信したtickメッセージ
+type Tick struct {
+	TickMessage
+	From net.Addr
+	// 受信した時刻(モノトニック時計の値も含む)
+	Received time.Time
+}
+
+// connから受信したtickメッセージをhandlerに渡し続ける
+// 形式の違うパケットは無視する。connが閉じられるとエラーを返す
+func ReadTicks(conn net.PacketConn, handler func(Tick)) error {
+	buffer := make([]byte, 1500)
+	for {
+		length, remoteAddress, err := conn.ReadFrom(buffer)
+		if err != nil {
+			return err
+		}
+		tick := Tick{From: remoteAddress, Received: time.Now()}
+		if err := tick.UnmarshalBinary(buffer[:length]); err != nil {
+			continue
+		}
+		handler(tick)
+	}
+}
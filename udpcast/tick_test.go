@@ -0,0 +1,131 @@
+package udpcast
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestTickMessage(t *testing.T) {
+	message := TickMessage{Session: 0xdeadbeef, Sequence: 42, Monotonic: 3 * time.Second, Wall: time.Unix(1600000000, 123456789)}
+	b, err := message.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != TickMessageSize {
+		t.Fatalf("got %d bytes", len(b))
+	}
+	var decoded TickMessage
+	if err := decoded.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Session != message.Session || decoded.Sequence != message.Sequence ||
+		decoded.Monotonic != message.Monotonic || !decoded.Wall.Equal(message.Wall) {
+		t.Errorf("got %+v, want %+v", decoded, message)
+	}
+	if err := decoded.UnmarshalBinary([]byte(time.Now().String())); err != ErrInvalidTick {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestTickMonitor(t *testing.T) {
+	from := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 9999}
+	monitor := NewTickMonitor()
+	base := monitor.start
+	// 送信側の時計は受信側より1秒遅れていて、ネットワークの遅延は1msか3ms
+	observe := func(session uint32, sequence uint64, delay time.Duration) TickStats {
+		sent := time.Duration(sequence) * time.Second
+		return monitor.Observe(Tick{
+			TickMessage: TickMessage{
+				Session:   session,
+				Sequence:  sequence,
+				Monotonic: sent,
+				Wall:      base.Add(sent - time.Second).Round(0),
+			},
+			From:     from,
+			Received: base.Add(sent + delay),
+		})
+	}
+	for _, sequence := range []uint64{0, 1, 2, 5, 4, 4, 6} {
+		delay := time.Millisecond
+		if sequence%2 == 0 {
+			delay = 3 * time.Millisecond
+		}
+		observe(1, sequence, delay)
+	}
+	stats := monitor.Stats()[0]
+	// 3は抜け、4は順序の入れ替わりと重複
+	if stats.Received != 6 || stats.Lost != 1 || stats.Duplicated != 1 || stats.Reordered != 1 {
+		t.Errorf("unexpected counts: %v", stats)
+	}
+	if stats.Offset != time.Second+time.Millisecond {
+		t.Errorf("got offset %v", stats.Offset)
+	}
+	if stats.Jitter <= 0 || stats.Jitter > 2*time.Millisecond {
+		t.Errorf("got jitter %v", stats.Jitter)
+	}
+
+	// 送信側が再起動するとセッションが変わり、数え直しになる
+	stats = observe(2, 0, time.Millisecond)
+	if stats.Restarts != 1 || stats.Received != 1 || stats.Lost != 0 {
+		t.Errorf("unexpected stats after restart: %v", stats)
+	}
+
+	// 最初に受信したものより前のシーケンス番号は、抜けとして数えていないので差し引かない
+	observe(3, 6, time.Millisecond)
+	stats = observe(3, 5, time.Millisecond)
+	if stats.Lost != 0 || stats.Reordered != 1 {
+		t.Errorf("unexpected stats for an older sequence: %v", stats)
+	}
+	observe(3, 8, time.Millisecond)
+	stats = observe(3, 7, time.Millisecond)
+	if stats.Lost != 0 || stats.Received != 4 {
+		t.Errorf("unexpected stats after reordering: %v", stats)
+	}
+	observe(3, 100, time.Millisecond)
+	stats = observe(3, 1, time.Millisecond)
+	if stats.Lost != 91 {
+		t.Errorf("unexpected stats for a sequence older than the window: %v", stats)
+	}
+}
+
+func TestServeTicks(t *testing.T) {
+	iface := loopbackInterface(t)
+	config := GroupConfig{
+		Groups:    []net.IP{net.ParseIP("239.1.2.4")},
+		Port:      19996,
+		Interface: iface,
+		Loopback:  true,
+	}
+	listener := listenOrSkip(t, config)
+	defer listener.Close()
+	sender, err := DialGroup(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sender.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = ServeTicks(ctx, sender, 10*time.Millisecond)
+	}()
+	monitor := NewTickMonitor()
+	var stats TickStats
+	if err := listener.SetReadDeadline(time.Now().Add(2 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	_ = ReadTicks(listener, func(tick Tick) {
+		if stats = monitor.Observe(tick); stats.Received == 5 {
+			_ = listener.SetReadDeadline(time.Now())
+		}
+	})
+	if stats.Received != 5 {
+		t.Fatalf("received %d ticks", stats.Received)
+	}
+	// 同じホストなので時計のずれはほぼ0
+	if stats.Offset < 0 || stats.Offset > 100*time.Millisecond {
+		t.Errorf("got offset %v", stats.Offset)
+	}
+}
@@ -0,0 +1,180 @@
+package udpcast
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 重複と順序の入れ替わりを判定するために覚えておく、直近のシーケンス番号の数
+const sequenceWindow = 64
+
+// オフセットの推定に使う直近のサンプル数
+const offsetWindow = 8
+
+// 送信元ごとの統計
+type TickStats struct {
+	From     string
+	Session  uint32
+	Received uint64
+	// 受信していないシーケンス番号の数。後から遅れて届いたものは差し引く
+	Lost       uint64
+	Duplicated uint64
+	Reordered  uint64
+	// 送信側のセッションが変わった(再起動した)回数
+	Restarts uint64
+	// 受信側の壁時計から送信側の壁時計を引いたもの
+	// 片方向のネットワークの遅延も含むので、直近のサンプルのうち最小のもの(遅延が最も小さかったもの)を使う
+	Offset time.Duration
+	// RFC 3550(RTP)の到着間隔ジッター
+	Jitter time.Duration
+	// 送信側のモノトニック時計に対する受信側のモノトニック時計の進み方のずれ(ppm)
+	// 正なら受信側の時計が速い
+	Drift float64
+}
+
+func (s TickStats) String() string {
+	return fmt.Sprintf("%s session=%08x received=%d lost=%d duplicated=%d reordered=%d restarts=%d offset=%v jitter=%v drift=%+.1fppm",
+		s.From, s.Session, s.Received, s.Lost, s.Duplicated, s.Reordered, s.Restarts, s.Offset, s.Jitter, s.Drift)
+}
+
+type tickState struct {
+	stats   TickStats
+	highest uint64
+	// 最初に受信したシーケンス番号。これより前のものは抜けとして数えていない
+	lowest uint64
+	// highestから何個前のシーケンス番号を受信したかのビットマップ(ビット0がhighest)
+	seen    uint64
+	offsets []time.Duration
+	// ジッターとドリフトの計算用の、受信側のモノトニック時計での時刻
+	lastTransit  time.Duration
+	firstTransit time.Duration
+	firstSent    time.Duration
+	lastSent     time.Duration
+	jitter       float64
+}
+
+// 複数の送信元からのtickメッセージを受け取って、時計のずれと、抜けや重複、順序の入れ替わりを集計する
+type TickMonitor struct {
+	mu      sync.Mutex
+	start   time.Time
+	senders map[string]*tickState
+}
+
+func NewTickMonitor() *TickMonitor {
+	return &TickMonitor{start: time.Now(), senders: make(map[string]*tickState)}
+}
+
+// 受信したtickを集計に加えて、その送信元の最新の統計を返す
+func (m *TickMonitor) Observe(tick Tick) TickStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	from := tick.From.String()
+	state, ok := m.senders[from]
+	if !ok || state.stats.Session != tick.Session {
+		restarts := uint64(0)
+		if ok {
+			restarts = state.stats.Restarts + 1
+		}
+		state = &tickState{stats: TickStats{From: from, Session: tick.Session, Restarts: restarts}}
+		m.senders[from] = state
+		state.first(tick, m.received(tick))
+		return state.stats
+	}
+	state.observe(tick, m.received(tick))
+	return state.stats
+}
+
+// 受信時刻をこのモニターの作成からの経過時間(モノトニック時計)にする
+func (m *TickMonitor) received(tick Tick) time.Duration {
+	return tick.Received.Sub(m.start)
+}
+
+func (s *tickState) first(tick Tick, received time.Duration) {
+	s.highest, s.lowest = tick.Sequence, tick.Sequence
+	s.seen = 1
+	s.firstSent, s.lastSent = tick.Monotonic, tick.Monotonic
+	s.firstTransit = received - tick.Monotonic
+	s.lastTransit = s.firstTransit
+	s.stats.Received = 1
+	s.addOffset(tick)
+}
+
+func (s *tickState) observe(tick Tick, received time.Duration) {
+	switch {
+	case tick.Sequence > s.highest:
+		gap := tick.Sequence - s.highest
+		s.stats.Lost += gap - 1
+		if gap >= sequenceWindow {
+			s.seen = 0
+		} else {
+			s.seen <<= gap
+		}
+		s.seen |= 1
+		s.highest = tick.Sequence
+	case s.highest-tick.Sequence < sequenceWindow:
+		bit := uint64(1) << (s.highest - tick.Sequence)
+		if s.seen&bit != 0 {
+			s.stats.Duplicated++
+			return
+		}
+		s.seen |= bit
+		s.stats.Reordered++
+		// 抜けとして数えていたものが遅れて届いた
+		if tick.Sequence > s.lowest {
+			s.stats.Lost--
+		}
+	default:
+		// ウィンドウより古いものは重複か遅れて届いたものか区別できないので、遅れて届いたものとして扱う
+		s.stats.Reordered++
+		if tick.Sequence > s.lowest && s.stats.Lost > 0 {
+			s.stats.Lost--
+		}
+	}
+	s.stats.Received++
+	s.addOffset(tick)
+
+	// RFC 3550 6.4.1節: D = (Rj - Ri) - (Sj - Si), J += (|D| - J) / 16
+	transit := received - tick.Monotonic
+	d := transit - s.lastTransit
+	if d < 0 {
+		d = -d
+	}
+	s.jitter += (float64(d) - s.jitter) / 16
+	s.lastTransit = transit
+	s.stats.Jitter = time.Duration(s.jitter)
+
+	// 送信側の経過時間あたりの、送信から受信までの時間の変化がドリフト
+	if tick.Monotonic > s.lastSent {
+		s.lastSent = tick.Monotonic
+	}
+	if elapsed := s.lastSent - s.firstSent; elapsed > 0 && tick.Monotonic == s.lastSent {
+		s.stats.Drift = float64(transit-s.firstTransit) / float64(elapsed) * 1e6
+	}
+}
+
+func (s *tickState) addOffset(tick Tick) {
+	s.offsets = append(s.offsets, tick.Received.Sub(tick.Wall))
+	if len(s.offsets) > offsetWindow {
+		s.offsets = s.offsets[1:]
+	}
+	s.stats.Offset = s.offsets[0]
+	for _, offset := range s.offsets[1:] {
+		if offset < s.stats.Offset {
+			s.stats.Offset = offset
+		}
+	}
+}
+
+// 全ての送信元の統計を送信元のアドレス順に返す
+func (m *TickMonitor) Stats() []TickStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats := make([]TickStats, 0, len(m.senders))
+	for _, state := range m.senders {
+		stats = append(stats, state.stats)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].From < stats[j].From })
+	return stats
+}
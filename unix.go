@@ -5,6 +5,8 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+
+	"system-programming/unixsock"
 )
 
 // コンピュータの内部でしか使えない代わりに高速な通信が可能でTCP型(ストリーム型)とUDP型(データグラム型)の両方の使い方ができる
@@ -40,9 +42,10 @@ func main() {
 	// Unixドメインソケット版のHTTPサーバー
 	/*
 		path := filepath.Join(os.TempDir(), "unixdomainsocket-sample")
-		// 存在しなかったらしなかったで問題ない
-		_ = os.Remove(path)
-		listener, err := net.Listen("unix", path)
+		// 前回のソケットファイルが残っているとnet.Listen()は失敗するが、_ = os.Remove(path)で消してしまうと同じパスで動いている別のサーバーのソケットを奪ってしまう
+		// unixsock.Listen()は接続してみて応答がなければ残骸として削除し、応答があればエラーにする。Close()でソケットファイルも削除される
+		// "@unixdomainsocket-sample"のように@で始めるとLinuxの抽象名前空間になり、ファイル自体が作られない
+		listener, err := unixsock.Listen("unix", path)
 		if err != nil {
 			panic(err)
 		}
@@ -112,12 +115,67 @@ func main() {
 		fmt.Println(string(dump))
 	*/
 
+	// SOCK_SEQPACKET型のUnixドメインソケット(サーバー)
+	// ストリーム型と同じくAccept()で接続を受け付けるが、データグラム型と同じくメッセージの境界が保たれるので、1回のRead()で1つのメッセージが読める
+	// 順序の保証と再送はカーネルが行うので、ローカルのRPCに向いている
+	// メッセージの組み立てや切り詰めの検出はunixsockパッケージのSeqPacketConnにまとめてある
+	/*
+		path := filepath.Join(os.TempDir(), "unixdomainsocket-seqpacket")
+		fmt.Println("Server is running at " + path)
+		listener, err := unixsock.ListenSeqPacket(path)
+		if err != nil {
+			panic(err)
+		}
+		defer func() {
+			if err := listener.Close(); err != nil {
+				panic(err)
+			}
+		}()
+		for {
+			conn, err := listener.AcceptSeqPacket()
+			if err != nil {
+				panic(err)
+			}
+			go func() {
+				for {
+					message, err := conn.ReadMessage()
+					if err != nil {
+						return
+					}
+					fmt.Printf("Received from %v: %v\n", conn.RemoteAddr(), string(message))
+					if err := conn.WriteMessage([]byte("Hello from Server")); err != nil {
+						panic(err)
+					}
+				}
+			}()
+		}
+	*/
+
+	// クライアント
+	// データグラム型と違ってコネクションを張るので、クライアント側でソケットファイルを用意しなくても返信を受け取れる
+	/*
+		conn, err := unixsock.DialSeqPacket(filepath.Join(os.TempDir(), "unixdomainsocket-seqpacket"))
+		if err != nil {
+			panic(err)
+		}
+		defer func() {
+			if err := conn.Close(); err != nil {
+				panic(err)
+			}
+		}()
+		fmt.Println("Sending to Server")
+		response, err := conn.Call([]byte("Hello from Client"))
+		if err != nil {
+			panic(err)
+		}
+		fmt.Printf("Received: %s\n", string(response))
+	*/
+
 	// データグラム型のUnixドメインソケット(サーバー)
 	/*
 		path := filepath.Join(os.TempDir(), "unixdomainsocket-server")
-		_ = os.Remove(path)
 		fmt.Println("Server is running at " + path)
-		conn, err := net.ListenPacket("unixgram", path)
+		conn, err := unixsock.ListenPacket("unixgram", path)
 		if err != nil {
 			panic(err)
 		}
@@ -144,9 +202,9 @@ func main() {
 	// サーバー側のconn.ReadFrom()呼び出しで取得できるアドレスがnilになってしまうため。net.Dial()で開いたソケットは一方的な送信用でアドレスと結び付けられていないので。
 	// 解決方法はクライアント側もサーバー側と同じく、初期化を行い、net.PacketConnインターフェースのWriteTo()メソッド、ReadFrom()メソッドを使って送受信する
 	// 送信を自分の受信用のソケットファイルを持っているソケットから実行すれば、サーバーのReadFrom()で返信可能なアドレスが得られる
+	// UDPと同じく返信が失われるとReadFrom()でブロックし続けるので、確実にやりとりしたい場合はdgramrpcパッケージを使う
 	clientPath := filepath.Join(os.TempDir(), "unixdomainsocket-client")
-	_ = os.Remove(clientPath)
-	conn, err := net.ListenPacket("unixgram", clientPath)
+	conn, err := unixsock.ListenPacket("unixgram", clientPath)
 	if err != nil {
 		panic(err)
 	}
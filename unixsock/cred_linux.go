@@ -0,0 +1,296 @@
+//go:build linux
+// +build linux
+
+package unixsock
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// 接続相手のプロセスの資格情報
+// カーネルが設定する値なので、相手のプロセスが詐称することはできない
+type Cred struct {
+	Pid int32
+	Uid uint32
+	Gid uint32
+
+	// SO_PEERGROUPSで取得した補助グループ(peerGroupsがfalseなら未取得)
+	groups     []uint32
+	peerGroups bool
+}
+
+var ErrNoCredentials = errors.New("unixsock: no credentials in message")
+
+func (c *Cred) String() string {
+	return fmt.Sprintf("pid=%d uid=%d gid=%d", c.Pid, c.Uid, c.Gid)
+}
+
+// 相手のプロセスの補助グループ
+// SO_PEERCREDで得られるのはプライマリグループだけなので、表示や記録のために補助グループも知りたい場合に使う
+// PeerCred()でSO_PEERGROUPS(Linux 4.13以降)が使えた場合は、その値(相手がconnect()した時点のもの)を返す
+// 使えなかった場合は/proc/<pid>/statusから読み込むが、これは参考程度の値でしかない
+// 読む時点で相手のプロセスが終了し、同じpidが別のプロセスに再利用されていれば、そのプロセスのグループが返る
+// そのためPolicyは/procから読んだグループを使わない
+func (c *Cred) Groups() ([]uint32, error) {
+	if c.peerGroups {
+		return c.groups, nil
+	}
+	file, err := os.Open(fmt.Sprintf("/proc/%d/status", c.Pid))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "Groups:") {
+			continue
+		}
+		var groups []uint32
+		for _, field := range strings.Fields(strings.TrimPrefix(line, "Groups:")) {
+			gid, err := strconv.ParseUint(field, 10, 32)
+			if err != nil {
+				return nil, err
+			}
+			groups = append(groups, uint32(gid))
+		}
+		return groups, nil
+	}
+	return nil, scanner.Err()
+}
+
+func credFromUcred(ucred *unix.Ucred) *Cred {
+	return &Cred{Pid: ucred.Pid, Uid: ucred.Uid, Gid: ucred.Gid}
+}
+
+// ストリーム型(とSOCK_SEQPACKET)の接続相手の資格情報をSO_PEERCREDで取得する
+// 値は相手がconnect()した時点のもの
+func PeerCred(conn *net.UnixConn) (*Cred, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	var ucred *unix.Ucred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		ucred, credErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	}); err != nil {
+		return nil, err
+	}
+	if credErr != nil {
+		return nil, os.NewSyscallError("getsockopt", credErr)
+	}
+	cred := credFromUcred(ucred)
+	if err := raw.Control(func(fd uintptr) {
+		cred.groups, credErr = getsockoptPeerGroups(int(fd))
+	}); err != nil {
+		return nil, err
+	}
+	switch {
+	case credErr == nil:
+		cred.peerGroups = true
+	case credErr != unix.ENOPROTOOPT:
+		// ENOPROTOOPTは古いカーネルなので、Groups()は/procから読む
+		return nil, os.NewSyscallError("getsockopt", credErr)
+	}
+	return cred, nil
+}
+
+// SO_PEERGROUPSで相手の補助グループを取得する
+// x/sys/unixにはこのための関数がないので、getsockopt(2)を直接呼ぶ
+// バッファが足りなければERANGEと必要な大きさが返るので、広げて呼び直す
+func getsockoptPeerGroups(fd int) ([]uint32, error) {
+	groups := make([]uint32, 16)
+	for {
+		size := uint32(len(groups) * 4)
+		_, _, errno := unix.Syscall6(unix.SYS_GETSOCKOPT, uintptr(fd), unix.SOL_SOCKET, unix.SO_PEERGROUPS,
+			uintptr(unsafe.Pointer(&groups[0])), uintptr(unsafe.Pointer(&size)), 0)
+		switch {
+		case errno == unix.ERANGE && int(size/4) > len(groups):
+			groups = make([]uint32, size/4)
+		case errno != 0:
+			return nil, errno
+		default:
+			return groups[:size/4], nil
+		}
+	}
+}
+
+// 接続を許可する相手
+// UIDsとGIDsの両方が空の場合は全て許可し、どちらかに一致すれば許可する
+// GIDsは相手のプライマリグループと、SO_PEERGROUPSで取得できた場合は補助グループとも照合する
+// SO_PEERGROUPSがない古いカーネルでは、補助グループは相手が入れ替われる/procからしか読めないので、プライマリグループだけで判断する
+type Policy struct {
+	UIDs []uint32
+	GIDs []uint32
+}
+
+func (p *Policy) Allow(cred *Cred) bool {
+	if len(p.UIDs) == 0 && len(p.GIDs) == 0 {
+		return true
+	}
+	for _, uid := range p.UIDs {
+		if cred.Uid == uid {
+			return true
+		}
+	}
+	if len(p.GIDs) == 0 {
+		return false
+	}
+	for _, gid := range p.GIDs {
+		if cred.Gid == gid {
+			return true
+		}
+	}
+	if !cred.peerGroups {
+		return false
+	}
+	for _, gid := range p.GIDs {
+		for _, group := range cred.groups {
+			if group == gid {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// 資格情報付きのコネクション
+type Conn struct {
+	*net.UnixConn
+	Cred *Cred
+}
+
+// Accept()で相手の資格情報を取得し、Policyで許可されない相手との接続はその場で閉じるリスナー
+// net.Listenerを満たすので、そのままhttp.Server.Serve()に渡せる
+type Listener struct {
+	*net.UnixListener
+	Policy Policy
+	// 拒否した接続を記録したい場合に設定する
+	OnReject func(cred *Cred)
+}
+
+func NewListener(listener *net.UnixListener, policy Policy) *Listener {
+	return &Listener{UnixListener: listener, Policy: policy}
+}
+
+func (l *Listener) Accept() (net.Conn, error) {
+	return l.AcceptCred()
+}
+
+func (l *Listener) AcceptCred() (*Conn, error) {
+	for {
+		conn, err := l.AcceptUnix()
+		if err != nil {
+			return nil, err
+		}
+		cred, err := PeerCred(conn)
+		if err != nil {
+			_ = conn.Close()
+			continue
+		}
+		if !l.Policy.Allow(cred) {
+			if l.OnReject != nil {
+				l.OnReject(cred)
+			}
+			_ = conn.Close()
+			continue
+		}
+		return &Conn{UnixConn: conn, Cred: cred}, nil
+	}
+}
+
+// 許可された接続ごとにgoroutineでhandlerを呼ぶ
+func Serve(listener *Listener, handler func(conn *Conn)) error {
+	for {
+		conn, err := listener.AcceptCred()
+		if err != nil {
+			return err
+		}
+		go handler(conn)
+	}
+}
+
+type credContextKey struct{}
+
+// http.Server.ConnContextに設定すると、ハンドラでCredFromContext(request.Context())として相手の資格情報が取り出せる
+func ConnContext(ctx context.Context, conn net.Conn) context.Context {
+	if c, ok := conn.(*Conn); ok {
+		return context.WithValue(ctx, credContextKey{}, c.Cred)
+	}
+	return ctx
+}
+
+func CredFromContext(ctx context.Context) (*Cred, bool) {
+	cred, ok := ctx.Value(credContextKey{}).(*Cred)
+	return cred, ok
+}
+
+// 受信側のソケットでSO_PASSCREDを有効にすると、データグラムごとに送信元の資格情報(SCM_CREDENTIALS)が付いてくる
+func SetPassCred(conn *net.UnixConn, enable bool) error {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	value := 0
+	if enable {
+		value = 1
+	}
+	var optErr error
+	if err := raw.Control(func(fd uintptr) {
+		optErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_PASSCRED, value)
+	}); err != nil {
+		return err
+	}
+	return os.NewSyscallError("setsockopt", optErr)
+}
+
+// 自分の資格情報を補助データ(SCM_CREDENTIALS)として付けて送信する
+// 自分以外のpid/uid/gidを名乗るにはCAP_SYS_ADMINなどの権限が必要で、カーネルが検証する
+// 補助データ付きの送信はWriteTo()と同じ扱いなので、net.DialUnix()で接続済みのソケットではなくnet.ListenUnixgram()で作ったソケットから送る
+func WriteMsgWithCred(conn *net.UnixConn, b []byte, addr *net.UnixAddr) (int, error) {
+	oob := unix.UnixCredentials(&unix.Ucred{
+		Pid: int32(os.Getpid()),
+		Uid: uint32(os.Getuid()),
+		Gid: uint32(os.Getgid()),
+	})
+	n, _, err := conn.WriteMsgUnix(b, oob, addr)
+	return n, err
+}
+
+// データグラムを受信し、付いてきた送信元の資格情報を取り出す
+// 受信側であらかじめSetPassCred(conn, true)を呼んでおく必要がある
+func ReadMsgWithCred(conn *net.UnixConn, b []byte) (int, *net.UnixAddr, *Cred, error) {
+	oob := make([]byte, unix.CmsgSpace(unix.SizeofUcred))
+	n, oobn, _, addr, err := conn.ReadMsgUnix(b, oob)
+	if err != nil {
+		return n, addr, nil, err
+	}
+	messages, err := unix.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		return n, addr, nil, err
+	}
+	for i := range messages {
+		if messages[i].Header.Level != unix.SOL_SOCKET || messages[i].Header.Type != unix.SCM_CREDENTIALS {
+			continue
+		}
+		ucred, err := unix.ParseUnixCredentials(&messages[i])
+		if err != nil {
+			return n, addr, nil, err
+		}
+		return n, addr, credFromUcred(ucred), nil
+	}
+	return n, addr, nil, ErrNoCredentials
+}
@@ -0,0 +1,208 @@
+//go:build linux
+// +build linux
+
+package unixsock
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPeerCred(t *testing.T) {
+	path, cleanup := tempSocketPath(t, "cred.sock")
+	defer cleanup()
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	allowed := NewListener(listener, Policy{UIDs: []uint32{uint32(os.Getuid())}})
+	accepted := make(chan *Conn, 1)
+	go func() {
+		conn, err := allowed.AcceptCred()
+		if err != nil {
+			close(accepted)
+			return
+		}
+		accepted <- conn
+	}()
+	client, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	conn, ok := <-accepted
+	if !ok {
+		t.Fatal("accept failed")
+	}
+	defer conn.Close()
+	if conn.Cred.Pid != int32(os.Getpid()) || conn.Cred.Uid != uint32(os.Getuid()) || conn.Cred.Gid != uint32(os.Getgid()) {
+		t.Errorf("cred = %v", conn.Cred)
+	}
+	groups, err := conn.Cred.Groups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.Getgroups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(groups) != fmt.Sprint(want) {
+		t.Errorf("groups = %v, want %v", groups, want)
+	}
+}
+
+func TestPolicyGroups(t *testing.T) {
+	policy := Policy{GIDs: []uint32{100}}
+	tests := []struct {
+		cred *Cred
+		want bool
+	}{
+		{&Cred{Gid: 100, peerGroups: true}, true},
+		{&Cred{Gid: 1, groups: []uint32{10, 100}, peerGroups: true}, true},
+		{&Cred{Gid: 1, groups: []uint32{10}, peerGroups: true}, false},
+		// SO_PEERGROUPSで取得できなかった補助グループは使わない
+		{&Cred{Pid: -1, Gid: 1}, false},
+		{&Cred{Gid: 100}, true},
+	}
+	for _, tt := range tests {
+		if got := policy.Allow(tt.cred); got != tt.want {
+			t.Errorf("Allow(gid=%d groups=%v) = %v, want %v", tt.cred.Gid, tt.cred.groups, got, tt.want)
+		}
+	}
+
+	// /proc/<pid>/statusから補助グループが読める場合でも、それでは許可しない
+	groups, err := os.Getgroups()
+	if err != nil || len(groups) == 0 {
+		return
+	}
+	cred := &Cred{Pid: int32(os.Getpid()), Gid: uint32(groups[0]) + 1}
+	if supplementary, err := cred.Groups(); err != nil || len(supplementary) == 0 {
+		t.Fatalf("Groups() = %v, %v", supplementary, err)
+	}
+	if (&Policy{GIDs: []uint32{uint32(groups[0])}}).Allow(cred) {
+		t.Error("allowed by groups read from /proc")
+	}
+}
+
+func TestPolicyReject(t *testing.T) {
+	path, cleanup := tempSocketPath(t, "reject.sock")
+	defer cleanup()
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rejected := make(chan *Cred, 1)
+	denied := NewListener(listener, Policy{UIDs: []uint32{uint32(os.Getuid()) + 1}})
+	denied.OnReject = func(cred *Cred) {
+		rejected <- cred
+	}
+	go func() {
+		_ = Serve(denied, func(conn *Conn) {
+			t.Errorf("connection from %v was accepted", conn.Cred)
+		})
+	}()
+	defer denied.Close()
+
+	client, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if cred := <-rejected; cred.Pid != int32(os.Getpid()) {
+		t.Errorf("rejected pid = %d", cred.Pid)
+	}
+	if _, err := client.Read(make([]byte, 1)); err == nil {
+		t.Error("rejected connection is still open")
+	}
+}
+
+func TestConnContext(t *testing.T) {
+	path, cleanup := tempSocketPath(t, "http.sock")
+	defer cleanup()
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{
+		ConnContext: ConnContext,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cred, ok := CredFromContext(r.Context())
+			if !ok {
+				http.Error(w, "no credentials", http.StatusForbidden)
+				return
+			}
+			fmt.Fprintf(w, "%d", cred.Uid)
+		}),
+	}
+	go func() {
+		_ = server.Serve(NewListener(listener, Policy{}))
+	}()
+	defer server.Shutdown(context.Background())
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	request, err := http.NewRequest("GET", "http://localhost/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := request.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+	response, err := http.ReadResponse(bufio.NewReader(conn), request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != fmt.Sprint(os.Getuid()) {
+		t.Errorf("status %s, body %q", response.Status, body)
+	}
+}
+
+func TestCredentialsMessage(t *testing.T) {
+	serverPath, cleanup := tempSocketPath(t, "server.sock")
+	defer cleanup()
+	server, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: serverPath, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	if err := SetPassCred(server, true); err != nil {
+		t.Fatal(err)
+	}
+	// unix.goのデータグラム型の例と同じく、クライアント側も自分のソケットファイルを持つ
+	client, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: filepath.Join(filepath.Dir(serverPath), "client.sock"), Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if _, err := WriteMsgWithCred(client, []byte("Hello from Client"), server.LocalAddr().(*net.UnixAddr)); err != nil {
+		t.Fatal(err)
+	}
+	buffer := make([]byte, 1500)
+	n, _, cred, err := ReadMsgWithCred(server, buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buffer[:n]) != "Hello from Client" {
+		t.Errorf("message = %q", buffer[:n])
+	}
+	if cred.Pid != int32(os.Getpid()) || cred.Uid != uint32(os.Getuid()) {
+		t.Errorf("cred = %v", cred)
+	}
+}
@@ -0,0 +1,3 @@
+// unixsockパッケージはUnixドメインソケットを単なる高速な通信路としてではなく、カーネル内で完結していることを活かして使うための機能をまとめたもの
+// 接続相手のプロセスの資格情報(pid/uid/gid)の取得や、ソケットを通じたファイルディスクリプタの受け渡しなどは、TCPやUDPではできない
+package unixsock
@@ -0,0 +1,194 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package unixsock
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// 1つのメッセージで渡せるファイルディスクリプタの数の上限(LinuxのSCM_MAX_FD)
+const MaxFiles = 253
+
+// ファイル名を送るペイロードの上限
+const maxNamesSize = 64 * 1024
+
+var ErrTruncated = errors.New("unixsock: control message truncated")
+
+// ファイルディスクリプタを補助データ(SCM_RIGHTS)として送る
+// 受け取った側には同じオープンファイル(ファイルオフセットやソケットの状態も共有)を指す新しいディスクリプタが作られる
+// 送ったあとのfilesは送信側で閉じてもよく、受信側のディスクリプタはそのまま使える
+// 受信側でos.Fileの名前を復元できるように、本体には名前の一覧を長さ付きで送る
+func SendFiles(conn *net.UnixConn, files ...*os.File) error {
+	if len(files) == 0 || len(files) > MaxFiles {
+		return fmt.Errorf("unixsock: cannot send %d files", len(files))
+	}
+	fds := make([]int, len(files))
+	names := make([]string, len(files))
+	for i, file := range files {
+		fds[i] = int(file.Fd())
+		names[i] = file.Name()
+	}
+	joined := strings.Join(names, "\x00")
+	if len(joined) > maxNamesSize {
+		return errors.New("unixsock: file names too long")
+	}
+	payload := make([]byte, 4+len(joined))
+	binary.BigEndian.PutUint32(payload, uint32(len(joined)))
+	copy(payload[4:], joined)
+	n, _, err := conn.WriteMsgUnix(payload, syscall.UnixRights(fds...), nil)
+	if err != nil {
+		return err
+	}
+	if n != len(payload) {
+		return io.ErrShortWrite
+	}
+	return nil
+}
+
+// SendFiles()で送られたファイルを受け取る
+// ストリーム型のソケットでも使えるが、ファイルの受け渡し以外のデータと混ぜる場合は、メッセージの境界が保たれるunixgramかunixpacketを使う方が安全
+func RecvFiles(conn *net.UnixConn) ([]*os.File, error) {
+	payload := make([]byte, 4+maxNamesSize)
+	oob := make([]byte, syscall.CmsgSpace(MaxFiles*4))
+	n, oobn, flags, _, err := conn.ReadMsgUnix(payload, oob)
+	if err != nil {
+		return nil, err
+	}
+	fds, err := parseRights(oob[:oobn])
+	if err != nil {
+		return nil, err
+	}
+	files := make([]*os.File, len(fds))
+	closeAll := func() {
+		for _, fd := range fds {
+			_ = syscall.Close(fd)
+		}
+	}
+	if flags&syscall.MSG_CTRUNC != 0 {
+		closeAll()
+		return nil, ErrTruncated
+	}
+	if len(fds) == 0 {
+		return nil, errors.New("unixsock: no file descriptors in message")
+	}
+	if n < 4 {
+		closeAll()
+		return nil, io.ErrUnexpectedEOF
+	}
+	size := int(binary.BigEndian.Uint32(payload))
+	if size > maxNamesSize {
+		closeAll()
+		return nil, errors.New("unixsock: file names too long")
+	}
+	// ストリーム型では名前の途中で読み込みが分かれることがある
+	if n < 4+size {
+		if _, err := io.ReadFull(conn, payload[n:4+size]); err != nil {
+			closeAll()
+			return nil, err
+		}
+	}
+	names := strings.Split(string(payload[4:4+size]), "\x00")
+	for i, fd := range fds {
+		// 子プロセスに意図せず引き継がれないようにする
+		syscall.CloseOnExec(fd)
+		name := ""
+		if i < len(names) {
+			name = names[i]
+		}
+		files[i] = os.NewFile(uintptr(fd), name)
+	}
+	return files, nil
+}
+
+func parseRights(oob []byte) ([]int, error) {
+	messages, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return nil, err
+	}
+	var fds []int
+	for i := range messages {
+		if messages[i].Header.Level != syscall.SOL_SOCKET || messages[i].Header.Type != syscall.SCM_RIGHTS {
+			continue
+		}
+		rights, err := syscall.ParseUnixRights(&messages[i])
+		if err != nil {
+			return nil, err
+		}
+		fds = append(fds, rights...)
+	}
+	return fds, nil
+}
+
+// File()を持つリスナーやコネクション(*net.TCPListener, *net.UnixConnなど)
+type filer interface {
+	File() (*os.File, error)
+}
+
+func sendFiler(conn *net.UnixConn, v interface{}) error {
+	f, ok := v.(filer)
+	if !ok {
+		return fmt.Errorf("unixsock: %T has no file descriptor", v)
+	}
+	// File()は複製したディスクリプタを返すので、送ったら閉じる
+	file, err := f.File()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	return SendFiles(conn, file)
+}
+
+func recvFile(conn *net.UnixConn) (*os.File, error) {
+	files, err := RecvFiles(conn)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files[1:] {
+		_ = file.Close()
+	}
+	return files[0], nil
+}
+
+// 待ち受け中のリスナーを別のプロセスに渡す
+// 受け取った側でも同じポート(ソケットファイル)でAccept()できるので、グレースフルリスタートやワーカーへの振り分けに使える
+// *net.UnixListenerを渡したあとに送信側で閉じる場合は、ソケットファイルが削除されないようにSetUnlinkOnClose(false)しておく
+func SendListener(conn *net.UnixConn, listener net.Listener) error {
+	return sendFiler(conn, listener)
+}
+
+func RecvListener(conn *net.UnixConn) (net.Listener, error) {
+	file, err := recvFile(conn)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	return net.FileListener(file)
+}
+
+// 確立済みのコネクションを別のプロセスに渡す
+func SendConn(conn *net.UnixConn, c net.Conn) error {
+	return sendFiler(conn, c)
+}
+
+func RecvConn(conn *net.UnixConn) (net.Conn, error) {
+	file, err := recvFile(conn)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	return net.FileConn(file)
+}
@@ -0,0 +1,154 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package unixsock
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+// socketpair(2)で作った、つながったUnixドメインソケットの組
+func socketPair(t *testing.T) (*net.UnixConn, *os.File) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	local := os.NewFile(uintptr(fds[0]), "local")
+	defer local.Close()
+	conn, err := net.FileConn(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn.(*net.UnixConn), os.NewFile(uintptr(fds[1]), "remote")
+}
+
+func TestSendFiles(t *testing.T) {
+	sender, remote := socketPair(t)
+	defer sender.Close()
+	receiverConn, err := net.FileConn(remote)
+	remote.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiver := receiverConn.(*net.UnixConn)
+	defer receiver.Close()
+
+	file, err := ioutil.TempFile("", "unixsock-fd-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.WriteString("log line\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SendFiles(sender, file, os.Stdin); err != nil {
+		t.Fatal(err)
+	}
+	// 送信側で閉じても受信側のディスクリプタは有効
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+	files, err := RecvFiles(receiver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files[0].Name() != file.Name() {
+		t.Fatalf("received %v", files)
+	}
+	// ファイルオフセットも共有しているので先頭に戻してから読む
+	if _, err := files[0].Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadAll(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "log line\n" {
+		t.Errorf("content = %q", content)
+	}
+	for _, f := range files {
+		_ = f.Close()
+	}
+}
+
+// リスナーを子プロセスに渡し、子プロセスがリクエストを処理できることを確かめる
+// 子プロセスとしてはこのテストバイナリ自身をTestHelperProcessだけ実行するように起動する
+func TestPassListenerToChild(t *testing.T) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	supervisor, remote := socketPair(t)
+	defer supervisor.Close()
+
+	cmd := exec.Command(os.Args[0], "-test.run=TestHelperProcess")
+	cmd.Env = append(os.Environ(), "UNIXSOCK_HELPER_PROCESS=1")
+	// 子プロセスではディスクリプタ3番になる
+	cmd.ExtraFiles = []*os.File{remote}
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	remote.Close()
+	defer func() {
+		// ソケットを閉じると子プロセスは終了する
+		supervisor.Close()
+		if err := cmd.Wait(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	if err := SendListener(supervisor, listener); err != nil {
+		t.Fatal(err)
+	}
+	// 自分の側のリスナーを閉じても、子プロセスが待ち受けを続ける
+	address := listener.Addr().String()
+	if err := listener.Close(); err != nil {
+		t.Fatal(err)
+	}
+	response, err := http.Get("http://" + address + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != strconv.Itoa(cmd.Process.Pid) {
+		t.Errorf("served by %q, want child pid %d", body, cmd.Process.Pid)
+	}
+}
+
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("UNIXSOCK_HELPER_PROCESS") != "1" {
+		return
+	}
+	file := os.NewFile(3, "supervisor")
+	conn, err := net.FileConn(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	supervisor := conn.(*net.UnixConn)
+	listener, err := RecvListener(supervisor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		_ = http.Serve(listener, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Connection", "close")
+			fmt.Fprint(w, os.Getpid())
+		}))
+	}()
+	// 親プロセスがソケットを閉じるまで待つ
+	_, _ = supervisor.Read(make([]byte, 1))
+	os.Exit(0)
+}
@@ -0,0 +1,320 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package unixsock
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// 他のプロセスが使用中のソケットファイルを検出した
+var ErrAddrInUse = errors.New("unixsock: socket is in use by a running server")
+
+// ソケットファイルの作り方
+// _ = os.Remove(path)してから待ち受けると、同じパスで動いている別のサーバーのソケットを黙って奪ってしまう
+// ここでは次の手順で安全に待ち受ける
+//  1. path + ".lock"をflock(2)でロックし、同じ仕組みで起動した別のインスタンスと排他する
+//  2. ソケットファイルが残っていたら接続してみて、応答があれば使用中としてエラーにし、ECONNREFUSEDなら残骸として削除する
+//  3. Modeで許していないビットをumaskに加えてbind(2)し、ソケットファイルが作られた瞬間からModeより広いパーミッションにならないようにする
+//  4. 待ち受けを始めてから、パーミッションと所有者を設定する
+//
+// Close()するとソケットファイルとロックファイルを削除する
+// "@name"の形のパスはLinuxの抽象名前空間のアドレスになり、ファイルを作らないのでこれらの処理は不要
+type ListenConfig struct {
+	// ソケットファイルのパーミッション(0の場合はumaskに従ったまま)
+	// umaskはプロセス全体の設定なので、bind(2)している間に他のgoroutineが作ったファイルにも狭めたumaskが適用される
+	Mode os.FileMode
+	// ソケットファイルの所有者のユーザー名とグループ名(数値のIDでも良い)。空の場合は変更しない
+	// 所有者は待ち受けを始めてから変更するので、それまでの間はModeで許したユーザーが接続できる
+	// 変更後のユーザーやグループだけに接続を許したい場合は、Modeも0600や0660のように指定する
+	User  string
+	Group string
+	// 残っているソケットファイルに接続して確認するときのタイムアウト
+	ProbeTimeout time.Duration
+}
+
+func Listen(network, path string) (*ManagedListener, error) {
+	var lc ListenConfig
+	return lc.Listen(network, path)
+}
+
+func ListenPacket(network, path string) (*ManagedPacketConn, error) {
+	var lc ListenConfig
+	return lc.ListenPacket(network, path)
+}
+
+// Close()でソケットファイルとロックファイルを削除するリスナー
+type ManagedListener struct {
+	*net.UnixListener
+	socket *socketFile
+}
+
+func (l *ManagedListener) Close() error {
+	err := l.UnixListener.Close()
+	if cleanupErr := l.socket.cleanup(); err == nil {
+		err = cleanupErr
+	}
+	return err
+}
+
+// Close()でソケットファイルとロックファイルを削除するデータグラム型のソケット
+type ManagedPacketConn struct {
+	*net.UnixConn
+	socket *socketFile
+}
+
+func (c *ManagedPacketConn) Close() error {
+	err := c.UnixConn.Close()
+	if cleanupErr := c.socket.cleanup(); err == nil {
+		err = cleanupErr
+	}
+	return err
+}
+
+// ストリーム型("unix")とSOCK_SEQPACKET型("unixpacket")で待ち受ける
+func (lc *ListenConfig) Listen(network, path string) (*ManagedListener, error) {
+	if network != "unix" && network != "unixpacket" {
+		return nil, fmt.Errorf("unixsock: unsupported network %q", network)
+	}
+	socket, err := lc.prepare(network, path)
+	if err != nil {
+		return nil, err
+	}
+	var listener *net.UnixListener
+	err = lc.bind(path, func() (err error) {
+		listener, err = net.ListenUnix(network, &net.UnixAddr{Name: path, Net: network})
+		return err
+	})
+	if err != nil {
+		_ = socket.unlock()
+		return nil, err
+	}
+	// 削除はロックを解放する前に自分で行う
+	listener.SetUnlinkOnClose(false)
+	socket.created = true
+	if err := lc.setPermission(path); err != nil {
+		_ = listener.Close()
+		_ = socket.cleanup()
+		return nil, err
+	}
+	return &ManagedListener{UnixListener: listener, socket: socket}, nil
+}
+
+// データグラム型("unixgram")で待ち受ける
+func (lc *ListenConfig) ListenPacket(network, path string) (*ManagedPacketConn, error) {
+	if network != "unixgram" {
+		return nil, fmt.Errorf("unixsock: unsupported network %q", network)
+	}
+	socket, err := lc.prepare(network, path)
+	if err != nil {
+		return nil, err
+	}
+	var conn *net.UnixConn
+	err = lc.bind(path, func() (err error) {
+		conn, err = net.ListenUnixgram(network, &net.UnixAddr{Name: path, Net: network})
+		return err
+	})
+	if err != nil {
+		_ = socket.unlock()
+		return nil, err
+	}
+	socket.created = true
+	if err := lc.setPermission(path); err != nil {
+		_ = conn.Close()
+		_ = socket.cleanup()
+		return nil, err
+	}
+	return &ManagedPacketConn{UnixConn: conn, socket: socket}, nil
+}
+
+func isAbstract(path string) bool {
+	return strings.HasPrefix(path, "@")
+}
+
+// 待ち受けているソケットファイルとそのロック
+type socketFile struct {
+	path    string
+	lock    *os.File
+	created bool
+}
+
+func (s *socketFile) unlock() error {
+	if s.lock == nil {
+		return nil
+	}
+	// ロックしている間に削除するので、次に起動したインスタンスが古いロックファイルをつかむことはない
+	_ = os.Remove(s.lock.Name())
+	err := s.lock.Close()
+	s.lock = nil
+	return err
+}
+
+func (s *socketFile) cleanup() error {
+	var err error
+	if s.created && !isAbstract(s.path) {
+		if removeErr := os.Remove(s.path); removeErr != nil && !os.IsNotExist(removeErr) {
+			err = removeErr
+		}
+		s.created = false
+	}
+	if unlockErr := s.unlock(); err == nil {
+		err = unlockErr
+	}
+	return err
+}
+
+func (lc *ListenConfig) prepare(network, path string) (*socketFile, error) {
+	socket := &socketFile{path: path}
+	if isAbstract(path) {
+		if runtime.GOOS != "linux" {
+			return nil, fmt.Errorf("unixsock: abstract socket address %q is only supported on Linux", path)
+		}
+		return socket, nil
+	}
+	lock, err := lockFile(path + ".lock")
+	if err != nil {
+		return nil, err
+	}
+	socket.lock = lock
+	if err := lc.removeStale(network, path); err != nil {
+		_ = socket.unlock()
+		return nil, err
+	}
+	return socket, nil
+}
+
+func lockFile(path string) (*os.File, error) {
+	for {
+		file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, err
+		}
+		if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+			_ = file.Close()
+			if err == syscall.EWOULDBLOCK {
+				return nil, ErrAddrInUse
+			}
+			return nil, os.NewSyscallError("flock", err)
+		}
+		// ロックを取る間に前の持ち主がファイルを削除していたら、新しく作り直す
+		info, err := file.Stat()
+		if err != nil {
+			_ = file.Close()
+			return nil, err
+		}
+		current, err := os.Stat(path)
+		if err == nil && os.SameFile(info, current) {
+			return file, nil
+		}
+		_ = file.Close()
+	}
+}
+
+// 残っているソケットファイルが使われているかを確かめ、使われていなければ削除する
+func (lc *ListenConfig) removeStale(network, path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// ソケット以外のファイルを間違って消さないようにする
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("unixsock: %s exists and is not a socket", path)
+	}
+	timeout := lc.ProbeTimeout
+	if timeout <= 0 {
+		timeout = time.Second
+	}
+	conn, err := net.DialTimeout(network, path, timeout)
+	if err == nil {
+		_ = conn.Close()
+		return ErrAddrInUse
+	}
+	// 誰も待ち受けていないソケットファイルへの接続はECONNREFUSEDになる
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// umaskを書き換えている間に、別のbindが元に戻してしまわないようにする
+var umaskMutex sync.Mutex
+
+// Modeで許していないビットをumaskに加えてlistenを呼ぶ
+func (lc *ListenConfig) bind(path string, listen func() error) error {
+	if lc.Mode == 0 || isAbstract(path) {
+		return listen()
+	}
+	umaskMutex.Lock()
+	defer umaskMutex.Unlock()
+	old := syscall.Umask(0777)
+	defer syscall.Umask(old)
+	syscall.Umask(old | int(0777&^lc.Mode.Perm()))
+	return listen()
+}
+
+func (lc *ListenConfig) setPermission(path string) error {
+	if isAbstract(path) {
+		return nil
+	}
+	if lc.Mode != 0 {
+		if err := os.Chmod(path, lc.Mode); err != nil {
+			return err
+		}
+	}
+	if lc.User == "" && lc.Group == "" {
+		return nil
+	}
+	uid, gid := -1, -1
+	if lc.User != "" {
+		id, err := lookupID(lc.User, func(name string) (string, error) {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return "", err
+			}
+			return u.Uid, nil
+		})
+		if err != nil {
+			return err
+		}
+		uid = id
+	}
+	if lc.Group != "" {
+		id, err := lookupID(lc.Group, func(name string) (string, error) {
+			g, err := user.LookupGroup(name)
+			if err != nil {
+				return "", err
+			}
+			return g.Gid, nil
+		})
+		if err != nil {
+			return err
+		}
+		gid = id
+	}
+	return os.Lchown(path, uid, gid)
+}
+
+// 数値ならそのままIDとして、そうでなければ名前として引く
+func lookupID(name string, lookup func(string) (string, error)) (int, error) {
+	if id, err := strconv.Atoi(name); err == nil {
+		return id, nil
+	}
+	id, err := lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(id)
+}
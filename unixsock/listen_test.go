@@ -0,0 +1,151 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package unixsock
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"runtime"
+	"syscall"
+	"testing"
+)
+
+func TestListenRefusesLiveSocket(t *testing.T) {
+	path, cleanup := tempSocketPath(t, "live.sock")
+	defer cleanup()
+	// ロックファイルを使わない別のサーバーが待ち受けている
+	other, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	if _, err := Listen("unix", path); err != ErrAddrInUse {
+		t.Fatalf("err = %v, want %v", err, ErrAddrInUse)
+	}
+	// 奪われずにまだ接続できる
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+}
+
+func TestListenLock(t *testing.T) {
+	path, cleanup := tempSocketPath(t, "lock.sock")
+	defer cleanup()
+	first, err := Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Listen("unix", path); err != ErrAddrInUse {
+		t.Errorf("err = %v, want %v", err, ErrAddrInUse)
+	}
+	if err := first.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{path, path + ".lock"} {
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("%s remains after Close: %v", name, err)
+		}
+	}
+	// 閉じたあとは同じパスで待ち受けられる
+	second, err := Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second.Close()
+}
+
+func TestListenRemovesStaleSocket(t *testing.T) {
+	path, cleanup := tempSocketPath(t, "stale.sock")
+	defer cleanup()
+	// プロセスが異常終了した場合のようにソケットファイルだけを残す
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.SetUnlinkOnClose(false)
+	stale.Close()
+
+	lc := ListenConfig{Mode: 0600}
+	listener, err := lc.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("mode = %v, want 0600", info.Mode().Perm())
+	}
+}
+
+func TestBindNarrowsUmask(t *testing.T) {
+	path, cleanup := tempSocketPath(t, "file")
+	defer cleanup()
+	old := syscall.Umask(022)
+	defer syscall.Umask(old)
+	// bindしている間に作られたファイルは、最初からModeより広いパーミッションにならない
+	lc := ListenConfig{Mode: 0600}
+	err := lc.bind(path, func() error {
+		return ioutil.WriteFile(path, nil, 0666)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("mode = %v, want 0600", info.Mode().Perm())
+	}
+	if umask := syscall.Umask(022); umask != 022 {
+		t.Errorf("umask = %#o, want 022", umask)
+	}
+}
+
+func TestListenRefusesRegularFile(t *testing.T) {
+	path, cleanup := tempSocketPath(t, "regular")
+	defer cleanup()
+	if err := ioutil.WriteFile(path, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Listen("unix", path); err == nil {
+		t.Fatal("listened on a regular file")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("regular file was removed: %v", err)
+	}
+}
+
+func TestListenPacketAbstract(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("abstract namespace is Linux only")
+	}
+	conn, err := ListenPacket("unixgram", "@system-programming-unixsock-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client, err := net.Dial("unixgram", "@system-programming-unixsock-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if _, err := client.Write([]byte("Hello")); err != nil {
+		t.Fatal(err)
+	}
+	buffer := make([]byte, 1500)
+	n, _, err := conn.ReadFrom(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buffer[:n]) != "Hello" {
+		t.Errorf("received %q", buffer[:n])
+	}
+}
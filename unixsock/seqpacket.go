@@ -0,0 +1,123 @@
+//go:build dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build dragonfly freebsd linux netbsd openbsd solaris
+
+package unixsock
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+// SOCK_SEQPACKET型のUnixドメインソケット
+// ストリーム型と同じくコネクションを確立し、順序が保証されて欠落もないが、データグラム型のように送信したメッセージの境界が保たれる
+// 1回のWriteMessage()が相手の1回のReadMessage()に対応するので、長さのヘッダーなどでメッセージを区切る必要がない
+// 長さ0のメッセージは切断(EOF)と区別できないので送れない
+
+// 受信できるメッセージの最大サイズの初期値
+const DefaultMaxMessageSize = 64 * 1024
+
+var (
+	ErrMessageTooLarge = errors.New("unixsock: message too large")
+	ErrEmptyMessage    = errors.New("unixsock: empty message")
+)
+
+type SeqPacketConn struct {
+	*net.UnixConn
+	// これより大きいメッセージを受信するとErrMessageTooLargeになる(超えた分は失われる)
+	MaxMessageSize int
+	buffer         []byte
+}
+
+func newSeqPacketConn(conn *net.UnixConn) *SeqPacketConn {
+	return &SeqPacketConn{UnixConn: conn, MaxMessageSize: DefaultMaxMessageSize}
+}
+
+func DialSeqPacket(path string) (*SeqPacketConn, error) {
+	conn, err := net.DialUnix("unixpacket", nil, &net.UnixAddr{Name: path, Net: "unixpacket"})
+	if err != nil {
+		return nil, err
+	}
+	return newSeqPacketConn(conn), nil
+}
+
+// Close()でソケットファイルを削除する
+type SeqPacketListener struct {
+	*ManagedListener
+}
+
+// 使用中のソケットファイルは奪わず、残骸だけを削除してから待ち受ける(ListenConfigを参照)
+func ListenSeqPacket(path string) (*SeqPacketListener, error) {
+	listener, err := Listen("unixpacket", path)
+	if err != nil {
+		return nil, err
+	}
+	return &SeqPacketListener{ManagedListener: listener}, nil
+}
+
+func (l *SeqPacketListener) AcceptSeqPacket() (*SeqPacketConn, error) {
+	conn, err := l.AcceptUnix()
+	if err != nil {
+		return nil, err
+	}
+	return newSeqPacketConn(conn), nil
+}
+
+// メッセージを1つ受信する
+// 返り値のスライスは次のReadMessage()の呼び出しまで有効
+func (c *SeqPacketConn) ReadMessage() ([]byte, error) {
+	if len(c.buffer) != c.MaxMessageSize {
+		c.buffer = make([]byte, c.MaxMessageSize)
+	}
+	n, _, flags, _, err := c.ReadMsgUnix(c.buffer, nil)
+	if err != nil {
+		return nil, err
+	}
+	// バッファに収まらなかった分は切り捨てられ、MSG_TRUNCフラグが立つ
+	if flags&syscall.MSG_TRUNC != 0 {
+		return nil, ErrMessageTooLarge
+	}
+	return c.buffer[:n], nil
+}
+
+// メッセージを1つ送信する
+// ソケットの送信バッファ(SO_SNDBUF)より大きいメッセージはEMSGSIZEになる
+func (c *SeqPacketConn) WriteMessage(b []byte) error {
+	if len(b) == 0 {
+		return ErrEmptyMessage
+	}
+	_, err := c.Write(b)
+	return err
+}
+
+// リクエストを送ってレスポンスを待つ
+func (c *SeqPacketConn) Call(request []byte) ([]byte, error) {
+	if err := c.WriteMessage(request); err != nil {
+		return nil, err
+	}
+	return c.ReadMessage()
+}
+
+// 接続ごとにgoroutineを起動し、受信したメッセージをhandlerに渡して返り値をレスポンスとして送り返す
+func ServeSeqPacket(listener *SeqPacketListener, handler func(request []byte) []byte) error {
+	for {
+		conn, err := listener.AcceptSeqPacket()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer func() {
+				_ = conn.Close()
+			}()
+			for {
+				request, err := conn.ReadMessage()
+				if err != nil {
+					return
+				}
+				if err := conn.WriteMessage(handler(request)); err != nil {
+					return
+				}
+			}
+		}()
+	}
+}
@@ -0,0 +1,54 @@
+//go:build dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build dragonfly freebsd linux netbsd openbsd solaris
+
+package unixsock
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSeqPacket(t *testing.T) {
+	path, cleanup := tempSocketPath(t, "seqpacket.sock")
+	defer cleanup()
+	listener, err := ListenSeqPacket(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		_ = ServeSeqPacket(listener, func(request []byte) []byte {
+			return bytes.ToUpper(request)
+		})
+	}()
+
+	conn, err := DialSeqPacket(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// 続けて送ってもメッセージがつながらずに1つずつ届く
+	messages := []string{"hello", "from", "client"}
+	for _, message := range messages {
+		if err := conn.WriteMessage([]byte(message)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, message := range messages {
+		response, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(response) != string(bytes.ToUpper([]byte(message))) {
+			t.Errorf("response = %q, want %q", response, message)
+		}
+	}
+
+	conn.MaxMessageSize = 4
+	if _, err := conn.Call([]byte("too large")); err != ErrMessageTooLarge {
+		t.Errorf("err = %v, want %v", err, ErrMessageTooLarge)
+	}
+	if err := conn.WriteMessage(nil); err != ErrEmptyMessage {
+		t.Errorf("err = %v, want %v", err, ErrEmptyMessage)
+	}
+}
@@ -0,0 +1,18 @@
+package unixsock
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func tempSocketPath(t *testing.T, name string) (string, func()) {
+	dir, err := ioutil.TempDir("", "unixsock-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, name), func() {
+		_ = os.RemoveAll(dir)
+	}
+}
@@ -53,6 +53,8 @@ func main() {
 		return
 	}
 
+	// 長く動くサーバーのログなら、os.Createの代わりにrotatelog.New("multiwriter.log")を使うと
+	// 大きさや時間でファイルが切り替わり、古いファイルの圧縮や削除もできる
 	file, err := os.Create("multiwriter.log")
 	if err != nil {
 		panic(err)
@@ -68,14 +70,20 @@ func main() {
 	}
 
 	// 書き込まれたデータをgzip圧縮してos.Fileに中継する
+	// gzip.Writerに書かないと圧縮されず、空のアーカイブになる
 	gWriter := gzip.NewWriter(gz)
 	gWriter.Header.Name = "test.log"
-	if _, err := io.WriteString(writer, "gizp.Writer example\n"); err != nil {
-		return
+	if _, err := io.WriteString(gWriter, "gzip.Writer example\n"); err != nil {
+		panic(err)
 	}
+	// Close()で圧縮しきれていない残りとCRC、大きさが書き出される。gzip.Writerは元のos.Fileを閉じない
 	if err := gWriter.Close(); err != nil {
-		return
+		panic(err)
+	}
+	if err := gz.Close(); err != nil {
+		panic(err)
 	}
+	// 大きなログの途中をランダムアクセスしたい場合は、ブロックごとに圧縮して索引を付けるgzseekパッケージを使う
 
 	// 出力結果を一時的に貯めておいてある分量ごとにまとめて書き出すbufio.Writerという構造体もある
 	// Flush()メソッドを呼ぶと後続のio.Writerに書き出す(他の言語のバッファ付き出力)